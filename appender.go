@@ -0,0 +1,249 @@
+package timetogo
+
+import (
+	"io"
+	"os"
+	"time"
+
+	"github.com/dsoprea/go-logging"
+)
+
+var (
+	appenderLogger = log.NewLogger("timetogo.appender")
+)
+
+// Appender updates a stream in a log-structured way. New series, and new data
+// for existing series, are written after the end of the stream (after the old
+// stream footer) and then a new stream footer is written that references both
+// the existing and the new series. Nothing that is already in the stream is
+// moved or overwritten. Series whose data has been replaced, and the old
+// stream footer, are left where they are and are recorded as free regions in
+// the stream footer until the stream is compacted (e.g. with `CompactInPlace`
+// or `Updater`). If an append is interrupted, the stream can be recovered by
+// truncating it back to its previous size.
+//
+// Unlike `Updater`, series that are not given are retained.
+type Appender struct {
+	rws io.ReadWriteSeeker
+
+	seriesDataWriter interface{}
+	newSeries        []SeriesFooter
+
+	overlapPolicy OverlapPolicy
+	maxGap        time.Duration
+}
+
+// NewAppender returns a new `Appender` struct.
+func NewAppender(rws io.ReadWriteSeeker, seriesDataWriter interface{}) *Appender {
+	return &Appender{
+		rws:              rws,
+		seriesDataWriter: seriesDataWriter,
+		newSeries:        make([]SeriesFooter, 0),
+	}
+}
+
+// SetOverlapPolicy determines how series with inverted, overlapping, or (for
+// `OpContiguous`) non-contiguous time ranges are handled. The series that are
+// retained are checked before anything is written. New and replacement series
+// are checked as they are written, once any summary from their datasource has
+// been applied, and a series that is rejected is not written.
+func (appender *Appender) SetOverlapPolicy(policy OverlapPolicy, maxGap time.Duration) {
+	appender.overlapPolicy = policy
+	appender.maxGap = maxGap
+}
+
+// AddSeries queues a series to be written. If the UUID and source SHA1 match
+// an existing series, nothing is written for it. If only the UUID matches, the
+// series is written again and supersedes the existing one (the created-time of
+// the existing series will be retained).
+func (appender *Appender) AddSeries(seriesFooter SeriesFooter) {
+	appender.newSeries = append(appender.newSeries, seriesFooter)
+}
+
+// Write writes the queued series and the new stream footer. Adds, replaces, and
+// retained series (as skips) are tallied in the returned stats.
+func (appender *Appender) Write() (totalSize int, stats UpdateStats, err error) {
+	defer func() {
+		if state := recover(); state != nil {
+			err = log.Wrap(state.(error))
+		}
+	}()
+
+	// Read the existing series and find where the stream footer starts.
+
+	sr := NewStreamReader(appender.rws)
+
+	existingSeriesInfo := make([]StreamIndexedSequenceInfo, 0)
+	existingSeries := make([]SeriesFooter, 0)
+	existingOccupied := make([]occupiedRegion, 0)
+	freeRegions := make([]FreeRegion, 0)
+	streamFooterOffset := int64(0)
+	streamEnd := int64(0)
+
+	it, err := NewIterator(sr)
+	if err != nil {
+		if err != io.EOF {
+			log.Panic(err)
+		}
+	} else {
+		for i := 0; i < it.Count(); i++ {
+			sisi := it.SeriesInfo(i)
+
+			seriesFooter, dataOffset, seriesSize, err := sr.ReadSeriesInfoWithIndexedInfo(sisi)
+			log.PanicIf(err)
+
+			region := occupiedRegion{
+				position: dataOffset,
+				size:     int64(seriesSize),
+			}
+
+			existingSeriesInfo = append(existingSeriesInfo, sisi)
+			existingSeries = append(existingSeries, seriesFooter)
+			existingOccupied = append(existingOccupied, region)
+		}
+
+		freeRegions = append(freeRegions, it.FreeRegions()...)
+
+		err = sr.Reset()
+		log.PanicIf(err)
+
+		_, _, footerBytes, footerOffset, err := sr.readOneFooter()
+		log.PanicIf(err)
+
+		streamFooterOffset = footerOffset
+		streamEnd = footerOffset + int64(len(footerBytes)) + ShadowFooterSize
+	}
+
+	existingByUuid := make(map[string]int)
+	for i, seriesFooter := range existingSeries {
+		existingByUuid[seriesFooter.Uuid()] = i
+	}
+
+	// Determine what actually has to be written.
+
+	superseded := make(map[string]struct{})
+	toWrite := make([]SeriesFooter, 0)
+	newSeriesUuids := make(map[string]struct{})
+
+	for _, seriesFooter := range appender.newSeries {
+		uuid := seriesFooter.Uuid()
+
+		if _, found := newSeriesUuids[uuid]; found == true {
+			log.Panicf("series [%s] was added more than once", uuid)
+		}
+
+		newSeriesUuids[uuid] = struct{}{}
+
+		i, found := existingByUuid[uuid]
+		if found == false {
+			toWrite = append(toWrite, seriesFooter)
+			continue
+		}
+
+		existingSeriesFooter := existingSeries[i]
+		if string(existingSeriesFooter.SourceSha1()) == string(seriesFooter.SourceSha1()) {
+			continue
+		}
+
+		carryCreatedTime(seriesFooter, existingSeriesFooter.CreatedTime())
+
+		superseded[uuid] = struct{}{}
+		toWrite = append(toWrite, seriesFooter)
+	}
+
+	// Validate the time ranges of the series that are being retained before
+	// we modify anything. The footers of new and replacement series may not be
+	// final until their data has been written, so those are checked by the
+	// builder as they are added (as are gaps, for `OpContiguous`, when it's
+	// finished).
+
+	retainedSeries := make([]SeriesFooter, 0, len(existingSeries))
+	for _, seriesFooter := range existingSeries {
+		if _, found := superseded[seriesFooter.Uuid()]; found == false {
+			retainedSeries = append(retainedSeries, seriesFooter)
+		}
+	}
+
+	err = checkTimeRanges(seriesFootersToIndexedInfo(retainedSeries), appender.overlapPolicy, appender.maxGap, false)
+	log.PanicIf(err)
+
+	if len(toWrite) == 0 {
+		appenderLogger.Debugf(nil, "No series need to be written. Not updating the stream footer.")
+
+		stats.Skips = len(existingSeries)
+
+		size, err := appender.rws.Seek(0, os.SEEK_END)
+		log.PanicIf(err)
+
+		return int(size), stats, nil
+	}
+
+	if appender.seriesDataWriter == nil {
+		log.Panicf("data needed for series [%s] but no data-writer was provided", toWrite[0].Uuid())
+	}
+
+	// Write the new series after the existing stream footer so that the
+	// stream is still intact up to there if we're interrupted. The old footer
+	// becomes free space.
+
+	if streamEnd > streamFooterOffset {
+		fr := FreeRegion{
+			AbsolutePosition: streamFooterOffset,
+			Length:           streamEnd - streamFooterOffset,
+		}
+
+		freeRegions = append(freeRegions, fr)
+	}
+
+	_, err = appender.rws.Seek(streamEnd, os.SEEK_SET)
+	log.PanicIf(err)
+
+	sb := newStreamBuilderAtOffset(appender.rws, streamEnd)
+	sb.SetOverlapPolicy(appender.overlapPolicy, appender.maxGap)
+
+	for i, seriesFooter := range existingSeries {
+		if _, found := superseded[seriesFooter.Uuid()]; found == true {
+			appenderLogger.Debugf(nil, "Series [%s] is being superseded.", seriesFooter.Uuid())
+
+			fr := FreeRegion{
+				AbsolutePosition: existingOccupied[i].position,
+				Length:           existingOccupied[i].size,
+			}
+
+			freeRegions = append(freeRegions, fr)
+			continue
+		}
+
+		sb.addRetainedSeries(existingSeriesInfo[i].AbsolutePosition(), seriesFooter)
+		stats.Skips++
+	}
+
+	for _, seriesFooter := range toWrite {
+		appenderLogger.Debugf(nil, "Appending series [%s].", seriesFooter.Uuid())
+
+		seriesFooter.TouchUpdatedTime()
+
+		err := sb.AddSeries(appender.seriesDataWriter, seriesFooter)
+		log.PanicIf(err)
+
+		if _, found := superseded[seriesFooter.Uuid()]; found == true {
+			stats.Replaces++
+		} else {
+			stats.Adds++
+		}
+	}
+
+	sb.setFreeRegions(normalizeFreeRegions(freeRegions))
+
+	totalSize, err = sb.Finish()
+	log.PanicIf(err)
+
+	if truncater, ok := appender.rws.(Truncater); ok == true {
+		appenderLogger.Debugf(nil, "Underlying RWS is also a truncater. Truncating stream to right size after append.")
+
+		err = truncater.Truncate(int64(totalSize))
+		log.PanicIf(err)
+	}
+
+	return totalSize, stats, nil
+}
@@ -0,0 +1,283 @@
+package timetogo
+
+import (
+	"bytes"
+	"io"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/dsoprea/go-logging"
+	"github.com/randomingenuity/go-utility/filesystem"
+)
+
+func TestAppender_Write_Replace(t *testing.T) {
+	raw, series, _ := WriteTestMultiseriesStream()
+
+	originalRaw := make([]byte, len(raw))
+	copy(originalRaw, raw)
+
+	replacement := NewSeriesFooter1WithUuid(
+		series[0].Uuid(),
+		series[0].HeadRecordTime(),
+		series[0].TailRecordTime(),
+		series[0].RecordCount(),
+		[]byte{1, 2, 3, 4})
+
+	replacementData := []byte("replacement data")
+
+	sdtg := &SeriesDataTestGenerator{
+		data: map[string]io.Reader{
+			replacement.Uuid(): bytes.NewBuffer(replacementData),
+		},
+	}
+
+	rws := rifs.NewSeekableBufferWithBytes(raw)
+
+	appender := NewAppender(rws, sdtg)
+	appender.AddSeries(replacement)
+	appender.AddSeries(series[1])
+
+	totalSize, stats, err := appender.Write()
+	log.PanicIf(err)
+
+	if stats != (UpdateStats{Skips: 1, Replaces: 1}) {
+		t.Fatalf("Stats not correct: %s", stats)
+	}
+
+	appendedRaw := rws.Bytes()[:totalSize]
+
+	// Nothing in the original stream, including its footer, should have been
+	// touched, so truncating back to it recovers it.
+
+	seriesEnd := 171 + 177
+	if bytes.Compare(appendedRaw[:len(originalRaw)], originalRaw) != 0 {
+		t.Fatalf("Existing stream was modified.")
+	}
+
+	footers, data := readTestStreamSeries(appendedRaw)
+
+	if len(footers) != 2 {
+		t.Fatalf("Series count not correct: (%d)", len(footers))
+	} else if footers[0].Uuid() != series[1].Uuid() || footers[1].Uuid() != series[0].Uuid() {
+		t.Fatalf("Series not correct.")
+	} else if bytes.Compare(data[0], TestTimeSeriesData2) != 0 {
+		t.Fatalf("Retained series data not correct.")
+	} else if bytes.Compare(data[1], replacementData) != 0 {
+		t.Fatalf("Replacement series data not correct.")
+	} else if footers[1].CreatedTime().Equal(series[0].CreatedTime()) == false {
+		t.Fatalf("Created-time of replaced series not retained.")
+	}
+
+	// The superseded series and the old stream footer should be recorded as
+	// free.
+
+	it, err := NewIterator(NewStreamReader(bytes.NewReader(appendedRaw)))
+	log.PanicIf(err)
+
+	expectedFreeRegions := []FreeRegion{
+		{AbsolutePosition: 0, Length: 171},
+		{AbsolutePosition: int64(seriesEnd), Length: int64(len(originalRaw) - seriesEnd)},
+	}
+
+	if reflect.DeepEqual(it.FreeRegions(), expectedFreeRegions) != true {
+		t.Fatalf("Free regions not correct: %v", it.FreeRegions())
+	}
+
+	replacementSize := int(it.SeriesInfo(1).AbsolutePosition()) + 1 - len(originalRaw)
+
+	// Reclaim the dead space with a regular update.
+
+	updater := NewUpdater(rws, nil)
+	updater.AddSeries(footers[0])
+	updater.AddSeries(footers[1])
+
+	compactedSize, stats, err := updater.Write()
+	log.PanicIf(err)
+
+	if stats != (UpdateStats{Skips: 2}) {
+		t.Fatalf("Compaction stats not correct: %s", stats)
+	} else if compactedSize != 177+replacementSize+206 {
+		t.Fatalf("Compacted size not correct: (%d)", compactedSize)
+	}
+
+	compactedRaw := rws.Bytes()[:compactedSize]
+
+	it, err = NewIterator(NewStreamReader(bytes.NewReader(compactedRaw)))
+	log.PanicIf(err)
+
+	if len(it.FreeRegions()) != 0 {
+		t.Fatalf("Compacted stream should not have free regions: %v", it.FreeRegions())
+	}
+
+	compactedFooters, compactedData := readTestStreamSeries(compactedRaw)
+
+	if compactedFooters[0].Uuid() != series[1].Uuid() || compactedFooters[1].Uuid() != series[0].Uuid() {
+		t.Fatalf("Compacted series not correct.")
+	} else if bytes.Compare(compactedData[0], TestTimeSeriesData2) != 0 {
+		t.Fatalf("Compacted retained series data not correct.")
+	} else if bytes.Compare(compactedData[1], replacementData) != 0 {
+		t.Fatalf("Compacted replacement series data not correct.")
+	}
+}
+
+func TestAppender_Write_Add(t *testing.T) {
+	raw, series, _ := WriteTestMultiseriesStream()
+
+	footers, data := getTestParallelSeries(1)
+
+	sdtg := &SeriesDataTestGenerator{
+		data: map[string]io.Reader{
+			footers[0].Uuid(): bytes.NewBuffer(data[0]),
+		},
+	}
+
+	rws := rifs.NewSeekableBufferWithBytes(raw)
+
+	// Series that aren't given are retained.
+
+	appender := NewAppender(rws, sdtg)
+	appender.AddSeries(footers[0])
+
+	totalSize, stats, err := appender.Write()
+	log.PanicIf(err)
+
+	if stats != (UpdateStats{Skips: 2, Adds: 1}) {
+		t.Fatalf("Stats not correct: %s", stats)
+	}
+
+	readFooters, readData := readTestStreamSeries(rws.Bytes()[:totalSize])
+
+	if len(readFooters) != 3 {
+		t.Fatalf("Series count not correct: (%d)", len(readFooters))
+	} else if readFooters[0].Uuid() != series[0].Uuid() || readFooters[1].Uuid() != series[1].Uuid() || readFooters[2].Uuid() != footers[0].Uuid() {
+		t.Fatalf("Series not correct.")
+	} else if bytes.Compare(readData[2], data[0]) != 0 {
+		t.Fatalf("Added series data not correct.")
+	}
+}
+
+func TestAppender_Write_Empty(t *testing.T) {
+	footers, data := getTestParallelSeries(1)
+
+	sdtg := &SeriesDataTestGenerator{
+		data: map[string]io.Reader{
+			footers[0].Uuid(): bytes.NewBuffer(data[0]),
+		},
+	}
+
+	rws := rifs.NewSeekableBuffer()
+
+	appender := NewAppender(rws, sdtg)
+	appender.AddSeries(footers[0])
+
+	totalSize, stats, err := appender.Write()
+	log.PanicIf(err)
+
+	if stats != (UpdateStats{Adds: 1}) {
+		t.Fatalf("Stats not correct: %s", stats)
+	}
+
+	readFooters, readData := readTestStreamSeries(rws.Bytes()[:totalSize])
+
+	if len(readFooters) != 1 {
+		t.Fatalf("Series count not correct: (%d)", len(readFooters))
+	} else if bytes.Compare(readData[0], data[0]) != 0 {
+		t.Fatalf("Series data not correct.")
+	}
+}
+
+func TestAppender_Write_NoChange(t *testing.T) {
+	raw, series, _ := WriteTestMultiseriesStream()
+
+	originalRaw := make([]byte, len(raw))
+	copy(originalRaw, raw)
+
+	rws := rifs.NewSeekableBufferWithBytes(raw)
+
+	appender := NewAppender(rws, nil)
+	appender.AddSeries(series[0])
+
+	totalSize, stats, err := appender.Write()
+	log.PanicIf(err)
+
+	if stats != (UpdateStats{Skips: 2}) {
+		t.Fatalf("Stats not correct: %s", stats)
+	} else if totalSize != len(originalRaw) {
+		t.Fatalf("Total size not correct: (%d)", totalSize)
+	} else if bytes.Compare(rws.Bytes(), originalRaw) != 0 {
+		t.Fatalf("Stream was modified.")
+	}
+}
+
+func TestAppender_Write_OverlapPolicy_Summarized(t *testing.T) {
+	newCsvSeries := func(timestamps ...string) (sf SeriesFooter, ss storedSeries) {
+		records := make([][]string, len(timestamps))
+		for i, timestamp := range timestamps {
+			records[i] = []string{timestamp, "1.5"}
+		}
+
+		// The footer only has placeholders until the CSV is encoded.
+
+		sf = NewSeriesFooter1(time.Time{}, time.Time{}, 0, nil)
+
+		ss = storedSeries{
+			seriesFooter:     sf,
+			seriesDataWriter: NewCsvEncoderDatasource(records, CsvTimestampColumn{}),
+		}
+
+		return sf, ss
+	}
+
+	sf1, ss1 := newCsvSeries("1475325300", "1475325310")
+	sf2, ss2 := newCsvSeries("1475325400", "1475325410")
+
+	ssdw := storeSeriesDataWriter{
+		staged: map[string]storedSeries{
+			sf1.Uuid(): ss1,
+			sf2.Uuid(): ss2,
+		},
+	}
+
+	rws := rifs.NewSeekableBuffer()
+
+	// The placeholder ranges are identical but the summarized ones don't
+	// overlap.
+
+	appender := NewAppender(rws, ssdw)
+	appender.SetOverlapPolicy(OpReject, 0)
+
+	appender.AddSeries(sf1)
+	appender.AddSeries(sf2)
+
+	totalSize, stats, err := appender.Write()
+	log.PanicIf(err)
+
+	if stats != (UpdateStats{Adds: 2}) {
+		t.Fatalf("Stats not correct: %s", stats)
+	}
+
+	footers, _ := readTestStreamSeries(rws.Bytes()[:totalSize])
+
+	if footers[0].HeadRecordTime().Equal(time.Unix(1475325300, 0)) != true || footers[1].TailRecordTime().Equal(time.Unix(1475325410, 0)) != true {
+		t.Fatalf("Summarized times not correct: %s %s", footers[0], footers[1])
+	}
+
+	// The placeholder range doesn't overlap the existing series but the
+	// summarized one does.
+
+	sf3, ss3 := newCsvSeries("1475325305")
+	ssdw.staged[sf3.Uuid()] = ss3
+
+	appender = NewAppender(rws, ssdw)
+	appender.SetOverlapPolicy(OpReject, 0)
+
+	appender.AddSeries(sf3)
+
+	_, _, err = appender.Write()
+	if err == nil {
+		t.Fatalf("Expected overlap failure.")
+	} else if log.Is(err, ErrSeriesOverlap) != true {
+		log.Panic(err)
+	}
+}
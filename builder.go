@@ -4,6 +4,8 @@ import (
 	"io"
 	"os"
 	"reflect"
+	"sort"
+	"time"
 
 	"hash/fnv"
 
@@ -13,6 +15,7 @@ import (
 // StreamBuilder is the high-level interface that owns the stream-building
 // process and wraps `StreamWriter`.
 type StreamBuilder struct {
+	// ws is nil if we were given a non-seekable writer.
 	ws     io.WriteSeeker
 	sw     *StreamWriter
 	series []SeriesFooter
@@ -20,7 +23,17 @@ type StreamBuilder struct {
 	nextOffset int64
 	offsets    []int64
 
+	// freeRegions are recorded in the stream footer.
+	freeRegions []FreeRegion
+
 	copyBuffer []byte
+
+	overlapPolicy OverlapPolicy
+	maxGap        time.Duration
+
+	// timeRanges is the union of the time ranges of the series so far. It's
+	// used to check each new series for overlaps without rechecking them all.
+	timeRanges timeRangeSet
 }
 
 // NewStreamBuilder returns a new `StreamBuilder`.
@@ -29,18 +42,40 @@ func NewStreamBuilder(ws io.WriteSeeker) *StreamBuilder {
 	// correct place. This enables us to copy existing data from later positions
 	// in the file.
 
-	sw := NewStreamWriter(ws)
+	sb := NewStreamBuilderWithWriter(ws)
+	sb.ws = ws
+
+	return sb
+}
+
+// NewStreamBuilderWithWriter returns a new `StreamBuilder` that writes to a
+// plain `io.Writer` (e.g. a pipe, a compressor, or an upload body). Positions
+// are tracked by the builder itself rather than checked against the writer.
+// `AddSeriesNoWrite` is not supported since it requires seeking.
+func NewStreamBuilderWithWriter(w io.Writer) *StreamBuilder {
+	sw := NewStreamWriter(w)
 	series := make([]SeriesFooter, 0)
 	offsets := make([]int64, 0)
 
 	return &StreamBuilder{
-		ws:      ws,
 		sw:      sw,
 		series:  series,
 		offsets: offsets,
 	}
 }
 
+// newStreamBuilderAtOffset returns a `StreamBuilder` whose writes begin at the
+// given offset rather than at the front of the stream. The writer must
+// already be positioned there.
+func newStreamBuilderAtOffset(ws io.WriteSeeker, offset int64) *StreamBuilder {
+	sb := NewStreamBuilder(ws)
+
+	sb.nextOffset = offset
+	sb.sw.bumpPosition(offset)
+
+	return sb
+}
+
 // SetStructureLogging enables/disables structure tracking.
 func (sb *StreamBuilder) SetStructureLogging(flag bool) {
 	sb.sw.SetStructureLogging(flag)
@@ -51,6 +86,40 @@ func (sb *StreamBuilder) Structure() *StreamStructure {
 	return sb.sw.Structure()
 }
 
+// SetOverlapPolicy determines how series with inverted or overlapping time
+// ranges are handled. Overlaps are checked as each series is added. For
+// `OpContiguous`, gaps larger than `maxGap` are checked when the stream is
+// finished (zero uses `DefaultContiguousMaxGap`).
+func (sb *StreamBuilder) SetOverlapPolicy(policy OverlapPolicy, maxGap time.Duration) {
+	sb.overlapPolicy = policy
+	sb.maxGap = maxGap
+}
+
+// checkNewSeries applies the overlap policy to the given series and the ones
+// that have already been added. Only the new series is checked, against the
+// union of the earlier ranges, so this doesn't grow with the number of series.
+func (sb *StreamBuilder) checkNewSeries(sf SeriesFooter) (err error) {
+	defer func() {
+		if state := recover(); state != nil {
+			err = log.Wrap(state.(error))
+		}
+	}()
+
+	if sb.overlapPolicy == OpAllow {
+		return nil
+	}
+
+	if sf.HeadRecordTime().After(sf.TailRecordTime()) == true {
+		timeRangesLogger.Debugf(nil, "Series has inverted time range: [%s]", sf.Uuid())
+		log.Panic(ErrSeriesTimeRangeInverted)
+	} else if sb.timeRanges.overlaps(sf.HeadRecordTime(), sf.TailRecordTime()) == true {
+		timeRangesLogger.Debugf(nil, "Series overlaps an earlier series: [%s]", sf.Uuid())
+		log.Panic(ErrSeriesOverlap)
+	}
+
+	return nil
+}
+
 // StreamWriter returns the underlying `StreamWriter` struct.
 func (sb *StreamBuilder) StreamWriter() *StreamWriter {
 	return sb.sw
@@ -58,7 +127,11 @@ func (sb *StreamBuilder) StreamWriter() *StreamWriter {
 
 // AddSeries adds a single series and associated metadata to the stream. The
 // actual series data is provided to us by the caller in serialized (encoded)
-// form from whatever their original format was.
+// form from whatever their original format was. If an overlap policy is set
+// and the footer may be changed while the data is written (the datasource is a
+// `SeriesDataDatasourceWriter` or a `SeriesDataDatasourceSummarizer`), the
+// data is buffered first so that the policy is applied to the final footer
+// and nothing is written for a series that it rejects.
 func (sb *StreamBuilder) AddSeries(seriesDataWriter interface{}, sf SeriesFooter) (err error) {
 	defer func() {
 		if state := recover(); state != nil {
@@ -66,6 +139,24 @@ func (sb *StreamBuilder) AddSeries(seriesDataWriter interface{}, sf SeriesFooter
 		}
 	}()
 
+	_, isDatasourceWriter := seriesDataWriter.(SeriesDataDatasourceWriter)
+	_, isSummarizer := seriesDataWriter.(SeriesDataDatasourceSummarizer)
+
+	if sb.overlapPolicy != OpAllow && (isDatasourceWriter == true || isSummarizer == true) {
+		es, err := encodeSeries(seriesDataWriter, sf, DefaultSpillThreshold)
+		log.PanicIf(err)
+
+		defer es.buffer.Close()
+
+		r, err := es.buffer.Reader()
+		log.PanicIf(err)
+
+		err = sb.addEncodedSeries(r, es.dataSize, es.fnvChecksum, sf)
+		log.PanicIf(err)
+
+		return nil
+	}
+
 	// NOTE(dustin): Note that we don't perform the same current-position check
 	// that we do at the bottom and at the top and bottom of the other function
 	// because we're not currently guaranteed to be at that position. The
@@ -75,6 +166,9 @@ func (sb *StreamBuilder) AddSeries(seriesDataWriter interface{}, sf SeriesFooter
 		sb.copyBuffer = make([]byte, SeriesDataCopyBufferSize)
 	}
 
+	err = sb.checkNewSeries(sf)
+	log.PanicIf(err)
+
 	err = sb.sw.pushSeriesMilestone(-1, MtSeriesDataHeadByte, sf.Uuid(), "")
 	log.PanicIf(err)
 
@@ -82,11 +176,60 @@ func (sb *StreamBuilder) AddSeries(seriesDataWriter interface{}, sf SeriesFooter
 
 	teeWriter := io.MultiWriter(sb.sw, fnv1a)
 
-	var copiedCount uint64
+	copiedCount, err := writeSeriesData(teeWriter, seriesDataWriter, sf)
+	log.PanicIf(err)
+
+	fnvChecksum := fnv1a.Sum32()
+
+	applySeriesSummary(seriesDataWriter, sf)
+
+	err = sb.addSeriesFooter(copiedCount, fnvChecksum, sf)
+	log.PanicIf(err)
+
+	return nil
+}
+
+// addEncodedSeries adds a series whose data has already been encoded and
+// checksummed elsewhere. The data is copied verbatim.
+func (sb *StreamBuilder) addEncodedSeries(r io.Reader, dataSize uint64, fnvChecksum uint32, sf SeriesFooter) (err error) {
+	defer func() {
+		if state := recover(); state != nil {
+			err = log.Wrap(state.(error))
+		}
+	}()
+
+	err = sb.checkNewSeries(sf)
+	log.PanicIf(err)
+
+	err = sb.sw.pushSeriesMilestone(-1, MtSeriesDataHeadByte, sf.Uuid(), "")
+	log.PanicIf(err)
+
+	copiedCount, err := io.Copy(sb.sw, r)
+	log.PanicIf(err)
+
+	if uint64(copiedCount) != dataSize {
+		log.Panicf("encoded series data not the expected size: (%d) != (%d)", copiedCount, dataSize)
+	}
+
+	err = sb.addSeriesFooter(dataSize, fnvChecksum, sf)
+	log.PanicIf(err)
+
+	return nil
+}
+
+// writeSeriesData writes the series data from either a
+// `SeriesDataDatasourceWriter` or an `io.Reader` to the given writer.
+func writeSeriesData(w io.Writer, seriesDataWriter interface{}, sf SeriesFooter) (copiedCount uint64, err error) {
+	defer func() {
+		if state := recover(); state != nil {
+			err = log.Wrap(state.(error))
+		}
+	}()
+
 	switch t := seriesDataWriter.(type) {
 	case SeriesDataDatasourceWriter:
 		var err error
-		n, err := t.WriteData(teeWriter, sf)
+		n, err := t.WriteData(w, sf)
 		log.PanicIf(err)
 
 		copiedCount = uint64(n)
@@ -96,7 +239,7 @@ func (sb *StreamBuilder) AddSeries(seriesDataWriter interface{}, sf SeriesFooter
 		}
 
 	case io.Reader:
-		n, err := io.Copy(teeWriter, t)
+		n, err := io.Copy(w, t)
 		log.PanicIf(err)
 
 		copiedCount = uint64(n)
@@ -109,7 +252,17 @@ func (sb *StreamBuilder) AddSeries(seriesDataWriter interface{}, sf SeriesFooter
 		log.Panicf("series-data writer is not the right type: %s", reflect.TypeOf(seriesDataWriter))
 	}
 
-	fnvChecksum := fnv1a.Sum32()
+	return copiedCount, nil
+}
+
+// addSeriesFooter writes the footer for a series whose data has just been
+// written and records the series.
+func (sb *StreamBuilder) addSeriesFooter(copiedCount uint64, fnvChecksum uint32, sf SeriesFooter) (err error) {
+	defer func() {
+		if state := recover(); state != nil {
+			err = log.Wrap(state.(error))
+		}
+	}()
 
 	sf.SetBytesLength(uint64(copiedCount))
 
@@ -119,17 +272,17 @@ func (sb *StreamBuilder) AddSeries(seriesDataWriter interface{}, sf SeriesFooter
 	totalSeriesSize := int(copiedCount) + footerSize
 	sb.nextOffset += int64(totalSeriesSize)
 
-	// NOTE(dustin): Keep this and the check below for now.
-	position, err := sb.ws.Seek(0, os.SEEK_CUR)
-	log.PanicIf(err)
+	if sb.ws != nil {
+		// NOTE(dustin): Keep this and the check below for now.
+		position, err := sb.ws.Seek(0, os.SEEK_CUR)
+		log.PanicIf(err)
 
-	if position != sb.nextOffset {
-		log.Panicf("final position is not equal to next-offset (write): (%d) != (%d)", position, sb.nextOffset)
+		if position != sb.nextOffset {
+			log.Panicf("final position is not equal to next-offset (write): (%d) != (%d)", position, sb.nextOffset)
+		}
 	}
 
-	sb.offsets = append(sb.offsets, sb.nextOffset-1)
-
-	sb.series = append(sb.series, sf)
+	sb.recordSeries(sb.nextOffset-1, sf)
 
 	return nil
 }
@@ -139,6 +292,75 @@ func (sb *StreamBuilder) NextOffset() int64 {
 	return sb.nextOffset
 }
 
+// addRetainedSeries records a series that is already in the stream at the
+// given boundary position without writing or seeking. Unlike
+// `AddSeriesNoWrite`, the series does not have to be at the current offset.
+func (sb *StreamBuilder) addRetainedSeries(boundaryPosition int64, sf SeriesFooter) {
+	sb.recordSeries(boundaryPosition, sf)
+}
+
+// recordSeries records a series, at the given boundary position, for the
+// stream footer.
+func (sb *StreamBuilder) recordSeries(boundaryPosition int64, sf SeriesFooter) {
+	sb.offsets = append(sb.offsets, boundaryPosition)
+	sb.series = append(sb.series, sf)
+
+	sb.timeRanges.add(sf.HeadRecordTime(), sf.TailRecordTime())
+}
+
+// sortSeriesByPosition reorders the recorded series to match the order that
+// they are in the stream. This is needed when series were written out of order
+// (e.g. into free regions).
+func (sb *StreamBuilder) sortSeriesByPosition() {
+	sort.Sort(streamBuilderSeriesByPosition{sb})
+}
+
+// streamBuilderSeriesByPosition sorts the offsets and series of a builder
+// together.
+type streamBuilderSeriesByPosition struct {
+	sb *StreamBuilder
+}
+
+func (sbsp streamBuilderSeriesByPosition) Len() int {
+	return len(sbsp.sb.offsets)
+}
+
+func (sbsp streamBuilderSeriesByPosition) Less(i, j int) bool {
+	return sbsp.sb.offsets[i] < sbsp.sb.offsets[j]
+}
+
+func (sbsp streamBuilderSeriesByPosition) Swap(i, j int) {
+	sbsp.sb.offsets[i], sbsp.sb.offsets[j] = sbsp.sb.offsets[j], sbsp.sb.offsets[i]
+	sbsp.sb.series[i], sbsp.sb.series[j] = sbsp.sb.series[j], sbsp.sb.series[i]
+}
+
+// seekTo moves the writer to the given position so that the next series (or
+// the stream footer) is written there. This requires a seekable writer.
+func (sb *StreamBuilder) seekTo(offset int64) (err error) {
+	defer func() {
+		if state := recover(); state != nil {
+			err = log.Wrap(state.(error))
+		}
+	}()
+
+	if sb.ws == nil {
+		log.Panicf("can not seek without a seekable writer")
+	}
+
+	_, err = sb.ws.Seek(offset, os.SEEK_SET)
+	log.PanicIf(err)
+
+	sb.sw.bumpPosition(offset - sb.nextOffset)
+	sb.nextOffset = offset
+
+	return nil
+}
+
+// setFreeRegions sets the unused regions to record in the stream footer.
+func (sb *StreamBuilder) setFreeRegions(freeRegions []FreeRegion) {
+	sb.freeRegions = freeRegions
+}
+
 // AddSeriesNoWrite logs a single series and associated metadata but doesn't
 // actually write. It will be written (or potentially retained) through other
 // means.
@@ -149,6 +371,13 @@ func (sb *StreamBuilder) AddSeriesNoWrite(footerDataPosition int64, totalSeriesS
 		}
 	}()
 
+	if sb.ws == nil {
+		log.Panicf("series can not be retained without a seekable writer")
+	}
+
+	err = sb.checkNewSeries(sf)
+	log.PanicIf(err)
+
 	// NOTE(dustin): Keep this and the check below for now.
 	initialPosition, err := sb.ws.Seek(0, os.SEEK_CUR)
 	log.PanicIf(err)
@@ -190,8 +419,7 @@ func (sb *StreamBuilder) AddSeriesNoWrite(footerDataPosition int64, totalSeriesS
 		log.Panicf("final position is not expected (no-write): (%d) != (%d)", finalPosition, sb.nextOffset)
 	}
 
-	sb.offsets = append(sb.offsets, sb.nextOffset-1)
-	sb.series = append(sb.series, sf)
+	sb.recordSeries(sb.nextOffset-1, sf)
 
 	// NOTE(dustin): Keep this and the check below for now.
 	position, err := sb.ws.Seek(0, os.SEEK_CUR)
@@ -212,7 +440,12 @@ func (sb *StreamBuilder) Finish() (totalSize int, err error) {
 		}
 	}()
 
-	footerSize, err := sb.sw.writeStreamFooterWithSeriesFooters(sb.series, sb.offsets)
+	if sb.overlapPolicy == OpContiguous {
+		err := checkTimeRanges(seriesFootersToIndexedInfo(sb.series), sb.overlapPolicy, sb.maxGap, true)
+		log.PanicIf(err)
+	}
+
+	footerSize, err := sb.sw.writeStreamFooterWithSeriesFooters(sb.series, sb.offsets, sb.freeRegions)
 	log.PanicIf(err)
 
 	// For completeness, step the offset.
@@ -429,3 +429,285 @@ func ExampleStreamBuilder_AddSeries_Datasource() {
 	// OFF 548      MT shadow_footer_head_byte         SCOPE stream   UUID                                           COMM
 	// OFF 553      MT boundary_marker                 SCOPE stream   UUID                                           COMM
 }
+
+func TestBuilder_Finish_NonSeekableWriter(t *testing.T) {
+	footers, data := getTestParallelSeries(3)
+
+	seekableBuffer := rifs.NewSeekableBuffer()
+	sb := NewStreamBuilder(seekableBuffer)
+
+	for i, sf := range footers {
+		err := sb.AddSeries(bytes.NewBuffer(data[i]), sf)
+		log.PanicIf(err)
+	}
+
+	seekableSize, err := sb.Finish()
+	log.PanicIf(err)
+
+	// Write through a pipe, which can't seek.
+
+	pr, pw := io.Pipe()
+
+	go func() {
+		sb := NewStreamBuilderWithWriter(pw)
+
+		for i, sf := range footers {
+			err := sb.AddSeries(bytes.NewBuffer(data[i]), sf)
+			if err != nil {
+				pw.CloseWithError(err)
+				return
+			}
+		}
+
+		_, err := sb.Finish()
+		pw.CloseWithError(err)
+	}()
+
+	b := new(bytes.Buffer)
+
+	_, err = b.ReadFrom(pr)
+	log.PanicIf(err)
+
+	if b.Len() != seekableSize {
+		t.Fatalf("Stream size not correct: (%d) != (%d)", b.Len(), seekableSize)
+	} else if bytes.Compare(b.Bytes(), seekableBuffer.Bytes()) != 0 {
+		t.Fatalf("Stream written to non-seekable writer does not match.")
+	}
+}
+
+func TestBuilder_AddSeriesNoWrite_NonSeekableWriter(t *testing.T) {
+	footers, _ := getTestParallelSeries(1)
+
+	sb := NewStreamBuilderWithWriter(new(bytes.Buffer))
+
+	err := sb.AddSeriesNoWrite(0, 100, footers[0])
+	if err == nil {
+		t.Fatalf("Expected failure without a seekable writer.")
+	}
+}
+
+// testSummarizerDatasource writes fixed data and only provides its summary
+// once the data has been written.
+type testSummarizerDatasource struct {
+	data           []byte
+	headRecordTime time.Time
+	tailRecordTime time.Time
+	written        bool
+}
+
+func (tsd *testSummarizerDatasource) WriteData(w io.Writer, sf SeriesFooter) (n int, err error) {
+	tsd.written = true
+	return w.Write(tsd.data)
+}
+
+func (tsd *testSummarizerDatasource) SeriesSummary() (headRecordTime, tailRecordTime time.Time, recordCount uint64, sourceSha1 []byte) {
+	if tsd.written == false {
+		log.Panicf("summary requested before data written")
+	}
+
+	return tsd.headRecordTime, tsd.tailRecordTime, uint64(len(tsd.data)), []byte{99}
+}
+
+func TestBuilder_AddSeries_Summarizer(t *testing.T) {
+	headRecordTime := time.Date(2016, 10, 1, 12, 34, 56, 0, time.UTC)
+
+	tsd := &testSummarizerDatasource{
+		data:           TestTimeSeriesData,
+		headRecordTime: headRecordTime,
+		tailRecordTime: headRecordTime.Add(time.Second * 10),
+	}
+
+	b := rifs.NewSeekableBuffer()
+	sb := NewStreamBuilder(b)
+
+	err := sb.AddSeries(tsd, NewSeriesFooter1(time.Time{}, time.Time{}, 0, nil))
+	log.PanicIf(err)
+
+	_, err = sb.Finish()
+	log.PanicIf(err)
+
+	footers, data := readTestStreamSeries(b.Bytes())
+
+	sf := footers[0]
+
+	if sf.HeadRecordTime() != tsd.headRecordTime {
+		t.Fatalf("Head time not correct: [%s]", sf.HeadRecordTime())
+	} else if sf.TailRecordTime() != tsd.tailRecordTime {
+		t.Fatalf("Tail time not correct: [%s]", sf.TailRecordTime())
+	} else if sf.RecordCount() != uint64(len(TestTimeSeriesData)) {
+		t.Fatalf("Record count not correct: (%d)", sf.RecordCount())
+	} else if bytes.Equal(sf.SourceSha1(), []byte{99}) != true {
+		t.Fatalf("Source SHA1 not correct: [%x]", sf.SourceSha1())
+	} else if bytes.Equal(data[0], TestTimeSeriesData) != true {
+		t.Fatalf("Data not correct.")
+	}
+
+	// The index is built from the same footer.
+
+	it, err := NewIterator(NewStreamReader(b))
+	log.PanicIf(err)
+
+	sisi := it.SeriesInfo(0)
+
+	if sisi.HeadRecordTime() != tsd.headRecordTime {
+		t.Fatalf("Indexed head time not correct: [%s]", sisi.HeadRecordTime())
+	} else if sisi.TailRecordTime() != tsd.tailRecordTime {
+		t.Fatalf("Indexed tail time not correct: [%s]", sisi.TailRecordTime())
+	}
+}
+
+func TestBuilder_AddSeries_Summarizer_OverlapPolicy(t *testing.T) {
+	b := rifs.NewSeekableBuffer()
+
+	sb := NewStreamBuilder(b)
+	sb.SetOverlapPolicy(OpReject, 0)
+
+	headRecordTime := time.Date(2016, 10, 1, 12, 34, 56, 0, time.UTC)
+
+	sf1 := NewSeriesFooter1(headRecordTime, headRecordTime.Add(time.Second*20), 22, []byte{11, 22, 33})
+
+	err := sb.AddSeries(bytes.NewBuffer(TestTimeSeriesData), sf1)
+	log.PanicIf(err)
+
+	// The placeholder times wouldn't overlap, but the late-bound ones do.
+
+	tsd := &testSummarizerDatasource{
+		data:           TestTimeSeriesData2,
+		headRecordTime: headRecordTime.Add(time.Second * 10),
+		tailRecordTime: headRecordTime.Add(time.Second * 30),
+	}
+
+	nextOffset := sb.NextOffset()
+
+	err = sb.AddSeries(tsd, NewSeriesFooter1(time.Time{}, time.Time{}, 0, nil))
+	if err == nil {
+		t.Fatalf("Expected overlap failure.")
+	} else if log.Is(err, ErrSeriesOverlap) != true {
+		log.Panic(err)
+	}
+
+	// Nothing was written for the rejected series, so the builder can still be
+	// used.
+
+	if sb.NextOffset() != nextOffset || int64(len(b.Bytes())) != nextOffset {
+		t.Fatalf("Data was written for the rejected series.")
+	}
+
+	tsd = &testSummarizerDatasource{
+		data:           TestTimeSeriesData2,
+		headRecordTime: headRecordTime.Add(time.Second * 30),
+		tailRecordTime: headRecordTime.Add(time.Second * 40),
+	}
+
+	sf2 := NewSeriesFooter1(time.Time{}, time.Time{}, 0, nil)
+
+	err = sb.AddSeries(tsd, sf2)
+	log.PanicIf(err)
+
+	_, err = sb.Finish()
+	log.PanicIf(err)
+
+	footers, data := readTestStreamSeries(b.Bytes())
+
+	if len(footers) != 2 {
+		t.Fatalf("Series count not correct: (%d)", len(footers))
+	} else if footers[0].Uuid() != sf1.Uuid() || footers[1].Uuid() != sf2.Uuid() {
+		t.Fatalf("Series not correct.")
+	} else if bytes.Equal(data[0], TestTimeSeriesData) != true || bytes.Equal(data[1], TestTimeSeriesData2) != true {
+		t.Fatalf("Data not correct.")
+	}
+}
+
+func TestBuilder_AddSeries_Summarizer_KeepsSourceSha1(t *testing.T) {
+	headRecordTime := time.Date(2016, 10, 1, 12, 34, 56, 0, time.UTC)
+
+	tsd := &testSummarizerDatasource{
+		data:           TestTimeSeriesData,
+		headRecordTime: headRecordTime,
+		tailRecordTime: headRecordTime.Add(time.Second * 10),
+	}
+
+	b := rifs.NewSeekableBuffer()
+	sb := NewStreamBuilder(b)
+
+	err := sb.AddSeries(tsd, NewSeriesFooter1(time.Time{}, time.Time{}, 0, []byte{11, 22, 33}))
+	log.PanicIf(err)
+
+	_, err = sb.Finish()
+	log.PanicIf(err)
+
+	footers, _ := readTestStreamSeries(b.Bytes())
+
+	sf := footers[0]
+
+	if bytes.Equal(sf.SourceSha1(), []byte{11, 22, 33}) != true {
+		t.Fatalf("Source SHA1 not correct: [%x]", sf.SourceSha1())
+	} else if sf.HeadRecordTime() != tsd.headRecordTime {
+		t.Fatalf("Head time not correct: [%s]", sf.HeadRecordTime())
+	}
+}
+
+func TestBuilder_AddSeries_WrappedSummarizer_OverlapPolicy(t *testing.T) {
+	headRecordTime := time.Date(2016, 10, 1, 12, 34, 56, 0, time.UTC)
+
+	// The store writer isn't a summarizer itself but applies the summary of
+	// the datasource that it wraps. The placeholder footers overlap each
+	// other, but the summarized ones don't.
+
+	sf1 := NewSeriesFooter1(time.Time{}, time.Time{}, 0, nil)
+	sf2 := NewSeriesFooter1(time.Time{}, time.Time{}, 0, nil)
+	sf3 := NewSeriesFooter1(time.Time{}, time.Time{}, 0, nil)
+
+	ssdw := storeSeriesDataWriter{
+		staged: map[string]storedSeries{
+			sf1.Uuid(): {
+				seriesFooter: sf1,
+				seriesDataWriter: &testSummarizerDatasource{
+					data:           TestTimeSeriesData,
+					headRecordTime: headRecordTime,
+					tailRecordTime: headRecordTime.Add(time.Second * 10),
+				},
+			},
+			sf2.Uuid(): {
+				seriesFooter: sf2,
+				seriesDataWriter: &testSummarizerDatasource{
+					data:           TestTimeSeriesData2,
+					headRecordTime: headRecordTime.Add(time.Second * 20),
+					tailRecordTime: headRecordTime.Add(time.Second * 30),
+				},
+			},
+			sf3.Uuid(): {
+				seriesFooter: sf3,
+				seriesDataWriter: &testSummarizerDatasource{
+					data:           TestTimeSeriesData2,
+					headRecordTime: headRecordTime.Add(time.Second * 5),
+					tailRecordTime: headRecordTime.Add(time.Second * 25),
+				},
+			},
+		},
+	}
+
+	b := rifs.NewSeekableBuffer()
+
+	sb := NewStreamBuilder(b)
+	sb.SetOverlapPolicy(OpReject, 0)
+
+	err := sb.AddSeries(ssdw, sf1)
+	log.PanicIf(err)
+
+	err = sb.AddSeries(ssdw, sf2)
+	log.PanicIf(err)
+
+	nextOffset := sb.NextOffset()
+
+	err = sb.AddSeries(ssdw, sf3)
+	if err == nil {
+		t.Fatalf("Expected overlap failure.")
+	} else if log.Is(err, ErrSeriesOverlap) != true {
+		log.Panic(err)
+	}
+
+	if sb.NextOffset() != nextOffset {
+		t.Fatalf("Data was written for the rejected series.")
+	}
+}
@@ -0,0 +1,278 @@
+package timetogo
+
+import (
+	"io"
+	"time"
+
+	"io/ioutil"
+
+	"github.com/dsoprea/go-logging"
+	"github.com/randomingenuity/go-utility/filesystem"
+)
+
+var (
+	cacheLogger = log.NewLogger("timetogo.cache")
+)
+
+// CachePartition identifies one series in a cache and the fingerprint of the
+// sources that it is built from (see `FingerprintFiles` and the other
+// fingerprint functions).
+type CachePartition struct {
+	// Uuid identifies the series (e.g. from `PartitionUuid`).
+	Uuid string
+
+	// Fingerprint is stored as the source SHA1 of the series. It can not be
+	// nil.
+	Fingerprint []byte
+}
+
+// CacheBuildResult is the data and summary for a rebuilt partition.
+type CacheBuildResult struct {
+	HeadRecordTime time.Time
+	TailRecordTime time.Time
+	RecordCount    uint64
+
+	// SeriesDataWriter may be an `io.Reader` or a `SeriesDataDatasourceWriter`.
+	SeriesDataWriter interface{}
+}
+
+// CacheBuildFunc loads the sources for a partition that is missing or stale.
+type CacheBuildFunc func(partition CachePartition) (result CacheBuildResult, err error)
+
+// CacheDecodeFunc decodes the data for one series. `r` only returns the data
+// for that series.
+type CacheDecodeFunc func(r io.Reader, sf SeriesFooter) (value interface{}, err error)
+
+// CacheSeries is a loaded partition.
+type CacheSeries struct {
+	SeriesFooter SeriesFooter
+	Value        interface{}
+}
+
+// cacheSeriesDataWriter provides the data for rebuilt partitions to `Updater`.
+type cacheSeriesDataWriter struct {
+	built map[string]CacheBuildResult
+}
+
+// WriteData writes the data for the rebuilt partition with the same UUID. If
+// the datasource provides a summary, it's applied. The fingerprint is kept as
+// the source SHA1 since the footer already has it.
+func (csdw cacheSeriesDataWriter) WriteData(w io.Writer, sf SeriesFooter) (n int, err error) {
+	defer func() {
+		if state := recover(); state != nil {
+			err = log.Wrap(state.(error))
+		}
+	}()
+
+	result, found := csdw.built[sf.Uuid()]
+	if found == false {
+		log.Panicf("no data built for series [%s]", sf.Uuid())
+	}
+
+	copiedCount, err := writeSeriesData(w, result.SeriesDataWriter, sf)
+	log.PanicIf(err)
+
+	applySeriesSummary(result.SeriesDataWriter, sf)
+
+	return int(copiedCount), nil
+}
+
+// cacheSeriesDataReader adapts a `CacheDecodeFunc` to
+// `SeriesDataDatasourceReader`.
+type cacheSeriesDataReader struct {
+	decode CacheDecodeFunc
+	value  interface{}
+}
+
+// ReadData decodes the series. Anything that the decoder didn't read is
+// skipped so that the whole series is accounted for.
+func (csdr *cacheSeriesDataReader) ReadData(r io.Reader, sf SeriesFooter) (n int, err error) {
+	defer func() {
+		if state := recover(); state != nil {
+			err = log.Wrap(state.(error))
+		}
+	}()
+
+	rc := rifs.NewReadCounter(r)
+
+	csdr.value, err = csdr.decode(rc, sf)
+	log.PanicIf(err)
+
+	_, err = io.Copy(ioutil.Discard, rc)
+	log.PanicIf(err)
+
+	return rc.Count(), nil
+}
+
+// Cache persists expensive-to-load data between runs. Given the current
+// partitions and the fingerprints of their sources, it rebuilds the partitions
+// that are missing or whose fingerprint has changed, drops the partitions that
+// are no longer given, and then loads all of them.
+type Cache struct {
+	rws    io.ReadWriteSeeker
+	build  CacheBuildFunc
+	decode CacheDecodeFunc
+}
+
+// NewCache returns a new `Cache` struct. If `rws` satisfies `Truncater`, it
+// will be truncated after updates.
+func NewCache(rws io.ReadWriteSeeker, build CacheBuildFunc, decode CacheDecodeFunc) *Cache {
+	return &Cache{
+		rws:    rws,
+		build:  build,
+		decode: decode,
+	}
+}
+
+// Load updates the stream to match the given partitions and returns them,
+// decoded, in the order given. The stats describe the update: the partitions
+// that were current are skips, rebuilt partitions are adds and replaces, and
+// dropped partitions are drops.
+func (cache *Cache) Load(partitions []CachePartition) (series []CacheSeries, stats UpdateStats, err error) {
+	defer func() {
+		if state := recover(); state != nil {
+			err = log.Wrap(state.(error))
+		}
+	}()
+
+	fingerprints := make(map[string][]byte)
+	for _, partition := range partitions {
+		if _, found := fingerprints[partition.Uuid]; found == true {
+			log.Panicf("partition [%s] was given more than once", partition.Uuid)
+		} else if partition.Fingerprint == nil {
+			log.Panicf("partition [%s] has no fingerprint", partition.Uuid)
+		}
+
+		fingerprints[partition.Uuid] = partition.Fingerprint
+	}
+
+	report, err := CompareFingerprints(cache.rws, fingerprints)
+	log.PanicIf(err)
+
+	if report.HasChanges() == true {
+		cacheLogger.Debugf(nil, "Updating cache: %s", report)
+
+		stats, err = cache.update(partitions)
+		log.PanicIf(err)
+	} else {
+		stats.Skips = len(partitions)
+	}
+
+	series, err = cache.read(partitions)
+	log.PanicIf(err)
+
+	return series, stats, nil
+}
+
+// update rebuilds the stale and missing partitions and drops the others.
+func (cache *Cache) update(partitions []CachePartition) (stats UpdateStats, err error) {
+	defer func() {
+		if state := recover(); state != nil {
+			err = log.Wrap(state.(error))
+		}
+	}()
+
+	existing, err := readAllSeriesFooters(cache.rws)
+	log.PanicIf(err)
+
+	fingerprints := make(map[string][]byte)
+	for _, partition := range partitions {
+		fingerprints[partition.Uuid] = partition.Fingerprint
+	}
+
+	csdw := cacheSeriesDataWriter{
+		built: make(map[string]CacheBuildResult),
+	}
+
+	updater := NewUpdater(cache.rws, csdw)
+
+	// Add the current partitions in stream order and then the new and rebuilt
+	// ones. The updater copies series forward, so retaining them out of order
+	// would overwrite series that it still has to copy. `read` restores the
+	// caller's order.
+
+	current := make(map[string]struct{})
+	for _, seriesFooter := range existing {
+		fingerprint, found := fingerprints[seriesFooter.Uuid()]
+		if found == false || string(seriesFooter.SourceSha1()) != string(fingerprint) {
+			continue
+		}
+
+		updater.AddSeries(seriesFooter)
+		current[seriesFooter.Uuid()] = struct{}{}
+	}
+
+	for _, partition := range partitions {
+		if _, found := current[partition.Uuid]; found == true {
+			continue
+		}
+
+		cacheLogger.Debugf(nil, "Rebuilding partition [%s].", partition.Uuid)
+
+		result, err := cache.build(partition)
+		log.PanicIf(err)
+
+		csdw.built[partition.Uuid] = result
+
+		seriesFooter := NewSeriesFooter1WithUuid(partition.Uuid, result.HeadRecordTime, result.TailRecordTime, result.RecordCount, partition.Fingerprint)
+		updater.AddSeries(seriesFooter)
+	}
+
+	_, stats, err = updater.Write()
+	log.PanicIf(err)
+
+	return stats, nil
+}
+
+// read decodes the given partitions.
+func (cache *Cache) read(partitions []CachePartition) (series []CacheSeries, err error) {
+	defer func() {
+		if state := recover(); state != nil {
+			err = log.Wrap(state.(error))
+		}
+	}()
+
+	series = make([]CacheSeries, 0, len(partitions))
+
+	if len(partitions) == 0 {
+		return series, nil
+	}
+
+	sr := NewStreamReader(cache.rws)
+
+	it, err := NewIterator(sr)
+	log.PanicIf(err)
+
+	byUuid := make(map[string]StreamIndexedSequenceInfo)
+	for i := 0; i < it.Count(); i++ {
+		sisi := it.SeriesInfo(i)
+		byUuid[sisi.Uuid()] = sisi
+	}
+
+	for _, partition := range partitions {
+		sisi, found := byUuid[partition.Uuid]
+		if found == false {
+			log.Panicf("partition [%s] not found in stream after update", partition.Uuid)
+		}
+
+		csdr := &cacheSeriesDataReader{
+			decode: cache.decode,
+		}
+
+		seriesFooter, _, checksumOk, err := sr.ReadSeriesWithIndexedInfo(sisi, csdr)
+		log.PanicIf(err)
+
+		if checksumOk == false {
+			log.Panic(ErrSeriesChecksumMismatch)
+		}
+
+		cs := CacheSeries{
+			SeriesFooter: seriesFooter,
+			Value:        csdr.value,
+		}
+
+		series = append(series, cs)
+	}
+
+	return series, nil
+}
@@ -0,0 +1,265 @@
+package timetogo
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"testing"
+	"time"
+
+	"io/ioutil"
+
+	"github.com/dsoprea/go-logging"
+	"github.com/randomingenuity/go-utility/filesystem"
+)
+
+type testCacheSources struct {
+	data   map[string]string
+	builds []string
+}
+
+func (tcs *testCacheSources) build(partition CachePartition) (result CacheBuildResult, err error) {
+	tcs.builds = append(tcs.builds, partition.Uuid)
+
+	headRecordTime := time.Date(2016, 10, 1, 12, 34, 56, 0, time.UTC)
+
+	result = CacheBuildResult{
+		HeadRecordTime:   headRecordTime,
+		TailRecordTime:   headRecordTime.Add(time.Minute),
+		RecordCount:      1,
+		SeriesDataWriter: bytes.NewBufferString(tcs.data[partition.Uuid]),
+	}
+
+	return result, nil
+}
+
+func (tcs *testCacheSources) partitions(uuids ...string) []CachePartition {
+	partitions := make([]CachePartition, len(uuids))
+	for i, uuid := range uuids {
+		fingerprint, err := FingerprintReaders(bytes.NewBufferString(tcs.data[uuid]))
+		log.PanicIf(err)
+
+		partitions[i] = CachePartition{
+			Uuid:        uuid,
+			Fingerprint: fingerprint,
+		}
+	}
+
+	return partitions
+}
+
+func testCacheDecode(r io.Reader, sf SeriesFooter) (value interface{}, err error) {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	return string(data), nil
+}
+
+func checkTestCacheSeries(series []CacheSeries, expected ...string) {
+	if len(series) != len(expected) {
+		log.Panicf("series count not correct: (%d)", len(series))
+	}
+
+	for i, cs := range series {
+		if cs.Value.(string) != expected[i] {
+			log.Panicf("series (%d) not correct: [%s]", i, cs.Value)
+		}
+	}
+}
+
+func TestCache_Load(t *testing.T) {
+	tcs := &testCacheSources{
+		data: map[string]string{
+			"series1": "data1",
+			"series2": "data2",
+			"series3": "data3",
+		},
+	}
+
+	rws := rifs.NewSeekableBuffer()
+	cache := NewCache(rws, tcs.build, testCacheDecode)
+
+	// Build everything.
+
+	series, stats, err := cache.Load(tcs.partitions("series1", "series2"))
+	log.PanicIf(err)
+
+	checkTestCacheSeries(series, "data1", "data2")
+
+	if stats != (UpdateStats{Adds: 2}) {
+		t.Fatalf("Initial stats not correct: %s", stats)
+	} else if fmt.Sprintf("%v", tcs.builds) != "[series1 series2]" {
+		t.Fatalf("Initial builds not correct: %v", tcs.builds)
+	}
+
+	// Nothing changed.
+
+	tcs.builds = nil
+
+	series, stats, err = cache.Load(tcs.partitions("series1", "series2"))
+	log.PanicIf(err)
+
+	checkTestCacheSeries(series, "data1", "data2")
+
+	if stats != (UpdateStats{Skips: 2}) {
+		t.Fatalf("Unchanged stats not correct: %s", stats)
+	} else if len(tcs.builds) != 0 {
+		t.Fatalf("Nothing should have been built: %v", tcs.builds)
+	}
+
+	// Change one, drop one, and add one.
+
+	tcs.builds = nil
+	tcs.data["series2"] = "data2b"
+
+	series, stats, err = cache.Load(tcs.partitions("series2", "series3"))
+	log.PanicIf(err)
+
+	checkTestCacheSeries(series, "data2b", "data3")
+
+	if stats != (UpdateStats{Adds: 1, Replaces: 1, Drops: 1}) {
+		t.Fatalf("Update stats not correct: %s", stats)
+	} else if fmt.Sprintf("%v", tcs.builds) != "[series2 series3]" {
+		t.Fatalf("Update builds not correct: %v", tcs.builds)
+	}
+
+	// Reopen the stream.
+
+	tcs.builds = nil
+
+	cache = NewCache(rifs.NewSeekableBufferWithBytes(rws.Bytes()), tcs.build, testCacheDecode)
+
+	series, _, err = cache.Load(tcs.partitions("series2", "series3"))
+	log.PanicIf(err)
+
+	checkTestCacheSeries(series, "data2b", "data3")
+
+	if len(tcs.builds) != 0 {
+		t.Fatalf("Nothing should have been built after reopening: %v", tcs.builds)
+	}
+}
+
+func TestCache_Load_ReorderAfterReplace(t *testing.T) {
+	tcs := &testCacheSources{
+		data: map[string]string{
+			"jan": "data-jan",
+			"feb": "data-feb",
+			"mar": "data-mar",
+			"apr": "data-apr",
+		},
+	}
+
+	rws := rifs.NewSeekableBuffer()
+	cache := NewCache(rws, tcs.build, testCacheDecode)
+
+	_, _, err := cache.Load(tcs.partitions("jan", "feb", "mar"))
+	log.PanicIf(err)
+
+	// Replacing the middle partition moves it to the end of the stream.
+
+	tcs.data["feb"] = "data-feb2"
+
+	_, _, err = cache.Load(tcs.partitions("jan", "feb", "mar"))
+	log.PanicIf(err)
+
+	tcs.builds = nil
+
+	series, stats, err := cache.Load(tcs.partitions("jan", "feb", "mar", "apr"))
+	log.PanicIf(err)
+
+	checkTestCacheSeries(series, "data-jan", "data-feb2", "data-mar", "data-apr")
+
+	if stats.Adds != 1 || stats.Replaces != 0 || stats.Drops != 0 {
+		t.Fatalf("Stats not correct: %s", stats)
+	} else if fmt.Sprintf("%v", tcs.builds) != "[apr]" {
+		t.Fatalf("Builds not correct: %v", tcs.builds)
+	}
+
+	// Reopen the stream.
+
+	cache = NewCache(rifs.NewSeekableBufferWithBytes(rws.Bytes()), tcs.build, testCacheDecode)
+
+	series, _, err = cache.Load(tcs.partitions("mar", "apr", "jan", "feb"))
+	log.PanicIf(err)
+
+	checkTestCacheSeries(series, "data-mar", "data-apr", "data-jan", "data-feb2")
+}
+
+func TestCache_Load_FingerprintRetained(t *testing.T) {
+	// The CSV datasource sets its own source SHA1, but the cache must keep the
+	// fingerprint or it would rebuild every time.
+
+	builds := 0
+	build := func(partition CachePartition) (result CacheBuildResult, err error) {
+		builds++
+
+		records := [][]string{
+			{"1475325300", "1.5"},
+		}
+
+		result = CacheBuildResult{
+			SeriesDataWriter: NewCsvEncoderDatasource(records, CsvTimestampColumn{}),
+		}
+
+		return result, nil
+	}
+
+	partitions := []CachePartition{
+		{Uuid: "series1", Fingerprint: []byte{11, 22, 33}},
+	}
+
+	rws := rifs.NewSeekableBuffer()
+	cache := NewCache(rws, build, testCacheDecode)
+
+	series, _, err := cache.Load(partitions)
+	log.PanicIf(err)
+
+	if bytes.Equal(series[0].SeriesFooter.SourceSha1(), []byte{11, 22, 33}) != true {
+		t.Fatalf("Fingerprint not retained: [%x]", series[0].SeriesFooter.SourceSha1())
+	} else if series[0].SeriesFooter.RecordCount() != 1 {
+		t.Fatalf("Record count not correct: (%d)", series[0].SeriesFooter.RecordCount())
+	}
+
+	_, _, err = cache.Load(partitions)
+	log.PanicIf(err)
+
+	if builds != 1 {
+		t.Fatalf("Partition was rebuilt: (%d)", builds)
+	}
+}
+
+func TestCache_Load_DuplicatePartition(t *testing.T) {
+	tcs := &testCacheSources{
+		data: map[string]string{
+			"series1": "data1",
+		},
+	}
+
+	cache := NewCache(rifs.NewSeekableBuffer(), tcs.build, testCacheDecode)
+
+	_, _, err := cache.Load(tcs.partitions("series1", "series1"))
+	if err == nil {
+		t.Fatalf("Expected failure for duplicate partition.")
+	}
+}
+
+func TestCache_Load_NilFingerprint(t *testing.T) {
+	tcs := &testCacheSources{
+		data: map[string]string{
+			"series1": "data1",
+		},
+	}
+
+	cache := NewCache(rifs.NewSeekableBuffer(), tcs.build, testCacheDecode)
+
+	partitions := []CachePartition{
+		{Uuid: "series1"},
+	}
+
+	_, _, err := cache.Load(partitions)
+	if err == nil {
+		t.Fatalf("Expected failure for partition without a fingerprint.")
+	}
+}
@@ -0,0 +1,351 @@
+package timetogo
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+
+	"hash/fnv"
+	"io/ioutil"
+	"path/filepath"
+
+	"github.com/dsoprea/go-logging"
+	"github.com/randomingenuity/go-utility/crypto"
+)
+
+var (
+	compactorLogger = log.NewLogger("timetogo.compactor")
+)
+
+var (
+	// ErrSeriesChecksumMismatch indicates that the data for a series did not
+	// match the checksum recorded in its footer while it was being copied.
+	ErrSeriesChecksumMismatch = errors.New("series checksum mismatch")
+)
+
+// Compactor rewrites a stream with its series in a new physical order. By
+// default, series are ordered by head time (then tail time, then UUID).
+// Checksums are verified as the series data is copied.
+type Compactor struct {
+	rs io.ReadSeeker
+	sr *StreamReader
+	it *Iterator
+
+	order []string
+}
+
+// NewCompactor returns a new `Compactor` struct.
+func NewCompactor(rs io.ReadSeeker) (compactor *Compactor, err error) {
+	defer func() {
+		if state := recover(); state != nil {
+			err = log.Wrap(state.(error))
+		}
+	}()
+
+	sr := NewStreamReader(rs)
+
+	it, err := NewIterator(sr)
+	if err != nil {
+		if err == io.EOF {
+			return nil, err
+		}
+
+		log.Panic(err)
+	}
+
+	compactor = &Compactor{
+		rs: rs,
+		sr: sr,
+		it: it,
+	}
+
+	return compactor, nil
+}
+
+// SetOrder sets an explicit order (by UUID) to write the series in. It must
+// include every series in the stream exactly once.
+func (compactor *Compactor) SetOrder(uuids []string) {
+	compactor.order = uuids
+}
+
+// seriesInfoInOrder returns the summary info for all of the series in the
+// order that they're to be written.
+func (compactor *Compactor) seriesInfoInOrder() (ordered []StreamIndexedSequenceInfo, err error) {
+	defer func() {
+		if state := recover(); state != nil {
+			err = log.Wrap(state.(error))
+		}
+	}()
+
+	ordered = make([]StreamIndexedSequenceInfo, compactor.it.Count())
+	for i := 0; i < compactor.it.Count(); i++ {
+		ordered[i] = compactor.it.SeriesInfo(i)
+	}
+
+	if compactor.order == nil {
+		sort.SliceStable(ordered, func(i, j int) bool {
+			a := ordered[i]
+			b := ordered[j]
+
+			if a.HeadRecordTime().Equal(b.HeadRecordTime()) == false {
+				return a.HeadRecordTime().Before(b.HeadRecordTime())
+			} else if a.TailRecordTime().Equal(b.TailRecordTime()) == false {
+				return a.TailRecordTime().Before(b.TailRecordTime())
+			}
+
+			return a.Uuid() < b.Uuid()
+		})
+
+		return ordered, nil
+	}
+
+	if len(compactor.order) != len(ordered) {
+		log.Panicf("compaction order does not have the same number of series as the stream: (%d) != (%d)", len(compactor.order), len(ordered))
+	}
+
+	byUuid := make(map[string]StreamIndexedSequenceInfo)
+	for _, sisi := range ordered {
+		byUuid[sisi.Uuid()] = sisi
+	}
+
+	for i, uuid := range compactor.order {
+		sisi, found := byUuid[uuid]
+		if found == false {
+			log.Panicf("series [%s] in compaction order is not in the stream or was given more than once", uuid)
+		}
+
+		ordered[i] = sisi
+		delete(byUuid, uuid)
+	}
+
+	return ordered, nil
+}
+
+// Write writes the compacted stream to the given destination. The destination
+// must not be the source stream.
+func (compactor *Compactor) Write(ws io.WriteSeeker) (totalSize int, err error) {
+	defer func() {
+		if state := recover(); state != nil {
+			err = log.Wrap(state.(error))
+		}
+	}()
+
+	ordered, err := compactor.seriesInfoInOrder()
+	log.PanicIf(err)
+
+	sb := NewStreamBuilder(ws)
+
+	for _, sisi := range ordered {
+		err := copySeriesVerified(compactor.sr, compactor.rs, sisi, sb, nil)
+		log.PanicIf(err)
+	}
+
+	totalSize, err = sb.Finish()
+	log.PanicIf(err)
+
+	return totalSize, nil
+}
+
+// CompactCopyBackError is returned by `CompactInPlace` when the compacted
+// stream was written but couldn't be copied back over the original. The
+// original may now be corrupt. The compacted stream is kept at `TempFilepath`
+// so that it can be recovered from.
+type CompactCopyBackError struct {
+	TempFilepath string
+	Err          error
+}
+
+func (ccbe *CompactCopyBackError) Error() string {
+	return fmt.Sprintf("copying compacted stream back failed (the original may be corrupt; the compacted stream is at [%s]): %s", ccbe.TempFilepath, ccbe.Err)
+}
+
+// CompactInPlace compacts the given stream into a temporary file and then
+// copies the result back over the original. If the stream satisfies
+// `Truncater`, it will be truncated to the new size. Otherwise, it is the
+// caller's responsibility to truncate it to the returned size. A nil order
+// sorts by head time.
+//
+// The original isn't touched until the compacted stream has been completely
+// written and verified, but if copying it back then fails partway the original
+// will be corrupt. In that case a `CompactCopyBackError` is returned and the
+// temporary file is kept. For streams that are files, `CompactFile` avoids
+// this by renaming the compacted stream into place.
+func CompactInPlace(rws io.ReadWriteSeeker, order []string) (totalSize int, err error) {
+	defer func() {
+		if state := recover(); state != nil {
+			err = log.Wrap(state.(error))
+		}
+	}()
+
+	compactor, err := NewCompactor(rws)
+	if err != nil {
+		if err == io.EOF {
+			// Nothing to compact.
+			return 0, nil
+		}
+
+		log.Panic(err)
+	}
+
+	compactor.SetOrder(order)
+
+	f, err := ioutil.TempFile("", "timetogo.compact.")
+	log.PanicIf(err)
+
+	keepTempFile := false
+
+	defer func() {
+		f.Close()
+
+		if keepTempFile == false {
+			os.Remove(f.Name())
+		}
+	}()
+
+	totalSize, err = compactor.Write(f)
+	log.PanicIf(err)
+
+	// Only now that the whole stream has been copied and verified do we
+	// touch the original.
+
+	_, err = f.Seek(0, os.SEEK_SET)
+	log.PanicIf(err)
+
+	err = copyCompactedBack(f, rws, totalSize)
+	if err != nil {
+		keepTempFile = true
+
+		ccbe := &CompactCopyBackError{
+			TempFilepath: f.Name(),
+			Err:          err,
+		}
+
+		log.Panic(ccbe)
+	}
+
+	return totalSize, nil
+}
+
+// copyCompactedBack overwrites the original stream with the compacted one.
+func copyCompactedBack(r io.Reader, rws io.ReadWriteSeeker, totalSize int) (err error) {
+	defer func() {
+		if state := recover(); state != nil {
+			err = log.Wrap(state.(error))
+		}
+	}()
+
+	_, err = rws.Seek(0, os.SEEK_SET)
+	log.PanicIf(err)
+
+	_, err = io.Copy(rws, r)
+	log.PanicIf(err)
+
+	if truncater, ok := rws.(Truncater); ok == true {
+		compactorLogger.Debugf(nil, "Underlying RWS is also a truncater. Truncating stream to right size after compaction.")
+
+		err = truncater.Truncate(int64(totalSize))
+		log.PanicIf(err)
+	}
+
+	return nil
+}
+
+// CompactFile compacts the stream file at the given path. The compacted stream
+// is written to a temporary file in the same directory, which is then renamed
+// over the original, so the original is intact if anything fails. Handles
+// that are already open on the file (including a `StreamFile`) will still see
+// the original and must be reopened. A nil order sorts by head time.
+func CompactFile(streamFilepath string, order []string) (totalSize int, err error) {
+	defer func() {
+		if state := recover(); state != nil {
+			err = log.Wrap(state.(error))
+		}
+	}()
+
+	source, err := os.Open(streamFilepath)
+	log.PanicIf(err)
+
+	defer source.Close()
+
+	fi, err := source.Stat()
+	log.PanicIf(err)
+
+	compactor, err := NewCompactor(source)
+	if err != nil {
+		if err == io.EOF {
+			// Nothing to compact.
+			return 0, nil
+		}
+
+		log.Panic(err)
+	}
+
+	compactor.SetOrder(order)
+
+	f, err := ioutil.TempFile(filepath.Dir(streamFilepath), filepath.Base(streamFilepath)+".compact.")
+	log.PanicIf(err)
+
+	renamed := false
+
+	defer func() {
+		f.Close()
+
+		if renamed == false {
+			os.Remove(f.Name())
+		}
+	}()
+
+	totalSize, err = compactor.Write(f)
+	log.PanicIf(err)
+
+	err = f.Chmod(fi.Mode())
+	log.PanicIf(err)
+
+	err = f.Sync()
+	log.PanicIf(err)
+
+	err = f.Close()
+	log.PanicIf(err)
+
+	err = os.Rename(f.Name(), streamFilepath)
+	log.PanicIf(err)
+
+	renamed = true
+
+	return totalSize, nil
+}
+
+// copySeriesVerified copies the raw data for the given series into the
+// builder, verifying the checksum as it goes. If `outputFooter` is not nil, it
+// will be written instead of the existing footer.
+func copySeriesVerified(sr *StreamReader, rs io.ReadSeeker, sisi StreamIndexedSequenceInfo, sb *StreamBuilder, outputFooter SeriesFooter) (err error) {
+	defer func() {
+		if state := recover(); state != nil {
+			err = log.Wrap(state.(error))
+		}
+	}()
+
+	seriesFooter, dataOffset, _, err := sr.ReadSeriesInfoWithIndexedInfo(sisi)
+	log.PanicIf(err)
+
+	_, err = rs.Seek(dataOffset, os.SEEK_SET)
+	log.PanicIf(err)
+
+	lr := io.LimitReader(rs, int64(seriesFooter.BytesLength()))
+	rhp := ricrypto.NewReaderHash32Proxy(lr, fnv.New32a())
+
+	if outputFooter == nil {
+		outputFooter = seriesFooter
+	}
+
+	err = sb.AddSeries(rhp, outputFooter)
+	log.PanicIf(err)
+
+	if rhp.Sum32() != seriesFooter.DataFnv1aChecksum() {
+		log.Panic(ErrSeriesChecksumMismatch)
+	}
+
+	return nil
+}
@@ -0,0 +1,264 @@
+package timetogo
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/dsoprea/go-logging"
+	"github.com/randomingenuity/go-utility/filesystem"
+)
+
+func TestCompactor_Write_ExplicitOrder(t *testing.T) {
+	raw, series, _ := WriteTestMultiseriesStream()
+
+	compactor, err := NewCompactor(bytes.NewReader(raw))
+	log.PanicIf(err)
+
+	compactor.SetOrder([]string{series[1].Uuid(), series[0].Uuid()})
+
+	b := rifs.NewSeekableBuffer()
+
+	totalSize, err := compactor.Write(b)
+	log.PanicIf(err)
+
+	if totalSize != 554 {
+		t.Fatalf("Total stream size not correct: (%d)", totalSize)
+	}
+
+	footers, data := readTestStreamSeries(b.Bytes())
+
+	if footers[0].Uuid() != series[1].Uuid() {
+		t.Fatalf("First series not correct.")
+	} else if footers[1].Uuid() != series[0].Uuid() {
+		t.Fatalf("Second series not correct.")
+	} else if bytes.Compare(data[0], TestTimeSeriesData2) != 0 {
+		t.Fatalf("First series data not correct: %v", data[0])
+	} else if bytes.Compare(data[1], TestTimeSeriesData) != 0 {
+		t.Fatalf("Second series data not correct: %v", data[1])
+	}
+}
+
+func TestCompactor_Write_BadOrder(t *testing.T) {
+	raw, series, _ := WriteTestMultiseriesStream()
+
+	compactor, err := NewCompactor(bytes.NewReader(raw))
+	log.PanicIf(err)
+
+	compactor.SetOrder([]string{series[1].Uuid(), series[1].Uuid()})
+
+	_, err = compactor.Write(rifs.NewSeekableBuffer())
+	if err == nil {
+		t.Fatalf("Expected failure for invalid order.")
+	}
+}
+
+func TestCompactInPlace_ByHeadTime(t *testing.T) {
+	raw, series, _ := WriteTestMultiseriesStream()
+
+	// Reverse the series so that they're out of chronological order.
+
+	compactor, err := NewCompactor(bytes.NewReader(raw))
+	log.PanicIf(err)
+
+	compactor.SetOrder([]string{series[1].Uuid(), series[0].Uuid()})
+
+	rws := rifs.NewSeekableBuffer()
+
+	_, err = compactor.Write(rws)
+	log.PanicIf(err)
+
+	// Now, compact in place.
+
+	totalSize, err := CompactInPlace(rws, nil)
+	log.PanicIf(err)
+
+	if totalSize != 554 {
+		t.Fatalf("Total stream size not correct: (%d)", totalSize)
+	} else if len(rws.Bytes()) != totalSize {
+		t.Fatalf("Stream not truncated: (%d)", len(rws.Bytes()))
+	}
+
+	footers, data := readTestStreamSeries(rws.Bytes())
+
+	if footers[0].Uuid() != series[0].Uuid() {
+		t.Fatalf("First series not correct.")
+	} else if footers[1].Uuid() != series[1].Uuid() {
+		t.Fatalf("Second series not correct.")
+	} else if bytes.Compare(data[0], TestTimeSeriesData) != 0 {
+		t.Fatalf("First series data not correct: %v", data[0])
+	} else if bytes.Compare(data[1], TestTimeSeriesData2) != 0 {
+		t.Fatalf("Second series data not correct: %v", data[1])
+	}
+}
+
+func TestCompactInPlace_ChecksumMismatch(t *testing.T) {
+	raw, _, _ := WriteTestMultiseriesStream()
+
+	// Corrupt the data of the first series.
+	raw[0] ^= 0xff
+
+	original := make([]byte, len(raw))
+	copy(original, raw)
+
+	rws := rifs.NewSeekableBufferWithBytes(raw)
+
+	_, err := CompactInPlace(rws, nil)
+	if err == nil {
+		t.Fatalf("Expected checksum failure.")
+	} else if log.Is(err, ErrSeriesChecksumMismatch) != true {
+		log.Panic(err)
+	}
+
+	if bytes.Compare(rws.Bytes(), original) != 0 {
+		t.Fatalf("Stream was modified despite failure.")
+	}
+}
+
+// testFailingWriteSeekBuffer fails every write after the first `failAfter`
+// bytes.
+type testFailingWriteSeekBuffer struct {
+	*rifs.SeekableBuffer
+
+	failAfter int
+	written   int
+}
+
+func (tfwsb *testFailingWriteSeekBuffer) Write(p []byte) (n int, err error) {
+	if tfwsb.written+len(p) > tfwsb.failAfter {
+		return 0, errors.New("write failed")
+	}
+
+	n, err = tfwsb.SeekableBuffer.Write(p)
+	tfwsb.written += n
+
+	return n, err
+}
+
+func TestCompactInPlace_CopyBackFailure(t *testing.T) {
+	raw, series, _ := WriteTestMultiseriesStream()
+
+	compactor, err := NewCompactor(bytes.NewReader(raw))
+	log.PanicIf(err)
+
+	compactor.SetOrder([]string{series[1].Uuid(), series[0].Uuid()})
+
+	b := rifs.NewSeekableBuffer()
+
+	_, err = compactor.Write(b)
+	log.PanicIf(err)
+
+	rws := &testFailingWriteSeekBuffer{
+		SeekableBuffer: rifs.NewSeekableBufferWithBytes(b.Bytes()),
+		failAfter:      0,
+	}
+
+	_, err = CompactInPlace(rws, nil)
+	if err == nil {
+		t.Fatalf("Expected copy-back failure.")
+	}
+
+	ccbe, ok := log.Wrap(err).Err.(*CompactCopyBackError)
+	if ok != true {
+		log.Panic(err)
+	}
+
+	defer os.Remove(ccbe.TempFilepath)
+
+	// The compacted stream can be recovered from the temporary file.
+
+	recovered, err := ioutil.ReadFile(ccbe.TempFilepath)
+	log.PanicIf(err)
+
+	footers, _ := readTestStreamSeries(recovered)
+
+	if footers[0].Uuid() != series[0].Uuid() {
+		t.Fatalf("First recovered series not correct.")
+	} else if footers[1].Uuid() != series[1].Uuid() {
+		t.Fatalf("Second recovered series not correct.")
+	}
+}
+
+func TestCompactFile(t *testing.T) {
+	raw, series, _ := WriteTestMultiseriesStream()
+
+	tempPath, err := ioutil.TempDir("", "timetogo.compactor.")
+	log.PanicIf(err)
+
+	defer os.RemoveAll(tempPath)
+
+	streamFilepath := path.Join(tempPath, "stream")
+
+	err = ioutil.WriteFile(streamFilepath, raw, 0600)
+	log.PanicIf(err)
+
+	totalSize, err := CompactFile(streamFilepath, []string{series[1].Uuid(), series[0].Uuid()})
+	log.PanicIf(err)
+
+	compacted, err := ioutil.ReadFile(streamFilepath)
+	log.PanicIf(err)
+
+	if len(compacted) != totalSize {
+		t.Fatalf("Stream size not correct: (%d) != (%d)", len(compacted), totalSize)
+	}
+
+	footers, _ := readTestStreamSeries(compacted)
+
+	if footers[0].Uuid() != series[1].Uuid() {
+		t.Fatalf("First series not correct.")
+	} else if footers[1].Uuid() != series[0].Uuid() {
+		t.Fatalf("Second series not correct.")
+	}
+
+	// Nothing should be left behind and the mode should be kept.
+
+	files, err := ioutil.ReadDir(tempPath)
+	log.PanicIf(err)
+
+	if len(files) != 1 {
+		t.Fatalf("Temporary file left behind: (%d) files", len(files))
+	} else if files[0].Mode().Perm() != 0600 {
+		t.Fatalf("Mode not kept: [%s]", files[0].Mode())
+	}
+}
+
+func TestCompactFile_ChecksumMismatch(t *testing.T) {
+	raw, _, _ := WriteTestMultiseriesStream()
+
+	// Corrupt the data of the first series.
+	raw[0] ^= 0xff
+
+	tempPath, err := ioutil.TempDir("", "timetogo.compactor.")
+	log.PanicIf(err)
+
+	defer os.RemoveAll(tempPath)
+
+	streamFilepath := path.Join(tempPath, "stream")
+
+	err = ioutil.WriteFile(streamFilepath, raw, 0644)
+	log.PanicIf(err)
+
+	_, err = CompactFile(streamFilepath, nil)
+	if err == nil {
+		t.Fatalf("Expected checksum failure.")
+	} else if log.Is(err, ErrSeriesChecksumMismatch) != true {
+		log.Panic(err)
+	}
+
+	recovered, err := ioutil.ReadFile(streamFilepath)
+	log.PanicIf(err)
+
+	if bytes.Compare(recovered, raw) != 0 {
+		t.Fatalf("Stream was modified despite failure.")
+	}
+
+	files, err := ioutil.ReadDir(tempPath)
+	log.PanicIf(err)
+
+	if len(files) != 1 {
+		t.Fatalf("Temporary file left behind: (%d) files", len(files))
+	}
+}
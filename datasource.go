@@ -2,6 +2,7 @@ package timetogo
 
 import (
     "io"
+    "time"
 
     "encoding/gob"
 
@@ -19,6 +20,38 @@ type SeriesDataDatasourceWriter interface {
     WriteData(w io.Writer, sf SeriesFooter) (n int, err error)
 }
 
+// SeriesDataDatasourceSummarizer may optionally be implemented by a
+// `SeriesDataDatasourceWriter` that only learns the head and tail times, record
+// count, and source SHA1 while it is encoding. It is called after `WriteData`
+// and the values are set on the footer before the footer is written. A source
+// SHA1 that the caller already set on the footer is kept since `Updater` uses
+// it to recognize a series that hasn't changed. Overlap policies are applied
+// to the footer once the summary has been set.
+type SeriesDataDatasourceSummarizer interface {
+    SeriesSummary() (headRecordTime, tailRecordTime time.Time, recordCount uint64, sourceSha1 []byte)
+}
+
+// applySeriesSummary sets the summary from the datasource on the footer if the
+// datasource provides one. The source SHA1 is only set if the footer doesn't
+// already have one. Returns true if the summary was applied.
+func applySeriesSummary(seriesDataWriter interface{}, sf SeriesFooter) bool {
+    sdds, ok := seriesDataWriter.(SeriesDataDatasourceSummarizer)
+    if ok == false {
+        return false
+    }
+
+    headRecordTime, tailRecordTime, recordCount, sourceSha1 := sdds.SeriesSummary()
+
+    if sf.SourceSha1() != nil {
+        sourceSha1 = sf.SourceSha1()
+    }
+
+    err := setRecordSummary(sf, headRecordTime, tailRecordTime, recordCount, sourceSha1)
+    log.PanicIf(err)
+
+    return true
+}
+
 // SeriesDataDatasourceWriterWrapper wraps a simple `io.Reader` and satisfies
 // the `SeriesDataDatasourceWriter` interface. It essentially converts a reader
 // to a writer. This may not have a practical use, but we use it for testing.
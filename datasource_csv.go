@@ -0,0 +1,277 @@
+package timetogo
+
+import (
+	"crypto/sha1"
+	"io"
+	"strconv"
+	"time"
+
+	"encoding/csv"
+	"io/ioutil"
+
+	"github.com/dsoprea/go-logging"
+	"github.com/randomingenuity/go-utility/filesystem"
+)
+
+// CsvTimestampColumn describes which column of a CSV record has the timestamp
+// and how it is formatted.
+type CsvTimestampColumn struct {
+	// Index is the zero-based index of the column.
+	Index int
+
+	// Layout is a `time.Parse` layout. If empty, the column is an integer
+	// number of seconds since the epoch.
+	Layout string
+
+	// Location is the time-zone that timestamps without one are in. If nil,
+	// UTC is used.
+	Location *time.Location
+}
+
+// Parse returns the timestamp from the given record.
+func (ctc CsvTimestampColumn) Parse(record []string) (timestamp time.Time, err error) {
+	defer func() {
+		if state := recover(); state != nil {
+			err = log.Wrap(state.(error))
+		}
+	}()
+
+	if ctc.Index < 0 || ctc.Index >= len(record) {
+		log.Panicf("timestamp column (%d) not in record with (%d) columns", ctc.Index, len(record))
+	}
+
+	raw := record[ctc.Index]
+
+	if ctc.Layout == "" {
+		epoch, err := strconv.ParseInt(raw, 10, 64)
+		log.PanicIf(err)
+
+		return time.Unix(epoch, 0).UTC(), nil
+	}
+
+	location := ctc.Location
+	if location == nil {
+		location = time.UTC
+	}
+
+	timestamp, err = time.ParseInLocation(ctc.Layout, raw, location)
+	log.PanicIf(err)
+
+	return timestamp, nil
+}
+
+// >>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>
+// CSV encoder that derives the series-footer fields
+// <<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<
+
+// CsvEncoderDatasource encodes records as CSV and satisfies
+// `SeriesDataDatasourceWriter`. While encoding, it determines the head and tail
+// times (the earliest and latest timestamps), the record count, and the SHA1
+// of the encoded records. These are provided via `SeriesSummary`, and the
+// builder sets them on the series footer before the footer is written.
+type CsvEncoderDatasource struct {
+	records         [][]string
+	timestampColumn CsvTimestampColumn
+
+	headRecordTime time.Time
+	tailRecordTime time.Time
+	sourceSha1     []byte
+}
+
+// NewCsvEncoderDatasource returns a new `CsvEncoderDatasource` struct. There
+// must be at least one record.
+func NewCsvEncoderDatasource(records [][]string, timestampColumn CsvTimestampColumn) *CsvEncoderDatasource {
+	return &CsvEncoderDatasource{
+		records:         records,
+		timestampColumn: timestampColumn,
+	}
+}
+
+// encode writes the records to the given writer and returns their summary.
+func (ced *CsvEncoderDatasource) encode(w io.Writer) (headRecordTime, tailRecordTime time.Time, sourceSha1 []byte, err error) {
+	defer func() {
+		if state := recover(); state != nil {
+			err = log.Wrap(state.(error))
+		}
+	}()
+
+	if len(ced.records) == 0 {
+		log.Panicf("no CSV records to encode")
+	}
+
+	h := sha1.New()
+	cw := csv.NewWriter(io.MultiWriter(w, h))
+
+	for i, record := range ced.records {
+		timestamp, err := ced.timestampColumn.Parse(record)
+		log.PanicIf(err)
+
+		if i == 0 || timestamp.Before(headRecordTime) == true {
+			headRecordTime = timestamp
+		}
+
+		if i == 0 || timestamp.After(tailRecordTime) == true {
+			tailRecordTime = timestamp
+		}
+
+		err = cw.Write(record)
+		log.PanicIf(err)
+	}
+
+	cw.Flush()
+
+	err = cw.Error()
+	log.PanicIf(err)
+
+	return headRecordTime, tailRecordTime, h.Sum(nil), nil
+}
+
+// NewSeriesFooter returns a new series footer with the fields derived from the
+// records. This is needed when the footer has to be known before the data is
+// written (e.g. to let `Updater` determine whether the series has changed).
+func (ced *CsvEncoderDatasource) NewSeriesFooter() (sf *SeriesFooter1, err error) {
+	defer func() {
+		if state := recover(); state != nil {
+			err = log.Wrap(state.(error))
+		}
+	}()
+
+	headRecordTime, tailRecordTime, sourceSha1, err := ced.encode(ioutil.Discard)
+	log.PanicIf(err)
+
+	sf = NewSeriesFooter1(headRecordTime, tailRecordTime, uint64(len(ced.records)), sourceSha1)
+
+	return sf, nil
+}
+
+// WriteData is called when series data needs to be written. It encodes the
+// records and keeps the fields derived from them for `SeriesSummary`.
+func (ced *CsvEncoderDatasource) WriteData(w io.Writer, sf SeriesFooter) (n int, err error) {
+	defer func() {
+		if state := recover(); state != nil {
+			err = log.Wrap(state.(error))
+		}
+	}()
+
+	wc := rifs.NewWriteCounter(w)
+
+	headRecordTime, tailRecordTime, sourceSha1, err := ced.encode(wc)
+	log.PanicIf(err)
+
+	ced.headRecordTime = headRecordTime
+	ced.tailRecordTime = tailRecordTime
+	ced.sourceSha1 = sourceSha1
+
+	return wc.Count(), nil
+}
+
+// SeriesSummary returns the head and tail times, record count, and source SHA1
+// derived by the last `WriteData` call. This satisfies
+// `SeriesDataDatasourceSummarizer`.
+func (ced *CsvEncoderDatasource) SeriesSummary() (headRecordTime, tailRecordTime time.Time, recordCount uint64, sourceSha1 []byte) {
+	return ced.headRecordTime, ced.tailRecordTime, uint64(len(ced.records)), ced.sourceSha1
+}
+
+// >>>>>>>>>>>>>>>>>>>>>>>>>>>
+// CSV decoder with typed rows
+// <<<<<<<<<<<<<<<<<<<<<<<<<<<
+
+// CsvRow is one decoded CSV record.
+type CsvRow struct {
+	// Timestamp is the parsed timestamp column.
+	Timestamp time.Time
+
+	// Fields are all of the columns in the record, including the timestamp.
+	Fields []string
+}
+
+// Int64 returns the given column as an integer.
+func (cr CsvRow) Int64(i int) (value int64, err error) {
+	defer func() {
+		if state := recover(); state != nil {
+			err = log.Wrap(state.(error))
+		}
+	}()
+
+	value, err = strconv.ParseInt(cr.field(i), 10, 64)
+	log.PanicIf(err)
+
+	return value, nil
+}
+
+// Float64 returns the given column as a float.
+func (cr CsvRow) Float64(i int) (value float64, err error) {
+	defer func() {
+		if state := recover(); state != nil {
+			err = log.Wrap(state.(error))
+		}
+	}()
+
+	value, err = strconv.ParseFloat(cr.field(i), 64)
+	log.PanicIf(err)
+
+	return value, nil
+}
+
+func (cr CsvRow) field(i int) string {
+	if i < 0 || i >= len(cr.Fields) {
+		log.Panicf("column (%d) not in record with (%d) columns", i, len(cr.Fields))
+	}
+
+	return cr.Fields[i]
+}
+
+// CsvRowCallback receives each row as it is decoded.
+type CsvRowCallback func(row CsvRow) (err error)
+
+// CsvDecoderDatasource decodes CSV series-data and passes each row to a
+// callback. It satisfies `SeriesDataDatasourceReader`.
+type CsvDecoderDatasource struct {
+	timestampColumn CsvTimestampColumn
+	cb              CsvRowCallback
+}
+
+// NewCsvDecoderDatasource returns a new `CsvDecoderDatasource` struct.
+func NewCsvDecoderDatasource(timestampColumn CsvTimestampColumn, cb CsvRowCallback) *CsvDecoderDatasource {
+	return &CsvDecoderDatasource{
+		timestampColumn: timestampColumn,
+		cb:              cb,
+	}
+}
+
+// ReadData is called when series data needs to be read and decodes each
+// record in turn.
+func (cdd *CsvDecoderDatasource) ReadData(r io.Reader, sf SeriesFooter) (n int, err error) {
+	defer func() {
+		if state := recover(); state != nil {
+			err = log.Wrap(state.(error))
+		}
+	}()
+
+	rc := rifs.NewReadCounter(r)
+	cr := csv.NewReader(rc)
+
+	for {
+		record, err := cr.Read()
+		if err != nil {
+			if err == io.EOF {
+				break
+			}
+
+			log.Panic(err)
+		}
+
+		timestamp, err := cdd.timestampColumn.Parse(record)
+		log.PanicIf(err)
+
+		row := CsvRow{
+			Timestamp: timestamp,
+			Fields:    record,
+		}
+
+		err = cdd.cb(row)
+		log.PanicIf(err)
+	}
+
+	return rc.Count(), nil
+}
@@ -0,0 +1,163 @@
+package timetogo
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+	"time"
+
+	"crypto/sha1"
+
+	"github.com/dsoprea/go-logging"
+	"github.com/randomingenuity/go-utility/filesystem"
+)
+
+var (
+	testCsvRecords = [][]string{
+		{"sensor1", "1475325300", "1.5"},
+		{"sensor1", "1475325296", "2.5"},
+		{"sensor1", "1475325310", "3.5"},
+	}
+
+	testCsvTimestampColumn = CsvTimestampColumn{
+		Index: 1,
+	}
+)
+
+func TestCsvTimestampColumn_Parse_Layout(t *testing.T) {
+	ctc := CsvTimestampColumn{
+		Index:  0,
+		Layout: "2006-01-02 15:04:05",
+	}
+
+	timestamp, err := ctc.Parse([]string{"2016-10-01 12:34:56"})
+	log.PanicIf(err)
+
+	expected := time.Date(2016, 10, 1, 12, 34, 56, 0, time.UTC)
+	if timestamp.Equal(expected) != true {
+		t.Fatalf("Timestamp not correct: [%s]", timestamp)
+	}
+
+	_, err = ctc.Parse([]string{})
+	if err == nil {
+		t.Fatalf("Expected failure for missing column.")
+	}
+}
+
+func TestCsvDatasource(t *testing.T) {
+	sb := rifs.NewSeekableBuffer()
+	streamBuilder := NewStreamBuilder(sb)
+
+	ced := NewCsvEncoderDatasource(testCsvRecords, testCsvTimestampColumn)
+
+	// The fields are populated when the data is written.
+
+	seriesFooter := NewSeriesFooter1(time.Time{}, time.Time{}, 0, nil)
+
+	err := streamBuilder.AddSeries(ced, seriesFooter)
+	log.PanicIf(err)
+
+	_, err = streamBuilder.Finish()
+	log.PanicIf(err)
+
+	encoded := "sensor1,1475325300,1.5\nsensor1,1475325296,2.5\nsensor1,1475325310,3.5\n"
+	expectedSha1 := sha1.Sum([]byte(encoded))
+
+	sr := NewStreamReader(sb)
+
+	it, err := NewIterator(sr)
+	log.PanicIf(err)
+
+	sisi := it.SeriesInfo(0)
+
+	if sisi.HeadRecordTime() != time.Unix(1475325296, 0).UTC() {
+		t.Fatalf("Indexed head time not correct: [%s]", sisi.HeadRecordTime())
+	} else if sisi.TailRecordTime() != time.Unix(1475325310, 0).UTC() {
+		t.Fatalf("Indexed tail time not correct: [%s]", sisi.TailRecordTime())
+	}
+
+	rows := make([]CsvRow, 0)
+	cb := func(row CsvRow) (err error) {
+		rows = append(rows, row)
+		return nil
+	}
+
+	recoveredSeriesFooter, _, checksumOk, err := sr.ReadSeriesWithIndexedInfo(sisi, NewCsvDecoderDatasource(testCsvTimestampColumn, cb))
+	log.PanicIf(err)
+
+	if checksumOk != true {
+		t.Fatalf("Checksum not correct.")
+	} else if recoveredSeriesFooter.RecordCount() != 3 {
+		t.Fatalf("Record count not correct: (%d)", recoveredSeriesFooter.RecordCount())
+	} else if bytes.Equal(recoveredSeriesFooter.SourceSha1(), expectedSha1[:]) != true {
+		t.Fatalf("Source SHA1 not correct: [%x]", recoveredSeriesFooter.SourceSha1())
+	} else if recoveredSeriesFooter.BytesLength() != uint64(len(encoded)) {
+		t.Fatalf("Bytes-length not correct: (%d)", recoveredSeriesFooter.BytesLength())
+	}
+
+	if len(rows) != 3 {
+		t.Fatalf("Row count not correct: (%d)", len(rows))
+	}
+
+	for i, row := range rows {
+		if reflect.DeepEqual(row.Fields, testCsvRecords[i]) != true {
+			t.Fatalf("Row (%d) not correct: %v", i, row.Fields)
+		}
+	}
+
+	if rows[1].Timestamp != time.Unix(1475325296, 0).UTC() {
+		t.Fatalf("Row timestamp not correct: [%s]", rows[1].Timestamp)
+	}
+
+	value, err := rows[2].Float64(2)
+	log.PanicIf(err)
+
+	if value != 3.5 {
+		t.Fatalf("Float value not correct: (%f)", value)
+	}
+
+	epoch, err := rows[0].Int64(1)
+	log.PanicIf(err)
+
+	if epoch != 1475325300 {
+		t.Fatalf("Integer value not correct: (%d)", epoch)
+	}
+
+	_, err = rows[0].Int64(3)
+	if err == nil {
+		t.Fatalf("Expected failure for missing column.")
+	}
+}
+
+func TestCsvEncoderDatasource_NewSeriesFooter(t *testing.T) {
+	ced := NewCsvEncoderDatasource(testCsvRecords, testCsvTimestampColumn)
+
+	sf, err := ced.NewSeriesFooter()
+	log.PanicIf(err)
+
+	b := new(bytes.Buffer)
+
+	_, err = ced.WriteData(b, NewSeriesFooter1(time.Time{}, time.Time{}, 0, nil))
+	log.PanicIf(err)
+
+	headRecordTime, tailRecordTime, recordCount, sourceSha1 := ced.SeriesSummary()
+
+	if sf.HeadRecordTime().Equal(headRecordTime) != true {
+		t.Fatalf("Head time not correct: [%s]", sf.HeadRecordTime())
+	} else if sf.TailRecordTime().Equal(tailRecordTime) != true {
+		t.Fatalf("Tail time not correct: [%s]", sf.TailRecordTime())
+	} else if sf.RecordCount() != recordCount {
+		t.Fatalf("Record count not correct: (%d)", sf.RecordCount())
+	} else if bytes.Equal(sf.SourceSha1(), sourceSha1) != true {
+		t.Fatalf("Source SHA1 not correct: [%x]", sf.SourceSha1())
+	}
+}
+
+func TestCsvEncoderDatasource_NoRecords(t *testing.T) {
+	ced := NewCsvEncoderDatasource([][]string{}, testCsvTimestampColumn)
+
+	_, err := ced.WriteData(new(bytes.Buffer), NewSeriesFooter1(time.Time{}, time.Time{}, 0, nil))
+	if err == nil {
+		t.Fatalf("Expected failure for no records.")
+	}
+}
@@ -0,0 +1,162 @@
+package timetogo
+
+import (
+	"io"
+
+	"encoding/gob"
+
+	"github.com/dsoprea/go-logging"
+	"github.com/randomingenuity/go-utility/filesystem"
+)
+
+// >>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>
+// gob encoder/decoder record streaming
+// <<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<
+
+// GobRecordSource returns the next record to encode. It returns `io.EOF` when
+// there are no more records.
+type GobRecordSource func() (record interface{}, err error)
+
+// GobRecordEncoderDatasource encodes records one at a time, with one
+// `gob.Encoder` shared across all of them (so the type information is only
+// written once). It satisfies `SeriesDataDatasourceWriter`. The records are
+// never all in memory at the same time.
+type GobRecordEncoderDatasource struct {
+	source GobRecordSource
+}
+
+// NewGobRecordEncoderDatasource returns a new `GobRecordEncoderDatasource`
+// struct that encodes the records from the given source.
+func NewGobRecordEncoderDatasource(source GobRecordSource) *GobRecordEncoderDatasource {
+	return &GobRecordEncoderDatasource{
+		source: source,
+	}
+}
+
+// NewGobRecordEncoderDatasourceFromChannel returns a new
+// `GobRecordEncoderDatasource` struct that encodes the records received from
+// the given channel until it is closed.
+func NewGobRecordEncoderDatasourceFromChannel(records <-chan interface{}) *GobRecordEncoderDatasource {
+	source := func() (record interface{}, err error) {
+		record, ok := <-records
+		if ok == false {
+			return nil, io.EOF
+		}
+
+		return record, nil
+	}
+
+	return NewGobRecordEncoderDatasource(source)
+}
+
+// WriteData is called when series data needs to be written and encodes each
+// record as it is produced.
+func (gred *GobRecordEncoderDatasource) WriteData(w io.Writer, sf SeriesFooter) (n int, err error) {
+	defer func() {
+		if state := recover(); state != nil {
+			err = log.Wrap(state.(error))
+		}
+	}()
+
+	wc := rifs.NewWriteCounter(w)
+	e := gob.NewEncoder(wc)
+
+	for {
+		record, err := gred.source()
+		if err != nil {
+			if err == io.EOF {
+				break
+			}
+
+			log.Panic(err)
+		}
+
+		err = e.Encode(record)
+		log.PanicIf(err)
+	}
+
+	return wc.Count(), nil
+}
+
+// GobRecordCallback receives each record as it is decoded.
+type GobRecordCallback func(record interface{}) (err error)
+
+// GobRecordDecoderDatasource decodes records one at a time and passes each to
+// a callback. It satisfies `SeriesDataDatasourceReader`.
+type GobRecordDecoderDatasource struct {
+	newRecord func() interface{}
+	cb        GobRecordCallback
+}
+
+// NewGobRecordDecoderDatasource returns a new `GobRecordDecoderDatasource`
+// struct. `newRecord` returns a pointer to decode the next record into.
+func NewGobRecordDecoderDatasource(newRecord func() interface{}, cb GobRecordCallback) *GobRecordDecoderDatasource {
+	return &GobRecordDecoderDatasource{
+		newRecord: newRecord,
+		cb:        cb,
+	}
+}
+
+// ReadData is called when series data needs to be read and decodes each
+// record in turn.
+func (grdd *GobRecordDecoderDatasource) ReadData(r io.Reader, sf SeriesFooter) (n int, err error) {
+	defer func() {
+		if state := recover(); state != nil {
+			err = log.Wrap(state.(error))
+		}
+	}()
+
+	rc := rifs.NewReadCounter(r)
+	d := gob.NewDecoder(rc)
+
+	for {
+		record := grdd.newRecord()
+
+		err := d.Decode(record)
+		if err != nil {
+			if err == io.EOF {
+				break
+			}
+
+			log.Panic(err)
+		}
+
+		err = grdd.cb(record)
+		log.PanicIf(err)
+	}
+
+	return rc.Count(), nil
+}
+
+// GobRecordIterator decodes the records in one series on demand. The series
+// is read in the background as the records are consumed.
+type GobRecordIterator struct {
+	sdp *seriesDataPipe
+	d   *gob.Decoder
+}
+
+// NewGobRecordIterator returns a new `GobRecordIterator` struct for the given
+// series. The `StreamReader` must not be used for anything else until the
+// iterator has returned `io.EOF` or has been closed.
+func NewGobRecordIterator(sr *StreamReader, sisi StreamIndexedSequenceInfo) *GobRecordIterator {
+	sdp := newSeriesDataPipe(sr, sisi)
+
+	return &GobRecordIterator{
+		sdp: sdp,
+		d:   gob.NewDecoder(sdp),
+	}
+}
+
+// Next decodes the next record into the given pointer. It returns `io.EOF`
+// after the last record. If the series fails its checksum,
+// `ErrSeriesChecksumMismatch` is returned once all of the records have been
+// read.
+func (gri *GobRecordIterator) Next(record interface{}) (err error) {
+	return gri.d.Decode(record)
+}
+
+// Close stops reading the series. It must be called if the iterator is
+// abandoned before it returns `io.EOF`.
+func (gri *GobRecordIterator) Close() (err error) {
+	return gri.sdp.Close()
+}
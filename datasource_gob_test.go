@@ -0,0 +1,161 @@
+package timetogo
+
+import (
+	"io"
+	"testing"
+	"time"
+
+	"github.com/dsoprea/go-logging"
+	"github.com/randomingenuity/go-utility/filesystem"
+)
+
+type testGobRecord struct {
+	Timestamp int64
+	Value     float64
+}
+
+func writeTestGobRecordStream(recordCount int) (sb *rifs.SeekableBuffer) {
+	sb = rifs.NewSeekableBuffer()
+	streamBuilder := NewStreamBuilder(sb)
+
+	records := make(chan interface{})
+
+	go func() {
+		for i := 0; i < recordCount; i++ {
+			records <- testGobRecord{Timestamp: int64(i), Value: float64(i) / 2}
+		}
+
+		close(records)
+	}()
+
+	headRecordTime := time.Date(2016, 10, 1, 12, 34, 56, 0, time.UTC)
+	seriesFooter := NewSeriesFooter1(headRecordTime, headRecordTime.Add(time.Second*time.Duration(recordCount)), uint64(recordCount), []byte{11, 22, 33})
+
+	err := streamBuilder.AddSeries(NewGobRecordEncoderDatasourceFromChannel(records), seriesFooter)
+	log.PanicIf(err)
+
+	_, err = streamBuilder.Finish()
+	log.PanicIf(err)
+
+	return sb
+}
+
+func TestGobRecordDatasource(t *testing.T) {
+	sb := writeTestGobRecordStream(1000)
+
+	sr := NewStreamReader(sb)
+
+	it, err := NewIterator(sr)
+	log.PanicIf(err)
+
+	i := 0
+	cb := func(record interface{}) (err error) {
+		tgr := record.(*testGobRecord)
+
+		if tgr.Timestamp != int64(i) || tgr.Value != float64(i)/2 {
+			t.Fatalf("Record (%d) not correct: %v", i, tgr)
+		}
+
+		i++
+
+		return nil
+	}
+
+	newRecord := func() interface{} {
+		return new(testGobRecord)
+	}
+
+	_, _, checksumOk, err := sr.ReadSeriesWithIndexedInfo(it.SeriesInfo(0), NewGobRecordDecoderDatasource(newRecord, cb))
+	log.PanicIf(err)
+
+	if checksumOk != true {
+		t.Fatalf("Checksum not correct.")
+	} else if i != 1000 {
+		t.Fatalf("Record count not correct: (%d)", i)
+	}
+}
+
+func TestGobRecordEncoderDatasource_Source(t *testing.T) {
+	i := 0
+	source := func() (record interface{}, err error) {
+		if i == 3 {
+			return nil, io.EOF
+		}
+
+		i++
+
+		return testGobRecord{Timestamp: int64(i)}, nil
+	}
+
+	sb := rifs.NewSeekableBuffer()
+
+	n, err := NewGobRecordEncoderDatasource(source).WriteData(sb, nil)
+	log.PanicIf(err)
+
+	if n != len(sb.Bytes()) {
+		t.Fatalf("Count not correct: (%d) != (%d)", n, len(sb.Bytes()))
+	}
+}
+
+func TestGobRecordIterator(t *testing.T) {
+	sb := writeTestGobRecordStream(1000)
+
+	sr := NewStreamReader(sb)
+
+	it, err := NewIterator(sr)
+	log.PanicIf(err)
+
+	gri := NewGobRecordIterator(sr, it.SeriesInfo(0))
+
+	i := 0
+	for {
+		var tgr testGobRecord
+
+		err := gri.Next(&tgr)
+		if err == io.EOF {
+			break
+		}
+
+		log.PanicIf(err)
+
+		if tgr.Timestamp != int64(i) || tgr.Value != float64(i)/2 {
+			t.Fatalf("Record (%d) not correct: %v", i, tgr)
+		}
+
+		i++
+	}
+
+	if i != 1000 {
+		t.Fatalf("Record count not correct: (%d)", i)
+	}
+}
+
+func TestGobRecordIterator_Close(t *testing.T) {
+	sb := writeTestGobRecordStream(1000)
+
+	sr := NewStreamReader(sb)
+
+	it, err := NewIterator(sr)
+	log.PanicIf(err)
+
+	gri := NewGobRecordIterator(sr, it.SeriesInfo(0))
+
+	var tgr testGobRecord
+
+	err = gri.Next(&tgr)
+	log.PanicIf(err)
+
+	// Abandon the series. This must not block.
+
+	err = gri.Close()
+	log.PanicIf(err)
+
+	// The reader can be used again.
+
+	_, _, checksumOk, err := sr.ReadSeriesWithIndexedInfo(it.SeriesInfo(0), nil)
+	log.PanicIf(err)
+
+	if checksumOk != true {
+		t.Fatalf("Checksum not correct.")
+	}
+}
@@ -0,0 +1,322 @@
+package timetogo
+
+import (
+	"errors"
+	"io"
+	"reflect"
+
+	"encoding/json"
+	"io/ioutil"
+
+	"github.com/dsoprea/go-logging"
+	"github.com/randomingenuity/go-utility/filesystem"
+)
+
+var (
+	// ErrJsonTrailingData indicates that there was more than one value in
+	// series-data that should have only had one.
+	ErrJsonTrailingData = errors.New("series data has data after the JSON value")
+)
+
+// drainJsonDecoder fails if there is another value and otherwise consumes the
+// remainder of the series-data (which the JSON decoder may not have needed to
+// read) so that the byte-count covers the whole series.
+func drainJsonDecoder(d *json.Decoder, r io.Reader) (err error) {
+	defer func() {
+		if state := recover(); state != nil {
+			err = log.Wrap(state.(error))
+		}
+	}()
+
+	if d.More() == true {
+		log.Panic(ErrJsonTrailingData)
+	}
+
+	_, err = io.Copy(ioutil.Discard, r)
+	log.PanicIf(err)
+
+	return nil
+}
+
+// >>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>
+// JSON encoder/decoder single-object wrapper
+// <<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<
+
+// JsonSingleObjectDecoderDatasource wraps a `json.Decoder` as a
+// `SeriesDataDatasourceReader`.
+type JsonSingleObjectDecoderDatasource struct {
+	outputValue interface{}
+}
+
+// NewJsonSingleObjectDecoderDatasource returns a new
+// `JsonSingleObjectDecoderDatasource` struct.
+func NewJsonSingleObjectDecoderDatasource(outputValue interface{}) *JsonSingleObjectDecoderDatasource {
+	return &JsonSingleObjectDecoderDatasource{
+		outputValue: outputValue,
+	}
+}
+
+// ReadData is called when series data needs to be read and decodes the raw
+// series-data into the value that we were initialized with.
+func (jdd *JsonSingleObjectDecoderDatasource) ReadData(r io.Reader, sf SeriesFooter) (n int, err error) {
+	defer func() {
+		if state := recover(); state != nil {
+			err = log.Wrap(state.(error))
+		}
+	}()
+
+	rc := rifs.NewReadCounter(r)
+	d := json.NewDecoder(rc)
+
+	err = d.Decode(jdd.outputValue)
+	log.PanicIf(err)
+
+	err = drainJsonDecoder(d, rc)
+	log.PanicIf(err)
+
+	return rc.Count(), nil
+}
+
+// JsonSingleObjectEncoderDatasource wraps a `json.Encoder` as a
+// `SeriesDataDatasourceWriter`.
+type JsonSingleObjectEncoderDatasource struct {
+	inputValue interface{}
+}
+
+// NewJsonSingleObjectEncoderDatasource returns a new
+// `JsonSingleObjectEncoderDatasource` struct.
+func NewJsonSingleObjectEncoderDatasource(inputValue interface{}) *JsonSingleObjectEncoderDatasource {
+	return &JsonSingleObjectEncoderDatasource{
+		inputValue: inputValue,
+	}
+}
+
+// WriteData is called when series data needs to be written and encodes the
+// value that we were initialized with into the writer we are given.
+func (jed JsonSingleObjectEncoderDatasource) WriteData(w io.Writer, sf SeriesFooter) (n int, err error) {
+	defer func() {
+		if state := recover(); state != nil {
+			err = log.Wrap(state.(error))
+		}
+	}()
+
+	wc := rifs.NewWriteCounter(w)
+	e := json.NewEncoder(wc)
+
+	err = e.Encode(jed.inputValue)
+	log.PanicIf(err)
+
+	return wc.Count(), nil
+}
+
+// >>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>
+// JSON-lines encoder/decoder record streaming
+// <<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<
+
+// JsonLinesRecordSource returns the next record to encode. It returns
+// `io.EOF` when there are no more records.
+type JsonLinesRecordSource func() (record interface{}, err error)
+
+// JsonLinesRecordEncoderDatasource encodes records one at a time as JSON, one
+// record per line. It satisfies `SeriesDataDatasourceWriter`. The records are
+// never all in memory at the same time.
+type JsonLinesRecordEncoderDatasource struct {
+	source JsonLinesRecordSource
+}
+
+// NewJsonLinesRecordEncoderDatasource returns a new
+// `JsonLinesRecordEncoderDatasource` struct that encodes the records from the
+// given source.
+func NewJsonLinesRecordEncoderDatasource(source JsonLinesRecordSource) *JsonLinesRecordEncoderDatasource {
+	return &JsonLinesRecordEncoderDatasource{
+		source: source,
+	}
+}
+
+// WriteData is called when series data needs to be written and encodes each
+// record, on its own line, as it is produced.
+func (jlred *JsonLinesRecordEncoderDatasource) WriteData(w io.Writer, sf SeriesFooter) (n int, err error) {
+	defer func() {
+		if state := recover(); state != nil {
+			err = log.Wrap(state.(error))
+		}
+	}()
+
+	wc := rifs.NewWriteCounter(w)
+	e := json.NewEncoder(wc)
+
+	for {
+		record, err := jlred.source()
+		if err != nil {
+			if err == io.EOF {
+				break
+			}
+
+			log.Panic(err)
+		}
+
+		err = e.Encode(record)
+		log.PanicIf(err)
+	}
+
+	return wc.Count(), nil
+}
+
+// JsonLinesRecordCallback receives each record as it is decoded.
+type JsonLinesRecordCallback func(record interface{}) (err error)
+
+// JsonLinesRecordDecoderDatasource decodes series-data that has one JSON
+// record per line, one record at a time, and passes each to a callback. It
+// satisfies `SeriesDataDatasourceReader`.
+type JsonLinesRecordDecoderDatasource struct {
+	newRecord func() interface{}
+	cb        JsonLinesRecordCallback
+}
+
+// NewJsonLinesRecordDecoderDatasource returns a new
+// `JsonLinesRecordDecoderDatasource` struct. `newRecord` returns a pointer to
+// decode the next record into.
+func NewJsonLinesRecordDecoderDatasource(newRecord func() interface{}, cb JsonLinesRecordCallback) *JsonLinesRecordDecoderDatasource {
+	return &JsonLinesRecordDecoderDatasource{
+		newRecord: newRecord,
+		cb:        cb,
+	}
+}
+
+// ReadData is called when series data needs to be read and decodes each
+// record in turn.
+func (jlrdd *JsonLinesRecordDecoderDatasource) ReadData(r io.Reader, sf SeriesFooter) (n int, err error) {
+	defer func() {
+		if state := recover(); state != nil {
+			err = log.Wrap(state.(error))
+		}
+	}()
+
+	rc := rifs.NewReadCounter(r)
+	d := json.NewDecoder(rc)
+
+	for {
+		record := jlrdd.newRecord()
+
+		err := d.Decode(record)
+		if err != nil {
+			if err == io.EOF {
+				break
+			}
+
+			log.Panic(err)
+		}
+
+		err = jlrdd.cb(record)
+		log.PanicIf(err)
+	}
+
+	return rc.Count(), nil
+}
+
+// JsonLinesRecordIterator decodes the records in one JSON-lines series on
+// demand. The series is read in the background as the records are consumed.
+type JsonLinesRecordIterator struct {
+	sdp *seriesDataPipe
+	d   *json.Decoder
+}
+
+// NewJsonLinesRecordIterator returns a new `JsonLinesRecordIterator` struct
+// for the given series. The `StreamReader` must not be used for anything else
+// until the iterator has returned `io.EOF` or has been closed.
+func NewJsonLinesRecordIterator(sr *StreamReader, sisi StreamIndexedSequenceInfo) *JsonLinesRecordIterator {
+	sdp := newSeriesDataPipe(sr, sisi)
+
+	return &JsonLinesRecordIterator{
+		sdp: sdp,
+		d:   json.NewDecoder(sdp),
+	}
+}
+
+// Next decodes the next record into the given pointer. It returns `io.EOF`
+// after the last record. If the series fails its checksum,
+// `ErrSeriesChecksumMismatch` is returned once all of the records have been
+// read.
+func (jlri *JsonLinesRecordIterator) Next(record interface{}) (err error) {
+	return jlri.d.Decode(record)
+}
+
+// Close stops reading the series. It must be called if the iterator is
+// abandoned before it returns `io.EOF`.
+func (jlri *JsonLinesRecordIterator) Close() (err error) {
+	return jlri.sdp.Close()
+}
+
+// >>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>>
+// JSON-lines encoder/decoder for slices
+// <<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<
+
+// JsonLinesDecoderDatasource decodes series-data that has one JSON record per
+// line into a slice. It satisfies `SeriesDataDatasourceReader`. It is a thin
+// wrapper on `JsonLinesRecordDecoderDatasource`.
+type JsonLinesDecoderDatasource struct {
+	*JsonLinesRecordDecoderDatasource
+}
+
+// NewJsonLinesDecoderDatasource returns a new `JsonLinesDecoderDatasource`
+// struct. `outputSlicePtr` must be a pointer to a slice. The decoded records
+// are appended to it.
+func NewJsonLinesDecoderDatasource(outputSlicePtr interface{}) *JsonLinesDecoderDatasource {
+	v := reflect.ValueOf(outputSlicePtr)
+	if v.Kind() != reflect.Ptr || v.Elem().Kind() != reflect.Slice {
+		log.Panicf("output must be a pointer to a slice: [%v]", v.Type())
+	}
+
+	outputSlice := v.Elem()
+	elementType := outputSlice.Type().Elem()
+
+	newRecord := func() interface{} {
+		return reflect.New(elementType).Interface()
+	}
+
+	cb := func(record interface{}) (err error) {
+		outputSlice.Set(reflect.Append(outputSlice, reflect.ValueOf(record).Elem()))
+		return nil
+	}
+
+	return &JsonLinesDecoderDatasource{
+		JsonLinesRecordDecoderDatasource: NewJsonLinesRecordDecoderDatasource(newRecord, cb),
+	}
+}
+
+// JsonLinesEncoderDatasource encodes the records in a slice as JSON, one
+// record per line. It satisfies `SeriesDataDatasourceWriter`. It is a thin
+// wrapper on `JsonLinesRecordEncoderDatasource`.
+type JsonLinesEncoderDatasource struct {
+	*JsonLinesRecordEncoderDatasource
+}
+
+// NewJsonLinesEncoderDatasource returns a new `JsonLinesEncoderDatasource`
+// struct. `inputSlice` must be a slice (or an array) with at least one record
+// (a series can not be empty). Each call to `WriteData` encodes the whole
+// slice.
+func NewJsonLinesEncoderDatasource(inputSlice interface{}) *JsonLinesEncoderDatasource {
+	v := reflect.ValueOf(inputSlice)
+	if v.Kind() != reflect.Slice && v.Kind() != reflect.Array {
+		log.Panicf("input must be a slice: [%v]", v.Type())
+	}
+
+	i := 0
+	source := func() (record interface{}, err error) {
+		if i >= v.Len() {
+			// Rewind so that the series can be written again.
+			i = 0
+
+			return nil, io.EOF
+		}
+
+		record = v.Index(i).Interface()
+		i++
+
+		return record, nil
+	}
+
+	return &JsonLinesEncoderDatasource{
+		JsonLinesRecordEncoderDatasource: NewJsonLinesRecordEncoderDatasource(source),
+	}
+}
@@ -0,0 +1,258 @@
+package timetogo
+
+import (
+	"bytes"
+	"io"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/dsoprea/go-logging"
+	"github.com/randomingenuity/go-utility/filesystem"
+)
+
+type testJsonRecord struct {
+	Timestamp int64   `json:"timestamp"`
+	Value     float64 `json:"value"`
+}
+
+var (
+	testJsonRecords = []testJsonRecord{
+		{Timestamp: 1000, Value: 1.5},
+		{Timestamp: 1001, Value: 2.5},
+		{Timestamp: 1002, Value: 3.5},
+	}
+)
+
+func TestJsonSingleObjectDatasource(t *testing.T) {
+	sb := rifs.NewSeekableBuffer()
+	streamBuilder := NewStreamBuilder(sb)
+
+	headRecordTime := time.Date(2016, 10, 1, 12, 34, 56, 0, time.UTC)
+	seriesFooter := NewSeriesFooter1(headRecordTime, headRecordTime.Add(time.Second*2), 3, []byte{11, 22, 33})
+
+	err := streamBuilder.AddSeries(NewJsonSingleObjectEncoderDatasource(testJsonRecords), seriesFooter)
+	log.PanicIf(err)
+
+	_, err = streamBuilder.Finish()
+	log.PanicIf(err)
+
+	sr := NewStreamReader(sb)
+
+	it, err := NewIterator(sr)
+	log.PanicIf(err)
+
+	var recovered []testJsonRecord
+
+	recoveredSeriesFooter, _, checksumOk, err := sr.ReadSeriesWithIndexedInfo(it.SeriesInfo(0), NewJsonSingleObjectDecoderDatasource(&recovered))
+	log.PanicIf(err)
+
+	if checksumOk != true {
+		t.Fatalf("Checksum not correct.")
+	} else if reflect.DeepEqual(recovered, testJsonRecords) != true {
+		t.Fatalf("Records not correct: %v", recovered)
+	}
+
+	expectedData := "[{\"timestamp\":1000,\"value\":1.5},{\"timestamp\":1001,\"value\":2.5},{\"timestamp\":1002,\"value\":3.5}]\n"
+	if recoveredSeriesFooter.BytesLength() != uint64(len(expectedData)) {
+		t.Fatalf("Bytes-length not correct: (%d)", recoveredSeriesFooter.BytesLength())
+	}
+}
+
+func TestJsonSingleObjectDecoderDatasource_TrailingData(t *testing.T) {
+	var recovered []testJsonRecord
+	jdd := NewJsonSingleObjectDecoderDatasource(&recovered)
+
+	_, err := jdd.ReadData(bytes.NewBufferString("[]\n[]\n"), nil)
+	if err == nil {
+		t.Fatalf("Expected failure for trailing data.")
+	} else if log.Is(err, ErrJsonTrailingData) != true {
+		log.Panic(err)
+	}
+}
+
+func TestJsonLinesDatasource(t *testing.T) {
+	sb := rifs.NewSeekableBuffer()
+	streamBuilder := NewStreamBuilder(sb)
+
+	headRecordTime := time.Date(2016, 10, 1, 12, 34, 56, 0, time.UTC)
+	seriesFooter := NewSeriesFooter1(headRecordTime, headRecordTime.Add(time.Second*2), 3, []byte{11, 22, 33})
+
+	err := streamBuilder.AddSeries(NewJsonLinesEncoderDatasource(testJsonRecords), seriesFooter)
+	log.PanicIf(err)
+
+	_, err = streamBuilder.Finish()
+	log.PanicIf(err)
+
+	sr := NewStreamReader(sb)
+
+	it, err := NewIterator(sr)
+	log.PanicIf(err)
+
+	// Read the raw data in order to check the format.
+
+	raw := new(bytes.Buffer)
+
+	recoveredSeriesFooter, _, _, err := sr.ReadSeriesWithIndexedInfo(it.SeriesInfo(0), raw)
+	log.PanicIf(err)
+
+	expectedData := "{\"timestamp\":1000,\"value\":1.5}\n{\"timestamp\":1001,\"value\":2.5}\n{\"timestamp\":1002,\"value\":3.5}\n"
+	if raw.String() != expectedData {
+		t.Fatalf("Encoded data not correct: [%s]", raw.String())
+	} else if recoveredSeriesFooter.BytesLength() != uint64(len(expectedData)) {
+		t.Fatalf("Bytes-length not correct: (%d)", recoveredSeriesFooter.BytesLength())
+	}
+
+	// Decode.
+
+	recovered := make([]testJsonRecord, 0)
+
+	_, _, checksumOk, err := sr.ReadSeriesWithIndexedInfo(it.SeriesInfo(0), NewJsonLinesDecoderDatasource(&recovered))
+	log.PanicIf(err)
+
+	if checksumOk != true {
+		t.Fatalf("Checksum not correct.")
+	} else if reflect.DeepEqual(recovered, testJsonRecords) != true {
+		t.Fatalf("Records not correct: %v", recovered)
+	}
+}
+
+func TestNewJsonLinesDecoderDatasource_NotSlicePointer(t *testing.T) {
+	defer func() {
+		if state := recover(); state == nil {
+			t.Fatalf("Expected panic for non-slice output.")
+		}
+	}()
+
+	NewJsonLinesDecoderDatasource(make([]testJsonRecord, 0))
+}
+
+// writeTestJsonLinesRecordStream writes one series of JSON-lines records from
+// a source.
+func writeTestJsonLinesRecordStream(count int) *rifs.SeekableBuffer {
+	sb := rifs.NewSeekableBuffer()
+	streamBuilder := NewStreamBuilder(sb)
+
+	i := 0
+	source := func() (record interface{}, err error) {
+		if i >= count {
+			return nil, io.EOF
+		}
+
+		record = testJsonRecord{Timestamp: int64(i), Value: float64(i) / 2}
+		i++
+
+		return record, nil
+	}
+
+	headRecordTime := time.Date(2016, 10, 1, 12, 34, 56, 0, time.UTC)
+	seriesFooter := NewSeriesFooter1(headRecordTime, headRecordTime.Add(time.Second*2), uint64(count), []byte{11, 22, 33})
+
+	err := streamBuilder.AddSeries(NewJsonLinesRecordEncoderDatasource(source), seriesFooter)
+	log.PanicIf(err)
+
+	_, err = streamBuilder.Finish()
+	log.PanicIf(err)
+
+	return sb
+}
+
+func TestJsonLinesRecordDatasource(t *testing.T) {
+	sb := writeTestJsonLinesRecordStream(1000)
+
+	sr := NewStreamReader(sb)
+
+	it, err := NewIterator(sr)
+	log.PanicIf(err)
+
+	newRecord := func() interface{} {
+		return new(testJsonRecord)
+	}
+
+	i := 0
+	cb := func(record interface{}) (err error) {
+		tjr := record.(*testJsonRecord)
+
+		if tjr.Timestamp != int64(i) || tjr.Value != float64(i)/2 {
+			t.Fatalf("Record (%d) not correct: %v", i, tjr)
+		}
+
+		i++
+
+		return nil
+	}
+
+	recoveredSeriesFooter, _, checksumOk, err := sr.ReadSeriesWithIndexedInfo(it.SeriesInfo(0), NewJsonLinesRecordDecoderDatasource(newRecord, cb))
+	log.PanicIf(err)
+
+	if checksumOk != true {
+		t.Fatalf("Checksum not correct.")
+	} else if i != 1000 {
+		t.Fatalf("Record count not correct: (%d)", i)
+	} else if recoveredSeriesFooter.RecordCount() != 1000 {
+		t.Fatalf("Footer not correct.")
+	}
+}
+
+func TestJsonLinesRecordIterator(t *testing.T) {
+	sb := writeTestJsonLinesRecordStream(1000)
+
+	sr := NewStreamReader(sb)
+
+	it, err := NewIterator(sr)
+	log.PanicIf(err)
+
+	jlri := NewJsonLinesRecordIterator(sr, it.SeriesInfo(0))
+
+	i := 0
+	for {
+		var tjr testJsonRecord
+
+		err := jlri.Next(&tjr)
+		if err == io.EOF {
+			break
+		}
+
+		log.PanicIf(err)
+
+		if tjr.Timestamp != int64(i) || tjr.Value != float64(i)/2 {
+			t.Fatalf("Record (%d) not correct: %v", i, tjr)
+		}
+
+		i++
+	}
+
+	if i != 1000 {
+		t.Fatalf("Record count not correct: (%d)", i)
+	}
+}
+
+func TestJsonLinesRecordIterator_Close(t *testing.T) {
+	sb := writeTestJsonLinesRecordStream(1000)
+
+	sr := NewStreamReader(sb)
+
+	it, err := NewIterator(sr)
+	log.PanicIf(err)
+
+	jlri := NewJsonLinesRecordIterator(sr, it.SeriesInfo(0))
+
+	var tjr testJsonRecord
+
+	err = jlri.Next(&tjr)
+	log.PanicIf(err)
+
+	// Abandon the series. This must not block.
+
+	err = jlri.Close()
+	log.PanicIf(err)
+
+	// The reader can be used again.
+
+	_, _, checksumOk, err := sr.ReadSeriesWithIndexedInfo(it.SeriesInfo(0), nil)
+	log.PanicIf(err)
+
+	if checksumOk != true {
+		t.Fatalf("Checksum not correct.")
+	}
+}
@@ -0,0 +1,263 @@
+package timetogo
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"sort"
+	"time"
+
+	"encoding/binary"
+	"path/filepath"
+
+	"github.com/dsoprea/go-logging"
+)
+
+// FingerprintMode determines what is hashed for each file.
+type FingerprintMode int
+
+const (
+	// FmMetadata hashes the path, size, and modification time of each file.
+	// This is fast but a file that is rewritten with the same size and time
+	// won't be noticed.
+	FmMetadata FingerprintMode = iota
+
+	// FmContent hashes the path and the full content of each file.
+	FmContent FingerprintMode = iota
+)
+
+// writeFingerprintField writes a length-prefixed field so that adjacent fields
+// can't run together (e.g. "ab"+"c" and "a"+"bc").
+func writeFingerprintField(h hash.Hash, field []byte) {
+	err := binary.Write(h, binary.BigEndian, uint64(len(field)))
+	log.PanicIf(err)
+
+	_, err = h.Write(field)
+	log.PanicIf(err)
+}
+
+// FingerprintFiles returns a SHA1 over the given files, suitable for use as the
+// source SHA1 of a series that is built from them. The paths are sorted first
+// so that the order that they are given in doesn't matter. The paths are
+// included as given, so they should be given the same way every time (e.g.
+// always relative to the same directory).
+func FingerprintFiles(paths []string, mode FingerprintMode) (fingerprint []byte, err error) {
+	defer func() {
+		if state := recover(); state != nil {
+			err = log.Wrap(state.(error))
+		}
+	}()
+
+	sorted := make([]string, len(paths))
+	copy(sorted, paths)
+
+	sort.Strings(sorted)
+
+	h := sha1.New()
+
+	for _, sourcePath := range sorted {
+		writeFingerprintField(h, []byte(sourcePath))
+
+		switch mode {
+		case FmMetadata:
+			fi, err := os.Stat(sourcePath)
+			log.PanicIf(err)
+
+			err = binary.Write(h, binary.BigEndian, fi.Size())
+			log.PanicIf(err)
+
+			err = binary.Write(h, binary.BigEndian, fi.ModTime().UnixNano())
+			log.PanicIf(err)
+		case FmContent:
+			f, err := os.Open(sourcePath)
+			log.PanicIf(err)
+
+			contentHash := sha1.New()
+
+			_, err = io.Copy(contentHash, f)
+			f.Close()
+
+			log.PanicIf(err)
+
+			writeFingerprintField(h, contentHash.Sum(nil))
+		default:
+			log.Panicf("fingerprint mode not valid: (%d)", int(mode))
+		}
+	}
+
+	return h.Sum(nil), nil
+}
+
+// FingerprintGlob returns a SHA1 over the files that match the pattern. See
+// `FingerprintFiles`.
+func FingerprintGlob(pattern string, mode FingerprintMode) (fingerprint []byte, err error) {
+	defer func() {
+		if state := recover(); state != nil {
+			err = log.Wrap(state.(error))
+		}
+	}()
+
+	paths, err := filepath.Glob(pattern)
+	log.PanicIf(err)
+
+	fingerprint, err = FingerprintFiles(paths, mode)
+	log.PanicIf(err)
+
+	return fingerprint, nil
+}
+
+// FingerprintReaders returns a SHA1 over the content of the given readers, in
+// the order given.
+func FingerprintReaders(readers ...io.Reader) (fingerprint []byte, err error) {
+	defer func() {
+		if state := recover(); state != nil {
+			err = log.Wrap(state.(error))
+		}
+	}()
+
+	h := sha1.New()
+
+	for _, r := range readers {
+		contentHash := sha1.New()
+
+		_, err := io.Copy(contentHash, r)
+		log.PanicIf(err)
+
+		writeFingerprintField(h, contentHash.Sum(nil))
+	}
+
+	return h.Sum(nil), nil
+}
+
+// FingerprintRecords returns a SHA1 over the records as encoded by the given
+// encoder (e.g. `GobPartitionEncoder`). The encoding must be deterministic,
+// which excludes encoding maps with gob.
+func FingerprintRecords(records []interface{}, encoder PartitionEncoder) (fingerprint []byte, err error) {
+	defer func() {
+		if state := recover(); state != nil {
+			err = log.Wrap(state.(error))
+		}
+	}()
+
+	h := sha1.New()
+
+	err = encoder(h, records)
+	log.PanicIf(err)
+
+	return h.Sum(nil), nil
+}
+
+// fingerprintSeriesSink collects the source SHA1 of each series.
+type fingerprintSeriesSink struct {
+	fingerprints map[string][]byte
+}
+
+// AddSeries records the source SHA1 and discards the data.
+func (fss fingerprintSeriesSink) AddSeries(seriesDataWriter interface{}, sf SeriesFooter) (err error) {
+	fss.fingerprints[sf.Uuid()] = sf.SourceSha1()
+	return nil
+}
+
+// PartitionFingerprints partitions the records the same way that `Partitioner`
+// would and returns the fingerprint of each partition, keyed by series UUID.
+// Nothing is written.
+func PartitionFingerprints(records []interface{}, unit PartitionUnit, location *time.Location, timestampOf PartitionTimestampGetter, encoder PartitionEncoder) (fingerprints map[string][]byte, err error) {
+	defer func() {
+		if state := recover(); state != nil {
+			err = log.Wrap(state.(error))
+		}
+	}()
+
+	fss := fingerprintSeriesSink{
+		fingerprints: make(map[string][]byte),
+	}
+
+	p := NewPartitioner(fss, unit, location, timestampOf, encoder)
+
+	for _, record := range records {
+		err := p.Add(record)
+		log.PanicIf(err)
+	}
+
+	_, err = p.Finish()
+	log.PanicIf(err)
+
+	return fss.fingerprints, nil
+}
+
+// FingerprintReport compares the fingerprints of the current sources with the
+// source SHA1s of the series in a stream. Each list is of series UUIDs and is
+// sorted.
+type FingerprintReport struct {
+	// Added are the series that aren't in the stream.
+	Added []string
+
+	// Changed are the series whose fingerprint differs from the stream.
+	Changed []string
+
+	// Unchanged are the series whose fingerprint matches the stream.
+	Unchanged []string
+
+	// Removed are the series in the stream that have no fingerprint.
+	Removed []string
+}
+
+// HasChanges returns true if any series were added, changed, or removed.
+func (fr FingerprintReport) HasChanges() bool {
+	return len(fr.Added) > 0 || len(fr.Changed) > 0 || len(fr.Removed) > 0
+}
+
+func (fr FingerprintReport) String() string {
+	return fmt.Sprintf("FingerprintReport<ADDED=(%d) CHANGED=(%d) UNCHANGED=(%d) REMOVED=(%d)>", len(fr.Added), len(fr.Changed), len(fr.Unchanged), len(fr.Removed))
+}
+
+// CompareFingerprints reports which series have fingerprints that differ from
+// their source SHA1 in the stream. `fingerprints` is keyed by series UUID (for
+// partitions, see `PartitionUuid`). An empty stream is allowed.
+func CompareFingerprints(rs io.ReadSeeker, fingerprints map[string][]byte) (report FingerprintReport, err error) {
+	defer func() {
+		if state := recover(); state != nil {
+			err = log.Wrap(state.(error))
+		}
+	}()
+
+	existing, err := readAllSeriesFooters(rs)
+	log.PanicIf(err)
+
+	report = FingerprintReport{
+		Added:     make([]string, 0),
+		Changed:   make([]string, 0),
+		Unchanged: make([]string, 0),
+		Removed:   make([]string, 0),
+	}
+
+	existingByUuid := make(map[string]SeriesFooter)
+	for _, seriesFooter := range existing {
+		existingByUuid[seriesFooter.Uuid()] = seriesFooter
+
+		if _, found := fingerprints[seriesFooter.Uuid()]; found == false {
+			report.Removed = append(report.Removed, seriesFooter.Uuid())
+		}
+	}
+
+	for uuid, fingerprint := range fingerprints {
+		seriesFooter, found := existingByUuid[uuid]
+		if found == false {
+			report.Added = append(report.Added, uuid)
+		} else if bytes.Equal(seriesFooter.SourceSha1(), fingerprint) == true {
+			report.Unchanged = append(report.Unchanged, uuid)
+		} else {
+			report.Changed = append(report.Changed, uuid)
+		}
+	}
+
+	sort.Strings(report.Added)
+	sort.Strings(report.Changed)
+	sort.Strings(report.Unchanged)
+	sort.Strings(report.Removed)
+
+	return report, nil
+}
@@ -0,0 +1,211 @@
+package timetogo
+
+import (
+	"bytes"
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"crypto/sha1"
+	"io/ioutil"
+
+	"github.com/dsoprea/go-logging"
+	"github.com/randomingenuity/go-utility/filesystem"
+)
+
+func TestFingerprintFiles(t *testing.T) {
+	tempPath, err := ioutil.TempDir("", "timetogo.fingerprint.")
+	log.PanicIf(err)
+
+	defer os.RemoveAll(tempPath)
+
+	filepath1 := path.Join(tempPath, "a.csv")
+	filepath2 := path.Join(tempPath, "b.csv")
+
+	err = ioutil.WriteFile(filepath1, []byte("1,2,3\n"), 0644)
+	log.PanicIf(err)
+
+	err = ioutil.WriteFile(filepath2, []byte("4,5,6\n"), 0644)
+	log.PanicIf(err)
+
+	for _, mode := range []FingerprintMode{FmMetadata, FmContent} {
+		fingerprint1, err := FingerprintFiles([]string{filepath1, filepath2}, mode)
+		log.PanicIf(err)
+
+		// The order doesn't matter.
+
+		fingerprint2, err := FingerprintFiles([]string{filepath2, filepath1}, mode)
+		log.PanicIf(err)
+
+		if bytes.Equal(fingerprint1, fingerprint2) != true {
+			t.Fatalf("Fingerprint depends on order with mode (%d).", mode)
+		}
+
+		fingerprint3, err := FingerprintGlob(path.Join(tempPath, "*.csv"), mode)
+		log.PanicIf(err)
+
+		if bytes.Equal(fingerprint1, fingerprint3) != true {
+			t.Fatalf("Glob fingerprint not correct with mode (%d).", mode)
+		}
+
+		fingerprint4, err := FingerprintFiles([]string{filepath1}, mode)
+		log.PanicIf(err)
+
+		if bytes.Equal(fingerprint1, fingerprint4) == true {
+			t.Fatalf("Fingerprint did not change with file set with mode (%d).", mode)
+		}
+	}
+
+	// Change the content but keep the size and modification time. Only a
+	// content fingerprint notices.
+
+	metadataBefore, err := FingerprintFiles([]string{filepath1}, FmMetadata)
+	log.PanicIf(err)
+
+	contentBefore, err := FingerprintFiles([]string{filepath1}, FmContent)
+	log.PanicIf(err)
+
+	fi, err := os.Stat(filepath1)
+	log.PanicIf(err)
+
+	err = ioutil.WriteFile(filepath1, []byte("7,8,9\n"), 0644)
+	log.PanicIf(err)
+
+	err = os.Chtimes(filepath1, fi.ModTime(), fi.ModTime())
+	log.PanicIf(err)
+
+	metadataAfter, err := FingerprintFiles([]string{filepath1}, FmMetadata)
+	log.PanicIf(err)
+
+	contentAfter, err := FingerprintFiles([]string{filepath1}, FmContent)
+	log.PanicIf(err)
+
+	if bytes.Equal(metadataBefore, metadataAfter) != true {
+		t.Fatalf("Metadata fingerprint changed.")
+	} else if bytes.Equal(contentBefore, contentAfter) == true {
+		t.Fatalf("Content fingerprint did not change.")
+	}
+
+	_, err = FingerprintFiles([]string{path.Join(tempPath, "missing.csv")}, FmMetadata)
+	if err == nil {
+		t.Fatalf("Expected failure for missing file.")
+	}
+}
+
+func TestFingerprintReaders(t *testing.T) {
+	fingerprint1, err := FingerprintReaders(bytes.NewBufferString("ab"), bytes.NewBufferString("c"))
+	log.PanicIf(err)
+
+	fingerprint2, err := FingerprintReaders(bytes.NewBufferString("a"), bytes.NewBufferString("bc"))
+	log.PanicIf(err)
+
+	fingerprint3, err := FingerprintReaders(bytes.NewBufferString("ab"), bytes.NewBufferString("c"))
+	log.PanicIf(err)
+
+	if bytes.Equal(fingerprint1, fingerprint2) == true {
+		t.Fatalf("Reader boundaries not included in fingerprint.")
+	} else if bytes.Equal(fingerprint1, fingerprint3) != true {
+		t.Fatalf("Fingerprint not stable.")
+	}
+}
+
+func TestFingerprintRecords(t *testing.T) {
+	records := []interface{}{
+		testPartitionRecord{Value: 1},
+		testPartitionRecord{Value: 2},
+	}
+
+	fingerprint, err := FingerprintRecords(records, GobPartitionEncoder)
+	log.PanicIf(err)
+
+	b := new(bytes.Buffer)
+
+	err = GobPartitionEncoder(b, records)
+	log.PanicIf(err)
+
+	expected := sha1.Sum(b.Bytes())
+	if bytes.Equal(fingerprint, expected[:]) != true {
+		t.Fatalf("Fingerprint not correct: [%x]", fingerprint)
+	}
+}
+
+func TestCompareFingerprints(t *testing.T) {
+	records := make([]interface{}, 0)
+	for _, record := range getTestPartitionRecords() {
+		records = append(records, record)
+	}
+
+	// Nothing has been written yet.
+
+	fingerprints, err := PartitionFingerprints(records, PuDay, nil, testPartitionTimestamp, GobPartitionEncoder)
+	log.PanicIf(err)
+
+	if len(fingerprints) != 3 {
+		t.Fatalf("Fingerprint count not correct: (%d)", len(fingerprints))
+	}
+
+	rws := rifs.NewSeekableBuffer()
+
+	report, err := CompareFingerprints(rws, fingerprints)
+	log.PanicIf(err)
+
+	if len(report.Added) != 3 || report.HasChanges() != true {
+		t.Fatalf("Report for empty stream not correct: %s", report)
+	}
+
+	// Write the partitions.
+
+	uss := NewUpdaterSeriesSink(rws)
+	p := NewPartitioner(uss, PuDay, nil, testPartitionTimestamp, GobPartitionEncoder)
+
+	for _, record := range records {
+		err := p.Add(record)
+		log.PanicIf(err)
+	}
+
+	_, err = p.Finish()
+	log.PanicIf(err)
+
+	_, _, err = uss.Updater().Write()
+	log.PanicIf(err)
+
+	report, err = CompareFingerprints(rws, fingerprints)
+	log.PanicIf(err)
+
+	if len(report.Unchanged) != 3 || report.HasChanges() != false {
+		t.Fatalf("Report for unchanged stream not correct: %s", report)
+	}
+
+	// Change the last day and drop the first.
+
+	changed := make([]interface{}, 0)
+	for _, record := range records[4:] {
+		tpr := record.(testPartitionRecord)
+		if tpr.Value == 10 {
+			tpr.Value = 100
+		}
+
+		changed = append(changed, tpr)
+	}
+
+	fingerprints, err = PartitionFingerprints(changed, PuDay, nil, testPartitionTimestamp, GobPartitionEncoder)
+	log.PanicIf(err)
+
+	report, err = CompareFingerprints(rws, fingerprints)
+	log.PanicIf(err)
+
+	firstDay := PartitionUuid(PuDay, time.Date(2016, 11, 5, 0, 0, 0, 0, time.UTC))
+	secondDay := PartitionUuid(PuDay, time.Date(2016, 11, 6, 0, 0, 0, 0, time.UTC))
+	thirdDay := PartitionUuid(PuDay, time.Date(2016, 11, 7, 0, 0, 0, 0, time.UTC))
+
+	if len(report.Added) != 0 {
+		t.Fatalf("Added not correct: %v", report.Added)
+	} else if len(report.Changed) != 1 || report.Changed[0] != thirdDay {
+		t.Fatalf("Changed not correct: %v", report.Changed)
+	} else if len(report.Unchanged) != 1 || report.Unchanged[0] != secondDay {
+		t.Fatalf("Unchanged not correct: %v", report.Unchanged)
+	} else if len(report.Removed) != 1 || report.Removed[0] != firstDay {
+		t.Fatalf("Removed not correct: %v", report.Removed)
+	}
+}
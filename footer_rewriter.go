@@ -0,0 +1,201 @@
+package timetogo
+
+import (
+	"bytes"
+	"io"
+	"os"
+
+	"github.com/dsoprea/go-logging"
+)
+
+var (
+	footerRewriterLogger = log.NewLogger("timetogo.footer_rewriter")
+)
+
+// RewriteSeriesFooter replaces the footer of the existing series with the same
+// UUID as the given footer and updates its entry in the stream footer. The
+// series data is not touched. The bytes-length and checksum are always taken
+// from the existing footer, the created-time is retained, and the updated-time
+// is bumped. If the new footer is the same size as the old one or the series
+// is the last one in the stream, no series data is moved. Otherwise, only the
+// series that follow it are shifted.
+func RewriteSeriesFooter(rws io.ReadWriteSeeker, seriesFooter SeriesFooter) (totalSize int, err error) {
+	defer func() {
+		if state := recover(); state != nil {
+			err = log.Wrap(state.(error))
+		}
+	}()
+
+	sr := NewStreamReader(rws)
+
+	it, err := NewIterator(sr)
+	log.PanicIf(err)
+
+	// Find the series.
+
+	seriesPosition := -1
+	for i := 0; i < it.Count(); i++ {
+		if it.SeriesInfo(i).Uuid() == seriesFooter.Uuid() {
+			seriesPosition = i
+			break
+		}
+	}
+
+	if seriesPosition == -1 {
+		log.Panicf("series [%s] not found in stream", seriesFooter.Uuid())
+	}
+
+	existingSeriesFooter, dataOffset, existingSeriesSize, err := sr.ReadSeriesInfoWithIndexedInfo(it.SeriesInfo(seriesPosition))
+	log.PanicIf(err)
+
+	bytesLength := existingSeriesFooter.BytesLength()
+	existingFooterSize := existingSeriesSize - int(bytesLength)
+	footerPosition := dataOffset + int64(bytesLength)
+	existingSeriesEnd := dataOffset + int64(existingSeriesSize)
+
+	seriesFooter.SetBytesLength(bytesLength)
+	carryCreatedTime(seriesFooter, existingSeriesFooter.CreatedTime())
+	seriesFooter.TouchUpdatedTime()
+
+	// Encode the new footer so that we know how big it is.
+
+	footerBuffer := new(bytes.Buffer)
+	footerWriter := NewStreamWriter(footerBuffer)
+
+	newFooterSize, err := footerWriter.writeSeriesFooter1(seriesFooter, existingSeriesFooter.DataFnv1aChecksum())
+	log.PanicIf(err)
+
+	delta := int64(newFooterSize - existingFooterSize)
+
+	// Determine where the series data ends (and the stream footer begins).
+
+	var seriesEnd int64
+	for i := 0; i < it.Count(); i++ {
+		if position := it.SeriesInfo(i).AbsolutePosition() + 1; position > seriesEnd {
+			seriesEnd = position
+		}
+	}
+
+	footerRewriterLogger.Debugf(nil, "Rewriting footer for series [%s] at position (%d): (%d) => (%d)", seriesFooter.Uuid(), footerPosition, existingFooterSize, newFooterSize)
+
+	// Shift the following series, if there are any and if we have to.
+
+	if delta != 0 && existingSeriesEnd < seriesEnd {
+		err := moveStreamBytes(rws, existingSeriesEnd, existingSeriesEnd+delta, seriesEnd-existingSeriesEnd)
+		log.PanicIf(err)
+	}
+
+	_, err = rws.Seek(footerPosition, os.SEEK_SET)
+	log.PanicIf(err)
+
+	_, err = rws.Write(footerBuffer.Bytes())
+	log.PanicIf(err)
+
+	// Rewrite the stream footer.
+
+	indexedSeries := make([]StreamIndexedSequenceInfo, it.Count())
+	for i := 0; i < it.Count(); i++ {
+		sisi := it.SeriesInfo(i)
+
+		if i == seriesPosition {
+			indexedSeries[i] = NewStreamIndexedSequenceInfo1WithSeriesFooter(seriesFooter, sisi.AbsolutePosition()+delta)
+		} else if sisi.AbsolutePosition() > footerPosition {
+			indexedSeries[i] = NewStreamIndexedSequenceInfo1(sisi.Uuid(), sisi.HeadRecordTime(), sisi.TailRecordTime(), sisi.AbsolutePosition()+delta)
+		} else {
+			indexedSeries[i] = sisi
+		}
+	}
+
+	// Free regions behind the series move with the series.
+
+	freeRegions := make([]FreeRegion, len(it.FreeRegions()))
+	for i, fr := range it.FreeRegions() {
+		if fr.AbsolutePosition >= existingSeriesEnd {
+			fr.AbsolutePosition += delta
+		}
+
+		freeRegions[i] = fr
+	}
+
+	streamFooterPosition := seriesEnd + delta
+
+	_, err = rws.Seek(streamFooterPosition, os.SEEK_SET)
+	log.PanicIf(err)
+
+	sw := NewStreamWriter(rws)
+	streamFooter := NewStreamFooter1WithFreeRegions(indexedSeries, freeRegions)
+
+	streamFooterSize, err := sw.writeStreamFooter(streamFooter)
+	log.PanicIf(err)
+
+	totalSize = int(streamFooterPosition) + streamFooterSize
+
+	if truncater, ok := rws.(Truncater); ok == true {
+		footerRewriterLogger.Debugf(nil, "Underlying RWS is also a truncater. Truncating stream to right size after footer rewrite.")
+
+		err = truncater.Truncate(int64(totalSize))
+		log.PanicIf(err)
+	}
+
+	return totalSize, nil
+}
+
+// moveStreamBytes moves a block of bytes from one position in the stream to
+// another. The regions may overlap; the copy is done in the direction that
+// won't overwrite bytes that haven't been read yet.
+func moveStreamBytes(rws io.ReadWriteSeeker, from, to, count int64) (err error) {
+	defer func() {
+		if state := recover(); state != nil {
+			err = log.Wrap(state.(error))
+		}
+	}()
+
+	if from == to || count == 0 {
+		return nil
+	}
+
+	bufferSize := int64(SeriesDataCopyBufferSize)
+	if count < bufferSize {
+		bufferSize = count
+	}
+
+	buffer := make([]byte, bufferSize)
+
+	copyChunk := func(offset, size int64) {
+		_, err := rws.Seek(from+offset, os.SEEK_SET)
+		log.PanicIf(err)
+
+		_, err = io.ReadFull(rws, buffer[:size])
+		log.PanicIf(err)
+
+		_, err = rws.Seek(to+offset, os.SEEK_SET)
+		log.PanicIf(err)
+
+		_, err = rws.Write(buffer[:size])
+		log.PanicIf(err)
+	}
+
+	if to < from {
+		// Moving toward the front. Copy front to back.
+		for offset := int64(0); offset < count; offset += bufferSize {
+			size := bufferSize
+			if offset+size > count {
+				size = count - offset
+			}
+
+			copyChunk(offset, size)
+		}
+	} else {
+		// Moving toward the back. Copy back to front.
+		for end := count; end > 0; end -= bufferSize {
+			size := bufferSize
+			if end-size < 0 {
+				size = end
+			}
+
+			copyChunk(end-size, size)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,208 @@
+package timetogo
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/dsoprea/go-logging"
+	"github.com/randomingenuity/go-utility/filesystem"
+)
+
+func readTestStreamSeries(raw []byte) (footers []SeriesFooter, data [][]byte) {
+	r := bytes.NewReader(raw)
+	sr := NewStreamReader(r)
+
+	it, err := NewIterator(sr)
+	log.PanicIf(err)
+
+	footers = make([]SeriesFooter, it.Count())
+	data = make([][]byte, it.Count())
+
+	for i := it.Count() - 1; i >= 0; i-- {
+		b := new(bytes.Buffer)
+
+		seriesFooter, checksumOk, err := it.Iterate(b)
+		log.PanicIf(err)
+
+		if checksumOk != true {
+			log.Panicf("checksum for series (%d) not correct", i)
+		}
+
+		footers[i] = seriesFooter
+		data[i] = b.Bytes()
+	}
+
+	return footers, data
+}
+
+func TestRewriteSeriesFooter_SameSize(t *testing.T) {
+	raw, series, _ := WriteTestMultiseriesStream()
+
+	originalRaw := make([]byte, len(raw))
+	copy(originalRaw, raw)
+
+	newHeadRecordTime := series[0].HeadRecordTime().Add(-time.Hour)
+
+	edited := NewSeriesFooter1WithUuid(
+		series[0].Uuid(),
+		newHeadRecordTime,
+		series[0].TailRecordTime(),
+		99,
+		series[0].SourceSha1())
+
+	rws := rifs.NewSeekableBufferWithBytes(raw)
+
+	totalSize, err := RewriteSeriesFooter(rws, edited)
+	log.PanicIf(err)
+
+	if totalSize != 554 {
+		t.Fatalf("Total stream size not correct: (%d)", totalSize)
+	}
+
+	finalRaw := rws.Bytes()
+
+	// The data of both series should not have moved.
+	if bytes.Compare(finalRaw[:len(TestTimeSeriesData)], originalRaw[:len(TestTimeSeriesData)]) != 0 {
+		t.Fatalf("Data for first series moved.")
+	} else if bytes.Compare(finalRaw[171:171+len(TestTimeSeriesData2)], originalRaw[171:171+len(TestTimeSeriesData2)]) != 0 {
+		t.Fatalf("Data for second series moved.")
+	}
+
+	footers, data := readTestStreamSeries(finalRaw)
+
+	if footers[0].RecordCount() != 99 {
+		t.Fatalf("Record-count not updated: (%d)", footers[0].RecordCount())
+	} else if footers[0].HeadRecordTime() != newHeadRecordTime {
+		t.Fatalf("Head time not updated: [%v]", footers[0].HeadRecordTime())
+	} else if footers[0].CreatedTime() != series[0].CreatedTime() {
+		t.Fatalf("Created-time not retained: [%v]", footers[0].CreatedTime())
+	} else if bytes.Compare(data[0], TestTimeSeriesData) != 0 {
+		t.Fatalf("First series data not correct: %v", data[0])
+	} else if bytes.Compare(data[1], TestTimeSeriesData2) != 0 {
+		t.Fatalf("Second series data not correct: %v", data[1])
+	}
+
+	// The stream footer should reflect the new head time.
+
+	index, err := NewIndex(bytes.NewReader(finalRaw))
+	log.PanicIf(err)
+
+	matched, err := index.GetWithTimestamp(newHeadRecordTime)
+	log.PanicIf(err)
+
+	if len(matched) != 1 || matched[0].Uuid() != series[0].Uuid() {
+		t.Fatalf("Stream footer not updated: %v", matched)
+	}
+}
+
+func TestRewriteSeriesFooter_Grow(t *testing.T) {
+	raw, series, _ := WriteTestMultiseriesStream()
+
+	// A longer SHA1 will produce a larger footer.
+	sourceSha1 := []byte{
+		1, 2, 3, 4, 5, 6, 7, 8, 9, 10,
+		11, 12, 13, 14, 15, 16, 17, 18, 19, 20,
+	}
+
+	edited := NewSeriesFooter1WithUuid(
+		series[0].Uuid(),
+		series[0].HeadRecordTime(),
+		series[0].TailRecordTime(),
+		series[0].RecordCount(),
+		sourceSha1)
+
+	rws := rifs.NewSeekableBufferWithBytes(raw)
+
+	totalSize, err := RewriteSeriesFooter(rws, edited)
+	log.PanicIf(err)
+
+	if totalSize != 578 {
+		t.Fatalf("Total stream size not correct: (%d)", totalSize)
+	}
+
+	finalRaw := rws.Bytes()
+
+	if len(finalRaw) != totalSize {
+		t.Fatalf("Stream not the right size: (%d)", len(finalRaw))
+	}
+
+	footers, data := readTestStreamSeries(finalRaw)
+
+	if bytes.Compare(footers[0].SourceSha1(), sourceSha1) != 0 {
+		t.Fatalf("SHA1 not updated: %v", footers[0].SourceSha1())
+	} else if bytes.Compare(data[0], TestTimeSeriesData) != 0 {
+		t.Fatalf("First series data not correct: %v", data[0])
+	} else if footers[1].Uuid() != series[1].Uuid() {
+		t.Fatalf("Second series not correct.")
+	} else if bytes.Compare(data[1], TestTimeSeriesData2) != 0 {
+		t.Fatalf("Second series data not correct: %v", data[1])
+	}
+}
+
+func TestRewriteSeriesFooter_GrowLast(t *testing.T) {
+	raw, series, _ := WriteTestMultiseriesStream()
+
+	edited := NewSeriesFooter1WithUuid(
+		series[1].Uuid(),
+		series[1].HeadRecordTime(),
+		series[1].TailRecordTime(),
+		series[1].RecordCount(),
+		[]byte("a much longer source SHA1"))
+
+	rws := rifs.NewSeekableBufferWithBytes(raw)
+
+	totalSize, err := RewriteSeriesFooter(rws, edited)
+	log.PanicIf(err)
+
+	if totalSize != 578 {
+		t.Fatalf("Total stream size not correct: (%d)", totalSize)
+	}
+
+	footers, data := readTestStreamSeries(rws.Bytes())
+
+	if string(footers[1].SourceSha1()) != "a much longer source SHA1" {
+		t.Fatalf("SHA1 not updated: %v", footers[1].SourceSha1())
+	} else if bytes.Compare(data[0], TestTimeSeriesData) != 0 {
+		t.Fatalf("First series data not correct: %v", data[0])
+	} else if bytes.Compare(data[1], TestTimeSeriesData2) != 0 {
+		t.Fatalf("Second series data not correct: %v", data[1])
+	}
+}
+
+func TestRewriteSeriesFooter_NotFound(t *testing.T) {
+	raw, series, _ := WriteTestMultiseriesStream()
+
+	edited := NewSeriesFooter1(
+		series[0].HeadRecordTime(),
+		series[0].TailRecordTime(),
+		series[0].RecordCount(),
+		series[0].SourceSha1())
+
+	rws := rifs.NewSeekableBufferWithBytes(raw)
+
+	_, err := RewriteSeriesFooter(rws, edited)
+	if err == nil {
+		t.Fatalf("Expected failure for unknown series.")
+	}
+}
+
+func TestMoveStreamBytes(t *testing.T) {
+	rws := rifs.NewSeekableBufferWithBytes([]byte("0123456789"))
+
+	err := moveStreamBytes(rws, 2, 4, 5)
+	log.PanicIf(err)
+
+	if string(rws.Bytes()) != "0123234569" {
+		t.Fatalf("Move toward back not correct: [%s]", rws.Bytes())
+	}
+
+	rws = rifs.NewSeekableBufferWithBytes([]byte("0123456789"))
+
+	err = moveStreamBytes(rws, 4, 1, 5)
+	log.PanicIf(err)
+
+	if string(rws.Bytes()) != "0456786789" {
+		t.Fatalf("Move toward front not correct: [%s]", rws.Bytes())
+	}
+}
@@ -0,0 +1,283 @@
+package timetogo
+
+import (
+	"bytes"
+	"sort"
+
+	"github.com/dsoprea/go-logging"
+)
+
+const (
+	// DefaultMaxFragmentation is a reasonable threshold for
+	// `Updater.SetFreeSpaceReuse`.
+	DefaultMaxFragmentation = 0.25
+)
+
+// normalizeFreeRegions sorts the regions and coalesces any that are adjacent
+// or overlap. Empty regions are dropped.
+func normalizeFreeRegions(freeRegions []FreeRegion) []FreeRegion {
+	sorted := make([]FreeRegion, 0, len(freeRegions))
+	for _, fr := range freeRegions {
+		if fr.Length > 0 {
+			sorted = append(sorted, fr)
+		}
+	}
+
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].AbsolutePosition < sorted[j].AbsolutePosition
+	})
+
+	normalized := make([]FreeRegion, 0, len(sorted))
+	for _, fr := range sorted {
+		if len(normalized) > 0 {
+			last := &normalized[len(normalized)-1]
+
+			if lastEnd := last.AbsolutePosition + last.Length; fr.AbsolutePosition <= lastEnd {
+				if end := fr.AbsolutePosition + fr.Length; end > lastEnd {
+					last.Length = end - last.AbsolutePosition
+				}
+
+				continue
+			}
+		}
+
+		normalized = append(normalized, fr)
+	}
+
+	return normalized
+}
+
+// occupiedRegion is a range of bytes used by one series.
+type occupiedRegion struct {
+	position int64
+	size     int64
+}
+
+// findFreeRegions returns the gaps between the given series and the end of
+// the last one.
+func findFreeRegions(occupied []occupiedRegion) (freeRegions []FreeRegion, dataEnd int64) {
+	sorted := make([]occupiedRegion, len(occupied))
+	copy(sorted, occupied)
+
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].position < sorted[j].position
+	})
+
+	freeRegions = make([]FreeRegion, 0)
+	for _, region := range sorted {
+		if region.position > dataEnd {
+			fr := FreeRegion{
+				AbsolutePosition: dataEnd,
+				Length:           region.position - dataEnd,
+			}
+
+			freeRegions = append(freeRegions, fr)
+		}
+
+		if end := region.position + region.size; end > dataEnd {
+			dataEnd = end
+		}
+	}
+
+	return freeRegions, dataEnd
+}
+
+// freeSpaceFragmentation returns the fraction of the stream, up to the end of
+// the last series, that is free.
+func freeSpaceFragmentation(freeRegions []FreeRegion, dataEnd int64) float64 {
+	if dataEnd == 0 {
+		return 0
+	}
+
+	free := int64(0)
+	for _, fr := range freeRegions {
+		free += fr.Length
+	}
+
+	return float64(free) / float64(dataEnd)
+}
+
+// retainedSeries returns the existing series that will be kept as they are.
+func (updater *Updater) retainedSeries() (retained []currentPersistedSeries) {
+	retained = make([]currentPersistedSeries, 0)
+	for _, seriesFooter := range updater.newSeries {
+		sik := updateSeriesIndexingKey(seriesFooter)
+		if cps, found := updater.knownSeriesIndex[sik]; found == true {
+			retained = append(retained, cps)
+		}
+	}
+
+	return retained
+}
+
+// retainedFreeRegions returns the gaps between the series that will be kept.
+func (updater *Updater) retainedFreeRegions() (freeRegions []FreeRegion, dataEnd int64) {
+	retained := updater.retainedSeries()
+
+	occupied := make([]occupiedRegion, len(retained))
+	for i, cps := range retained {
+		occupied[i] = occupiedRegion{
+			position: cps.FilePosition,
+			size:     int64(cps.TotalSeriesSize),
+		}
+	}
+
+	return findFreeRegions(occupied)
+}
+
+// writeReusingFreeSpace leaves all retained series where they are and writes
+// new and changed series into the first free region that they fit in (or at
+// the end). The series are encoded and written one at a time so that only one
+// is buffered at once. The remaining free regions are recorded in the stream
+// footer. The series are listed in the stream footer in the order that they
+// are in the stream. If nothing was added, replaced, or dropped, nothing is
+// written.
+func (updater *Updater) writeReusingFreeSpace() (totalSize int, stats UpdateStats, err error) {
+	defer func() {
+		if state := recover(); state != nil {
+			err = log.Wrap(state.(error))
+		}
+	}()
+
+	freeRegions, dataEnd := updater.retainedFreeRegions()
+
+	hitsReplaced := 0
+	for _, seriesFooter := range updater.newSeries {
+		sik := updateSeriesIndexingKey(seriesFooter)
+		if _, isExisting := updater.knownSeriesIndex[sik]; isExisting == true {
+			stats.Skips++
+		} else if _, isReplacement := updater.knownSeriesByUuid[seriesFooter.Uuid()]; isReplacement == true {
+			hitsReplaced++
+			stats.Replaces++
+		} else {
+			stats.Adds++
+		}
+	}
+
+	stats.Drops = len(updater.knownSeriesIndex) - stats.Skips - hitsReplaced
+
+	if stats.Adds == 0 && stats.Replaces == 0 && stats.Drops == 0 {
+		updaterLogger.Debugf(nil, "writeReusingFreeSpace: No changes were made in the update. Not updating the stream footer.")
+
+		err := updater.sr.Reset()
+		log.PanicIf(err)
+
+		_, _, footerBytes, footerOffset, err := updater.sr.readOneFooter()
+		log.PanicIf(err)
+
+		totalSize = int(footerOffset) + len(footerBytes) + ShadowFooterSize
+
+		return totalSize, stats, nil
+	}
+
+	sb := updater.sb
+
+	// Record the retained series first so that each new series is checked
+	// against all of them by the overlap policy.
+
+	for _, cps := range updater.retainedSeries() {
+		sb.addRetainedSeries(cps.FilePosition+int64(cps.TotalSeriesSize)-1, cps.SeriesFooter)
+	}
+
+	for _, seriesFooter := range updater.newSeries {
+		sik := updateSeriesIndexingKey(seriesFooter)
+		if _, isExisting := updater.knownSeriesIndex[sik]; isExisting == true {
+			continue
+		}
+
+		if cps, isReplacement := updater.knownSeriesByUuid[seriesFooter.Uuid()]; isReplacement == true {
+			carryCreatedTime(seriesFooter, cps.SeriesFooter.CreatedTime())
+		}
+
+		if updater.seriesDataWriter == nil {
+			log.Panicf("data needed for series [%s] but no data-writer was provided", seriesFooter.Uuid())
+		}
+
+		seriesFooter.TouchUpdatedTime()
+
+		err := updater.placeSeries(seriesFooter, freeRegions, &dataEnd)
+		log.PanicIf(err)
+	}
+
+	sb.sortSeriesByPosition()
+
+	err = sb.seekTo(dataEnd)
+	log.PanicIf(err)
+
+	sb.setFreeRegions(normalizeFreeRegions(freeRegions))
+
+	totalSize, err = sb.Finish()
+	log.PanicIf(err)
+
+	if truncater, ok := updater.rws.(Truncater); ok == true {
+		updaterLogger.Debugf(nil, "Underlying RWS is also a truncater. Truncating stream to right size after update.")
+
+		err = truncater.Truncate(int64(totalSize))
+		log.PanicIf(err)
+	}
+
+	return totalSize, stats, nil
+}
+
+// placeSeries encodes the series (so that we know how big it is), writes it
+// into the first free region that it fits in (else at `dataEnd`), and updates
+// the free regions and `dataEnd` to match.
+func (updater *Updater) placeSeries(seriesFooter SeriesFooter, freeRegions []FreeRegion, dataEnd *int64) (err error) {
+	defer func() {
+		if state := recover(); state != nil {
+			err = log.Wrap(state.(error))
+		}
+	}()
+
+	es, err := encodeSeries(updater.seriesDataWriter, seriesFooter, DefaultSpillThreshold)
+	log.PanicIf(err)
+
+	defer es.buffer.Close()
+
+	seriesFooter.SetBytesLength(es.dataSize)
+
+	footerWriter := NewStreamWriter(new(bytes.Buffer))
+
+	footerSize, err := footerWriter.writeSeriesFooter1(seriesFooter, es.fnvChecksum)
+	log.PanicIf(err)
+
+	size := int64(es.dataSize) + int64(footerSize)
+
+	position := int64(-1)
+	for i, fr := range freeRegions {
+		if fr.Length < size {
+			continue
+		}
+
+		position = fr.AbsolutePosition
+
+		freeRegions[i].AbsolutePosition += size
+		freeRegions[i].Length -= size
+
+		break
+	}
+
+	if position == -1 {
+		position = *dataEnd
+		*dataEnd += size
+	}
+
+	updaterLogger.Debugf(nil, "placeSeries: Placing series [%s] of size (%d) at position (%d).", seriesFooter.Uuid(), size, position)
+
+	sb := updater.sb
+
+	err = sb.seekTo(position)
+	log.PanicIf(err)
+
+	r, err := es.buffer.Reader()
+	log.PanicIf(err)
+
+	err = sb.addEncodedSeries(r, es.dataSize, es.fnvChecksum, seriesFooter)
+	log.PanicIf(err)
+
+	if sb.NextOffset() != position+size {
+		log.Panicf("series [%s] was not the expected size: (%d) != (%d)", seriesFooter.Uuid(), sb.NextOffset()-position, size)
+	}
+
+	return nil
+}
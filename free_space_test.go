@@ -0,0 +1,293 @@
+package timetogo
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"reflect"
+	"testing"
+
+	"github.com/dsoprea/go-logging"
+	"github.com/randomingenuity/go-utility/filesystem"
+)
+
+func TestNormalizeFreeRegions(t *testing.T) {
+	freeRegions := []FreeRegion{
+		{AbsolutePosition: 100, Length: 10},
+		{AbsolutePosition: 0, Length: 10},
+		{AbsolutePosition: 10, Length: 5},
+		{AbsolutePosition: 50, Length: 0},
+		{AbsolutePosition: 105, Length: 20},
+	}
+
+	normalized := normalizeFreeRegions(freeRegions)
+
+	expected := []FreeRegion{
+		{AbsolutePosition: 0, Length: 15},
+		{AbsolutePosition: 100, Length: 25},
+	}
+
+	if reflect.DeepEqual(normalized, expected) != true {
+		t.Fatalf("Normalized regions not correct: %v", normalized)
+	}
+}
+
+// writeTestFreeSpaceStream writes three series and returns the raw stream and
+// the data position and total size of each.
+func writeTestFreeSpaceStream() (raw []byte, footers []*SeriesFooter1, data [][]byte, positions []int64, sizes []int64) {
+	footers, data = getTestParallelSeries(3)
+
+	raw = writeTestMergeStream(data, footers)
+
+	it, err := NewIterator(NewStreamReader(bytes.NewReader(raw)))
+	log.PanicIf(err)
+
+	positions = make([]int64, it.Count())
+	sizes = make([]int64, it.Count())
+
+	previousEnd := int64(0)
+	for i := 0; i < it.Count(); i++ {
+		end := it.SeriesInfo(i).AbsolutePosition() + 1
+
+		positions[i] = previousEnd
+		sizes[i] = end - previousEnd
+
+		previousEnd = end
+	}
+
+	return raw, footers, data, positions, sizes
+}
+
+func TestUpdater_Write_FreeSpaceReuse(t *testing.T) {
+	raw, footers, data, positions, sizes := writeTestFreeSpaceStream()
+
+	originalRaw := make([]byte, len(raw))
+	copy(originalRaw, raw)
+
+	// Drop the first series and add a smaller one that will fit in its place.
+	// The footer will be the same size, so the new series will be four bytes
+	// smaller.
+
+	newFooters, _ := getTestParallelSeries(1)
+	newFooter := newFooters[0]
+	newData := []byte("small data")
+
+	sdtg := &SeriesDataTestGenerator{
+		data: map[string]io.Reader{
+			newFooter.Uuid(): bytes.NewBuffer(newData),
+		},
+	}
+
+	rws := rifs.NewSeekableBufferWithBytes(raw)
+
+	updater := NewUpdater(rws, sdtg)
+	updater.SetFreeSpaceReuse(0.5)
+
+	updater.AddSeries(footers[1])
+	updater.AddSeries(footers[2])
+	updater.AddSeries(newFooter)
+
+	totalSize, stats, err := updater.Write()
+	log.PanicIf(err)
+
+	if stats != (UpdateStats{Skips: 2, Adds: 1, Drops: 1}) {
+		t.Fatalf("Stats not correct: %s", stats)
+	}
+
+	finalRaw := rws.Bytes()[:totalSize]
+
+	// The retained series should not have moved.
+
+	retainedEnd := positions[2] + sizes[2]
+	if bytes.Compare(finalRaw[positions[1]:retainedEnd], originalRaw[positions[1]:retainedEnd]) != 0 {
+		t.Fatalf("Retained series were moved or modified.")
+	}
+
+	readFooters, readData := readTestStreamSeries(finalRaw)
+
+	if len(readFooters) != 3 {
+		t.Fatalf("Series count not correct: (%d)", len(readFooters))
+	} else if readFooters[0].Uuid() != newFooter.Uuid() || readFooters[1].Uuid() != footers[1].Uuid() || readFooters[2].Uuid() != footers[2].Uuid() {
+		t.Fatalf("Series not in stream order.")
+	} else if bytes.Compare(readData[0], newData) != 0 {
+		t.Fatalf("New series data not correct.")
+	} else if bytes.Compare(readData[1], data[1]) != 0 || bytes.Compare(readData[2], data[2]) != 0 {
+		t.Fatalf("Retained series data not correct.")
+	}
+
+	it, err := NewIterator(NewStreamReader(bytes.NewReader(finalRaw)))
+	log.PanicIf(err)
+
+	expectedFreeRegions := []FreeRegion{
+		{AbsolutePosition: sizes[0] - 4, Length: 4},
+	}
+
+	if reflect.DeepEqual(it.FreeRegions(), expectedFreeRegions) != true {
+		t.Fatalf("Free regions not correct: %v", it.FreeRegions())
+	}
+}
+
+func TestUpdater_Write_FreeSpaceReuse_DoesNotFit(t *testing.T) {
+	raw, footers, data, _, sizes := writeTestFreeSpaceStream()
+
+	newFooters, _ := getTestParallelSeries(1)
+	newFooter := newFooters[0]
+	newData := bytes.Repeat([]byte("large data "), 10)
+
+	sdtg := &SeriesDataTestGenerator{
+		data: map[string]io.Reader{
+			newFooter.Uuid(): bytes.NewBuffer(newData),
+		},
+	}
+
+	rws := rifs.NewSeekableBufferWithBytes(raw)
+
+	updater := NewUpdater(rws, sdtg)
+	updater.SetFreeSpaceReuse(0.5)
+
+	updater.AddSeries(footers[1])
+	updater.AddSeries(footers[2])
+	updater.AddSeries(newFooter)
+
+	totalSize, _, err := updater.Write()
+	log.PanicIf(err)
+
+	finalRaw := rws.Bytes()[:totalSize]
+
+	readFooters, readData := readTestStreamSeries(finalRaw)
+
+	if readFooters[0].Uuid() != footers[1].Uuid() || readFooters[1].Uuid() != footers[2].Uuid() || readFooters[2].Uuid() != newFooter.Uuid() {
+		t.Fatalf("Series not in stream order.")
+	} else if bytes.Compare(readData[2], newData) != 0 || bytes.Compare(readData[0], data[1]) != 0 {
+		t.Fatalf("Series data not correct.")
+	}
+
+	it, err := NewIterator(NewStreamReader(bytes.NewReader(finalRaw)))
+	log.PanicIf(err)
+
+	expectedFreeRegions := []FreeRegion{
+		{AbsolutePosition: 0, Length: sizes[0]},
+	}
+
+	if reflect.DeepEqual(it.FreeRegions(), expectedFreeRegions) != true {
+		t.Fatalf("Free regions not correct: %v", it.FreeRegions())
+	}
+}
+
+func TestUpdater_Write_FreeSpaceReuse_Compact(t *testing.T) {
+	raw, footers, data, _, sizes := writeTestFreeSpaceStream()
+
+	rws := rifs.NewSeekableBufferWithBytes(raw)
+
+	// The hole left by the first series is more than 10% of the stream, so
+	// the stream should be compacted.
+
+	updater := NewUpdater(rws, nil)
+	updater.SetFreeSpaceReuse(0.1)
+
+	updater.AddSeries(footers[1])
+	updater.AddSeries(footers[2])
+
+	totalSize, stats, err := updater.Write()
+	log.PanicIf(err)
+
+	if stats != (UpdateStats{Skips: 2, Drops: 1}) {
+		t.Fatalf("Stats not correct: %s", stats)
+	} else if int64(totalSize) >= int64(len(raw))-sizes[0] {
+		t.Fatalf("Stream was not compacted: (%d)", totalSize)
+	}
+
+	finalRaw := rws.Bytes()[:totalSize]
+
+	readFooters, readData := readTestStreamSeries(finalRaw)
+
+	if len(readFooters) != 2 || readFooters[0].Uuid() != footers[1].Uuid() || readFooters[1].Uuid() != footers[2].Uuid() {
+		t.Fatalf("Series not correct.")
+	} else if bytes.Compare(readData[0], data[1]) != 0 || bytes.Compare(readData[1], data[2]) != 0 {
+		t.Fatalf("Series data not correct.")
+	}
+
+	it, err := NewIterator(NewStreamReader(bytes.NewReader(finalRaw)))
+	log.PanicIf(err)
+
+	if len(it.FreeRegions()) != 0 {
+		t.Fatalf("Compacted stream should not have free regions: %v", it.FreeRegions())
+	}
+}
+
+// testWriteFailingBuffer fails any write, to show that nothing is written.
+type testWriteFailingBuffer struct {
+	*rifs.SeekableBuffer
+}
+
+func (twfb testWriteFailingBuffer) Write(p []byte) (n int, err error) {
+	return 0, errors.New("unexpected write")
+}
+
+func TestUpdater_Write_FreeSpaceReuse_NoChanges(t *testing.T) {
+	raw, footers, _, _, _ := writeTestFreeSpaceStream()
+
+	rws := testWriteFailingBuffer{rifs.NewSeekableBufferWithBytes(raw)}
+
+	updater := NewUpdater(rws, nil)
+	updater.SetFreeSpaceReuse(0.5)
+
+	for _, sf := range footers {
+		updater.AddSeries(sf)
+	}
+
+	totalSize, stats, err := updater.Write()
+	log.PanicIf(err)
+
+	if stats != (UpdateStats{Skips: 3}) {
+		t.Fatalf("Stats not correct: %s", stats)
+	} else if totalSize != len(raw) {
+		t.Fatalf("Total size not correct: (%d) != (%d)", totalSize, len(raw))
+	}
+}
+
+func TestUpdater_Write_FreeSpaceReuse_MultipleNew(t *testing.T) {
+	raw, footers, data, _, _ := writeTestFreeSpaceStream()
+
+	// Drop the first series and add two small ones. The first one added fits
+	// in its place and the second goes at the end.
+
+	newFooters, _ := getTestParallelSeries(2)
+	newData := [][]byte{[]byte("aa"), []byte("bb")}
+
+	sdtg := &SeriesDataTestGenerator{
+		data: map[string]io.Reader{
+			newFooters[0].Uuid(): bytes.NewBuffer(newData[0]),
+			newFooters[1].Uuid(): bytes.NewBuffer(newData[1]),
+		},
+	}
+
+	rws := rifs.NewSeekableBufferWithBytes(raw)
+
+	updater := NewUpdater(rws, sdtg)
+	updater.SetFreeSpaceReuse(0.5)
+
+	updater.AddSeries(footers[1])
+	updater.AddSeries(footers[2])
+	updater.AddSeries(newFooters[1])
+	updater.AddSeries(newFooters[0])
+
+	totalSize, stats, err := updater.Write()
+	log.PanicIf(err)
+
+	if stats != (UpdateStats{Skips: 2, Adds: 2, Drops: 1}) {
+		t.Fatalf("Stats not correct: %s", stats)
+	}
+
+	readFooters, readData := readTestStreamSeries(rws.Bytes()[:totalSize])
+
+	if len(readFooters) != 4 {
+		t.Fatalf("Series count not correct: (%d)", len(readFooters))
+	} else if readFooters[0].Uuid() != newFooters[1].Uuid() || readFooters[1].Uuid() != footers[1].Uuid() || readFooters[2].Uuid() != footers[2].Uuid() || readFooters[3].Uuid() != newFooters[0].Uuid() {
+		t.Fatalf("Series not in stream order.")
+	} else if bytes.Compare(readData[0], newData[1]) != 0 || bytes.Compare(readData[3], newData[0]) != 0 {
+		t.Fatalf("New series data not correct.")
+	} else if bytes.Compare(readData[1], data[1]) != 0 || bytes.Compare(readData[2], data[2]) != 0 {
+		t.Fatalf("Retained series data not correct.")
+	}
+}
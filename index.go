@@ -15,6 +15,7 @@ type Index struct {
 	sr         *StreamReader
 	seriesInfo []StreamIndexedSequenceInfo
 	intervals  timeindex.TimeIntervalSlice
+	byUuid     map[string]StreamIndexedSequenceInfo
 }
 
 // NewIndex returns a new `Index` struct.
@@ -31,12 +32,15 @@ func NewIndex(rs io.ReadSeeker) (index *Index, err error) {
 	seriesInfo := streamFooter.Series()
 
 	intervals := make(timeindex.TimeIntervalSlice, 0)
+	byUuid := make(map[string]StreamIndexedSequenceInfo)
 	for _, sisi := range seriesInfo {
 		intervals =
 			intervals.Add(
 				sisi.HeadRecordTime(),
 				sisi.TailRecordTime(),
 				sisi)
+
+		byUuid[sisi.Uuid()] = sisi
 	}
 
 	index = &Index{
@@ -44,6 +48,7 @@ func NewIndex(rs io.ReadSeeker) (index *Index, err error) {
 		sr:         sr,
 		seriesInfo: seriesInfo,
 		intervals:  intervals,
+		byUuid:     byUuid,
 	}
 
 	return index, nil
@@ -68,4 +73,47 @@ func (index *Index) GetWithTimestamp(timestamp time.Time) (matched []StreamIndex
 	return matched, nil
 }
 
+// GetWithUuid returns the series with the given UUID.
+func (index *Index) GetWithUuid(uuid string) (sisi StreamIndexedSequenceInfo, found bool) {
+	sisi, found = index.byUuid[uuid]
+	return sisi, found
+}
+
+// seriesIntersectsRange returns true if the series may have records in the
+// given range (inclusive). The footers only store whole seconds (floored), so
+// the last record may be anywhere in the second after the stored tail time.
+func seriesIntersectsRange(sisi StreamIndexedSequenceInfo, start, end time.Time) bool {
+	if sisi.HeadRecordTime().After(end) == true {
+		return false
+	}
+
+	return sisi.TailRecordTime().Add(time.Second).After(start)
+}
+
+// GetWithRange returns all series whose time range intersects the given
+// range (inclusive), in stream order.
+func (index *Index) GetWithRange(start, end time.Time) (matched []StreamIndexedSequenceInfo) {
+	matched = make([]StreamIndexedSequenceInfo, 0)
+	for _, sisi := range index.seriesInfo {
+		if seriesIntersectsRange(sisi, start, end) == false {
+			continue
+		}
+
+		matched = append(matched, sisi)
+	}
+
+	return matched
+}
+
+// Series returns the summary info for all series in stream order.
+func (index *Index) Series() []StreamIndexedSequenceInfo {
+	return index.seriesInfo
+}
+
+// TimeRangeReport returns the inverted ranges, overlaps, and any gaps larger
+// than `maxGap` between the series in the stream.
+func (index *Index) TimeRangeReport(maxGap time.Duration) TimeRangeReport {
+	return analyzeTimeRanges(index.seriesInfo, maxGap)
+}
+
 // TODO(dustin): !! Rename StreamIndexedSequenceInfo to StreamIndexedSeriesInfo
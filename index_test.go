@@ -134,3 +134,122 @@ func ExampleIndex_GetWithTimestamp() {
 	//
 	// MATCHED: d095abf5-126e-48a7-8974-885de92bd964
 }
+
+func TestIndex_TimeRangeReport(t *testing.T) {
+	raw, footers, _ := WriteTestMultiseriesStream()
+
+	r := bytes.NewReader(raw)
+
+	index, err := NewIndex(r)
+	log.PanicIf(err)
+
+	report := index.TimeRangeReport(time.Second)
+
+	if len(report.Overlaps) != 1 {
+		t.Fatalf("Exactly one overlap not found: %s", report)
+	} else if len(report.Gaps) != 0 || len(report.Inverted) != 0 {
+		t.Fatalf("Unexpected gaps or inversions: %s", report)
+	}
+
+	so := report.Overlaps[0]
+
+	if so.First.Uuid() != footers[0].Uuid() || so.Second.Uuid() != footers[1].Uuid() {
+		t.Fatalf("Overlap not between the right series: %s", so)
+	} else if so.From != footers[1].HeadRecordTime() || so.To != footers[0].TailRecordTime() {
+		t.Fatalf("Overlap range not correct: %s", so)
+	}
+}
+
+func TestIndex_GetWithUuid(t *testing.T) {
+	raw, footers, _ := WriteTestMultiseriesStream()
+
+	index, err := NewIndex(bytes.NewReader(raw))
+	log.PanicIf(err)
+
+	sisi, found := index.GetWithUuid(footers[1].Uuid())
+	if found != true {
+		t.Fatalf("Series not found.")
+	} else if sisi.HeadRecordTime() != footers[1].HeadRecordTime() {
+		t.Fatalf("Series not correct: %s", sisi)
+	}
+
+	_, found = index.GetWithUuid("invalid")
+	if found != false {
+		t.Fatalf("Expected miss.")
+	}
+}
+
+func TestIndex_GetWithRange(t *testing.T) {
+	raw, footers, _ := WriteTestMultiseriesStream()
+
+	index, err := NewIndex(bytes.NewReader(raw))
+	log.PanicIf(err)
+
+	// Only the second series extends past (12:35:16).
+
+	start := time.Date(2016, 10, 1, 12, 35, 20, 0, time.UTC)
+	end := time.Date(2016, 10, 1, 13, 0, 0, 0, time.UTC)
+
+	matched := index.GetWithRange(start, end)
+
+	if len(matched) != 1 {
+		t.Fatalf("Exactly one series not matched: (%d)", len(matched))
+	} else if matched[0].Uuid() != footers[1].Uuid() {
+		t.Fatalf("Wrong series matched.")
+	}
+
+	// Both.
+
+	start = time.Date(2016, 10, 1, 0, 0, 0, 0, time.UTC)
+
+	matched = index.GetWithRange(start, end)
+
+	if len(matched) != 2 {
+		t.Fatalf("Both series not matched: (%d)", len(matched))
+	}
+
+	// Neither.
+
+	end = time.Date(2016, 10, 1, 12, 0, 0, 0, time.UTC)
+
+	matched = index.GetWithRange(start, end)
+
+	if len(matched) != 0 {
+		t.Fatalf("Expected no matches: (%d)", len(matched))
+	}
+}
+
+func TestIndex_GetWithRange_SubsecondTail(t *testing.T) {
+	headRecordTime := time.Date(2016, 10, 1, 12, 34, 56, 0, time.UTC)
+
+	// The tail is stored as (12:35:06) but the last record is at
+	// (12:35:06.7).
+
+	sf := NewSeriesFooter1(headRecordTime, headRecordTime.Add(time.Second*10+time.Millisecond*700), 22, []byte{11, 22, 33})
+
+	b := rifs.NewSeekableBuffer()
+	sb := NewStreamBuilder(b)
+
+	err := sb.AddSeries(bytes.NewBuffer(TestTimeSeriesData), sf)
+	log.PanicIf(err)
+
+	_, err = sb.Finish()
+	log.PanicIf(err)
+
+	index, err := NewIndex(b)
+	log.PanicIf(err)
+
+	start := headRecordTime.Add(time.Second*10 + time.Millisecond*500)
+
+	matched := index.GetWithRange(start, start.Add(time.Hour))
+	if len(matched) != 1 {
+		t.Fatalf("Series with a sub-second tail not matched: (%d)", len(matched))
+	}
+
+	// The whole second after the tail is past it.
+
+	matched = index.GetWithRange(headRecordTime.Add(time.Second*11), start.Add(time.Hour))
+	if len(matched) != 0 {
+		t.Fatalf("Expected no matches: (%d)", len(matched))
+	}
+}
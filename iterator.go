@@ -10,6 +10,7 @@ import (
 type Iterator struct {
 	sr            *StreamReader
 	seriesInfo    []StreamIndexedSequenceInfo
+	freeRegions   []FreeRegion
 	currentSeries int
 }
 
@@ -30,6 +31,11 @@ func (it *Iterator) SeriesInfo(i int) StreamIndexedSequenceInfo {
 	return it.seriesInfo[i]
 }
 
+// FreeRegions returns the unused regions recorded in the stream footer.
+func (it *Iterator) FreeRegions() []FreeRegion {
+	return it.freeRegions
+}
+
 // NewIterator returns an `Iterator` struct.
 func NewIterator(sr *StreamReader) (it *Iterator, err error) {
 	defer func() {
@@ -61,6 +67,7 @@ func NewIterator(sr *StreamReader) (it *Iterator, err error) {
 	it = &Iterator{
 		sr:            sr,
 		seriesInfo:    seriesInfo,
+		freeRegions:   streamFooterFreeRegions(streamFooter),
 		currentSeries: len(seriesInfo) - 1,
 	}
 
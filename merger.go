@@ -0,0 +1,208 @@
+package timetogo
+
+import (
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/dsoprea/go-logging"
+	"github.com/google/uuid"
+)
+
+var (
+	mergerLogger = log.NewLogger("timetogo.merger")
+)
+
+var (
+	// ErrDuplicateSeries indicates that the same series UUID was found in more
+	// than one place.
+	ErrDuplicateSeries = errors.New("duplicate series UUID")
+)
+
+// DuplicatePolicy determines how series with the same UUID in more than one
+// source are resolved.
+type DuplicatePolicy int
+
+const (
+	// DpNewestWins keeps only the series with the latest updated-time. If they
+	// are the same, the first one encountered is kept.
+	DpNewestWins DuplicatePolicy = iota
+
+	// DpFail fails the merge.
+	DpFail DuplicatePolicy = iota
+
+	// DpKeepBoth keeps every copy. All but the first are assigned new UUIDs.
+	DpKeepBoth DuplicatePolicy = iota
+)
+
+// MergeStats keeps a tally of what was done during a merge.
+type MergeStats struct {
+	// Copied is the number of series written.
+	Copied int
+
+	// Dropped is the number of duplicates that were not written.
+	Dropped int
+
+	// Renamed is the number of duplicates that were written with a new UUID.
+	Renamed int
+}
+
+func (ms MergeStats) String() string {
+	return fmt.Sprintf("MergeStats<COPIED=(%d) DROPPED=(%d) RENAMED=(%d)>", ms.Copied, ms.Dropped, ms.Renamed)
+}
+
+// mergeSource is one of the streams being merged.
+type mergeSource struct {
+	rs         io.ReadSeeker
+	sr         *StreamReader
+	seriesInfo []StreamIndexedSequenceInfo
+	footers    []SeriesFooter
+}
+
+// Merger copies the series from several streams into one without decoding
+// the series data. Series are written in the order that the sources were
+// added and then in stream order within each source. Checksums are verified
+// as the data is copied.
+type Merger struct {
+	policy  DuplicatePolicy
+	sources []io.ReadSeeker
+}
+
+// NewMerger returns a new `Merger` struct.
+func NewMerger(policy DuplicatePolicy) *Merger {
+	return &Merger{
+		policy:  policy,
+		sources: make([]io.ReadSeeker, 0),
+	}
+}
+
+// AddSource adds a stream to be merged. Empty streams are allowed.
+func (merger *Merger) AddSource(rs io.ReadSeeker) {
+	merger.sources = append(merger.sources, rs)
+}
+
+// loadSources reads the footers of every series in every source.
+func (merger *Merger) loadSources() (sources []mergeSource, err error) {
+	defer func() {
+		if state := recover(); state != nil {
+			err = log.Wrap(state.(error))
+		}
+	}()
+
+	sources = make([]mergeSource, 0, len(merger.sources))
+	for _, rs := range merger.sources {
+		sr := NewStreamReader(rs)
+
+		it, err := NewIterator(sr)
+		if err != nil {
+			if err == io.EOF {
+				continue
+			}
+
+			log.Panic(err)
+		}
+
+		ms := mergeSource{
+			rs:         rs,
+			sr:         sr,
+			seriesInfo: make([]StreamIndexedSequenceInfo, it.Count()),
+			footers:    make([]SeriesFooter, it.Count()),
+		}
+
+		for i := 0; i < it.Count(); i++ {
+			sisi := it.SeriesInfo(i)
+
+			seriesFooter, _, _, err := sr.ReadSeriesInfoWithIndexedInfo(sisi)
+			log.PanicIf(err)
+
+			ms.seriesInfo[i] = sisi
+			ms.footers[i] = seriesFooter
+		}
+
+		sources = append(sources, ms)
+	}
+
+	return sources, nil
+}
+
+// Write copies all of the series into the given builder. The caller is
+// responsible for calling `Finish()` on the builder.
+func (merger *Merger) Write(sb *StreamBuilder) (stats MergeStats, err error) {
+	defer func() {
+		if state := recover(); state != nil {
+			err = log.Wrap(state.(error))
+		}
+	}()
+
+	sources, err := merger.loadSources()
+	log.PanicIf(err)
+
+	// Determine which copy of each series wins. The key is the source index
+	// and the series index.
+
+	winners := make(map[string][2]int)
+	for i, ms := range sources {
+		for j, seriesFooter := range ms.footers {
+			seriesUuid := seriesFooter.Uuid()
+
+			current, found := winners[seriesUuid]
+			if found == false {
+				winners[seriesUuid] = [2]int{i, j}
+				continue
+			}
+
+			if merger.policy == DpFail {
+				mergerLogger.Debugf(nil, "Series [%s] found in more than one place.", seriesUuid)
+				log.Panic(ErrDuplicateSeries)
+			} else if merger.policy == DpNewestWins {
+				currentFooter := sources[current[0]].footers[current[1]]
+				if seriesFooter.UpdatedTime().After(currentFooter.UpdatedTime()) == true {
+					winners[seriesUuid] = [2]int{i, j}
+				}
+			}
+		}
+	}
+
+	// Copy.
+
+	for i, ms := range sources {
+		for j, seriesFooter := range ms.footers {
+			seriesUuid := seriesFooter.Uuid()
+
+			var outputFooter SeriesFooter
+			if winner := winners[seriesUuid]; winner != [2]int{i, j} {
+				if merger.policy != DpKeepBoth {
+					mergerLogger.Debugf(nil, "Dropping older copy of series [%s].", seriesUuid)
+
+					stats.Dropped++
+					continue
+				}
+
+				renamed := NewSeriesFooter1WithUuid(
+					uuid.New().String(),
+					seriesFooter.HeadRecordTime(),
+					seriesFooter.TailRecordTime(),
+					seriesFooter.RecordCount(),
+					seriesFooter.SourceSha1())
+
+				// Keep the original times so that the copy isn't ranked as
+				// newer than it is by a later merge.
+
+				carryCreatedTime(renamed, seriesFooter.CreatedTime())
+				carryUpdatedTime(renamed, seriesFooter.UpdatedTime())
+
+				mergerLogger.Debugf(nil, "Keeping duplicate of series [%s] as [%s].", seriesUuid, renamed.Uuid())
+
+				outputFooter = renamed
+				stats.Renamed++
+			}
+
+			err := copySeriesVerified(ms.sr, ms.rs, ms.seriesInfo[j], sb, outputFooter)
+			log.PanicIf(err)
+
+			stats.Copied++
+		}
+	}
+
+	return stats, nil
+}
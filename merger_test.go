@@ -0,0 +1,197 @@
+package timetogo
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/dsoprea/go-logging"
+	"github.com/randomingenuity/go-utility/filesystem"
+)
+
+func writeTestMergeStream(seriesData [][]byte, footers []*SeriesFooter1) []byte {
+	b := rifs.NewSeekableBuffer()
+	sb := NewStreamBuilder(b)
+
+	for i, sf := range footers {
+		err := sb.AddSeries(bytes.NewBuffer(seriesData[i]), sf)
+		log.PanicIf(err)
+	}
+
+	_, err := sb.Finish()
+	log.PanicIf(err)
+
+	return b.Bytes()
+}
+
+func TestMerger_Write(t *testing.T) {
+	raw1, series, _ := WriteTestMultiseriesStream()
+
+	otherFooters, otherData := getTestParallelSeries(1)
+	raw2 := writeTestMergeStream(otherData, otherFooters)
+
+	merger := NewMerger(DpFail)
+	merger.AddSource(bytes.NewReader(raw1))
+	merger.AddSource(bytes.NewReader([]byte{}))
+	merger.AddSource(bytes.NewReader(raw2))
+
+	b := rifs.NewSeekableBuffer()
+	sb := NewStreamBuilder(b)
+
+	stats, err := merger.Write(sb)
+	log.PanicIf(err)
+
+	_, err = sb.Finish()
+	log.PanicIf(err)
+
+	if stats != (MergeStats{Copied: 3}) {
+		t.Fatalf("Stats not correct: %s", stats)
+	}
+
+	footers, data := readTestStreamSeries(b.Bytes())
+
+	if len(footers) != 3 {
+		t.Fatalf("Series count not correct: (%d)", len(footers))
+	} else if footers[0].Uuid() != series[0].Uuid() || footers[1].Uuid() != series[1].Uuid() || footers[2].Uuid() != otherFooters[0].Uuid() {
+		t.Fatalf("Series not in the right order.")
+	} else if bytes.Compare(data[0], TestTimeSeriesData) != 0 {
+		t.Fatalf("First series data not correct.")
+	} else if bytes.Compare(data[1], TestTimeSeriesData2) != 0 {
+		t.Fatalf("Second series data not correct.")
+	} else if bytes.Compare(data[2], otherData[0]) != 0 {
+		t.Fatalf("Third series data not correct.")
+	}
+}
+
+func TestMerger_Write_NewestWins(t *testing.T) {
+	raw1, series, _ := WriteTestMultiseriesStream()
+
+	newerData := []byte("newer data")
+
+	newerFooter := NewSeriesFooter1WithUuid(
+		series[0].Uuid(),
+		series[0].HeadRecordTime(),
+		series[0].TailRecordTime(),
+		series[0].RecordCount(),
+		[]byte{1, 2, 3})
+
+	// The updated-time is stored with a resolution of seconds, so make sure
+	// that the new copy is clearly later.
+	newerFooter.SetUpdatedTime(series[0].UpdatedTime().Add(time.Hour))
+
+	raw2 := writeTestMergeStream([][]byte{newerData}, []*SeriesFooter1{newerFooter})
+
+	merger := NewMerger(DpNewestWins)
+	merger.AddSource(bytes.NewReader(raw1))
+	merger.AddSource(bytes.NewReader(raw2))
+
+	b := rifs.NewSeekableBuffer()
+	sb := NewStreamBuilder(b)
+
+	stats, err := merger.Write(sb)
+	log.PanicIf(err)
+
+	_, err = sb.Finish()
+	log.PanicIf(err)
+
+	if stats != (MergeStats{Copied: 2, Dropped: 1}) {
+		t.Fatalf("Stats not correct: %s", stats)
+	}
+
+	footers, data := readTestStreamSeries(b.Bytes())
+
+	if len(footers) != 2 {
+		t.Fatalf("Series count not correct: (%d)", len(footers))
+	} else if footers[0].Uuid() != series[1].Uuid() {
+		t.Fatalf("First series not correct.")
+	} else if footers[1].Uuid() != series[0].Uuid() {
+		t.Fatalf("Second series not correct.")
+	} else if bytes.Compare(data[1], newerData) != 0 {
+		t.Fatalf("Newer copy was not kept: [%s]", string(data[1]))
+	}
+}
+
+func TestMerger_Write_Fail(t *testing.T) {
+	raw, _, _ := WriteTestMultiseriesStream()
+
+	merger := NewMerger(DpFail)
+	merger.AddSource(bytes.NewReader(raw))
+	merger.AddSource(bytes.NewReader(raw))
+
+	_, err := merger.Write(NewStreamBuilder(rifs.NewSeekableBuffer()))
+	if err == nil {
+		t.Fatalf("Expected failure for duplicate series.")
+	} else if log.Is(err, ErrDuplicateSeries) == false {
+		log.Panic(err)
+	}
+}
+
+func TestMerger_Write_KeepBoth(t *testing.T) {
+	_, series, _ := WriteTestMultiseriesStream()
+
+	// Give the series times that are clearly in the past so that we can tell
+	// whether the renamed copies kept them.
+
+	originalTime := time.Date(2016, 10, 1, 0, 0, 0, 0, time.UTC)
+
+	for _, sf := range series {
+		sf.SetCreatedTime(originalTime)
+		sf.SetUpdatedTime(originalTime)
+	}
+
+	raw := writeTestMergeStream([][]byte{TestTimeSeriesData, TestTimeSeriesData2}, series)
+
+	merger := NewMerger(DpKeepBoth)
+	merger.AddSource(bytes.NewReader(raw))
+	merger.AddSource(bytes.NewReader(raw))
+
+	b := rifs.NewSeekableBuffer()
+	sb := NewStreamBuilder(b)
+
+	stats, err := merger.Write(sb)
+	log.PanicIf(err)
+
+	_, err = sb.Finish()
+	log.PanicIf(err)
+
+	if stats != (MergeStats{Copied: 4, Renamed: 2}) {
+		t.Fatalf("Stats not correct: %s", stats)
+	}
+
+	footers, data := readTestStreamSeries(b.Bytes())
+
+	uuids := make(map[string]struct{})
+	for _, sf := range footers {
+		uuids[sf.Uuid()] = struct{}{}
+	}
+
+	if len(uuids) != 4 {
+		t.Fatalf("UUIDs not unique: %v", uuids)
+	} else if footers[2].Uuid() == series[0].Uuid() || footers[2].CreatedTime().Equal(series[0].CreatedTime()) == false {
+		t.Fatalf("Renamed series footer not correct.")
+	} else if footers[2].UpdatedTime().Equal(series[0].UpdatedTime()) == false {
+		t.Fatalf("Renamed series updated-time not retained: [%s] != [%s]", footers[2].UpdatedTime(), series[0].UpdatedTime())
+	} else if bytes.Compare(data[2], TestTimeSeriesData) != 0 || bytes.Compare(data[3], TestTimeSeriesData2) != 0 {
+		t.Fatalf("Renamed series data not correct.")
+	}
+}
+
+func TestMerger_Write_ChecksumMismatch(t *testing.T) {
+	raw, _, _ := WriteTestMultiseriesStream()
+
+	corrupted := make([]byte, len(raw))
+	copy(corrupted, raw)
+
+	// Corrupt the data of the first series.
+	corrupted[0] ^= 0xff
+
+	merger := NewMerger(DpFail)
+	merger.AddSource(bytes.NewReader(corrupted))
+
+	_, err := merger.Write(NewStreamBuilder(rifs.NewSeekableBuffer()))
+	if err == nil {
+		t.Fatalf("Expected failure for checksum mismatch.")
+	} else if log.Is(err, ErrSeriesChecksumMismatch) == false {
+		log.Panic(err)
+	}
+}
@@ -0,0 +1,372 @@
+package timetogo
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"sync"
+
+	"hash/fnv"
+	"io/ioutil"
+
+	"github.com/dsoprea/go-logging"
+)
+
+var (
+	parallelBuilderLogger = log.NewLogger("timetogo.parallel_builder")
+)
+
+const (
+	// DefaultSpillThreshold is the number of bytes of encoded series data
+	// that will be buffered in memory before spilling to a temporary file.
+	DefaultSpillThreshold = 16 * 1024 * 1024
+)
+
+// spillBuffer buffers data in memory until it reaches a threshold and then
+// moves it to a temporary file.
+type spillBuffer struct {
+	threshold int
+	b         *bytes.Buffer
+	f         *os.File
+}
+
+func newSpillBuffer(threshold int) *spillBuffer {
+	return &spillBuffer{
+		threshold: threshold,
+		b:         new(bytes.Buffer),
+	}
+}
+
+func (sb *spillBuffer) Write(data []byte) (n int, err error) {
+	defer func() {
+		if state := recover(); state != nil {
+			err = log.Wrap(state.(error))
+		}
+	}()
+
+	if sb.f == nil && sb.b.Len()+len(data) > sb.threshold {
+		f, err := ioutil.TempFile("", "timetogo.spill.")
+		log.PanicIf(err)
+
+		sb.f = f
+
+		_, err = sb.b.WriteTo(f)
+		log.PanicIf(err)
+
+		sb.b = nil
+	}
+
+	if sb.f != nil {
+		n, err = sb.f.Write(data)
+		log.PanicIf(err)
+	} else {
+		n, err = sb.b.Write(data)
+		log.PanicIf(err)
+	}
+
+	return n, nil
+}
+
+// Reader returns a reader for everything that was written.
+func (sb *spillBuffer) Reader() (r io.Reader, err error) {
+	defer func() {
+		if state := recover(); state != nil {
+			err = log.Wrap(state.(error))
+		}
+	}()
+
+	if sb.f == nil {
+		return sb.b, nil
+	}
+
+	_, err = sb.f.Seek(0, os.SEEK_SET)
+	log.PanicIf(err)
+
+	return sb.f, nil
+}
+
+// Close releases the temporary file, if one was created.
+func (sb *spillBuffer) Close() {
+	if sb.f != nil {
+		sb.f.Close()
+		os.Remove(sb.f.Name())
+
+		sb.f = nil
+	}
+}
+
+// encodedSeries is a series that has been encoded but not yet written.
+type encodedSeries struct {
+	sf          SeriesFooter
+	buffer      *spillBuffer
+	dataSize    uint64
+	fnvChecksum uint32
+}
+
+// ParallelStreamBuilder allows series to be encoded concurrently from multiple
+// goroutines. Each series is given a sequence number (starting at zero) and
+// the series are written to the underlying `StreamBuilder` strictly in that
+// order, so the resulting stream is identical to the one produced by adding
+// the same series to a `StreamBuilder` serially.
+//
+// At most `window` series may be in flight (encoded but not written) at once.
+// A call to `AddSeries` for a sequence number beyond the window blocks until
+// the earlier series have been written. Writes to the stream are serialized:
+// whichever goroutine adds the next series in sequence writes it and any that
+// follow it, and other goroutines can keep encoding and queueing series while
+// it does.
+type ParallelStreamBuilder struct {
+	sb *StreamBuilder
+
+	window         int
+	spillThreshold int
+
+	mutex        sync.Mutex
+	cond         *sync.Cond
+	nextSequence int
+	pending      map[int]*encodedSeries
+	writing      bool
+	err          error
+}
+
+// NewParallelStreamBuilder returns a new `ParallelStreamBuilder` struct. If
+// `spillThreshold` is zero, `DefaultSpillThreshold` will be used.
+func NewParallelStreamBuilder(ws io.WriteSeeker, window int, spillThreshold int) *ParallelStreamBuilder {
+	if window < 1 {
+		log.Panicf("window must be at least one")
+	}
+
+	if spillThreshold == 0 {
+		spillThreshold = DefaultSpillThreshold
+	}
+
+	psb := &ParallelStreamBuilder{
+		sb:             NewStreamBuilder(ws),
+		window:         window,
+		spillThreshold: spillThreshold,
+		pending:        make(map[int]*encodedSeries),
+	}
+
+	psb.cond = sync.NewCond(&psb.mutex)
+
+	return psb
+}
+
+// StreamBuilder returns the underlying `StreamBuilder` struct. It should only
+// be used for configuration before any series are added.
+func (psb *ParallelStreamBuilder) StreamBuilder() *StreamBuilder {
+	return psb.sb
+}
+
+// reserve waits until the given sequence is inside the window and then
+// reserves it.
+func (psb *ParallelStreamBuilder) reserve(sequence int) (err error) {
+	psb.mutex.Lock()
+	defer psb.mutex.Unlock()
+
+	for psb.err == nil && sequence >= psb.nextSequence+psb.window {
+		psb.cond.Wait()
+	}
+
+	if psb.err != nil {
+		return psb.err
+	}
+
+	if _, found := psb.pending[sequence]; found == true || sequence < psb.nextSequence {
+		return log.Errorf("series sequence (%d) was added more than once", sequence)
+	}
+
+	psb.pending[sequence] = nil
+
+	return nil
+}
+
+// fail records the first error encountered and wakes any waiting callers.
+func (psb *ParallelStreamBuilder) fail(err error) {
+	psb.mutex.Lock()
+	defer psb.mutex.Unlock()
+
+	psb.failLocked(err)
+}
+
+// failLocked records the first error encountered, releases the buffers of the
+// series that will now never be written, and wakes any waiting callers. The
+// mutex must be held.
+func (psb *ParallelStreamBuilder) failLocked(err error) {
+	if psb.err == nil {
+		psb.err = err
+	}
+
+	for sequence, es := range psb.pending {
+		if es != nil {
+			es.buffer.Close()
+		}
+
+		delete(psb.pending, sequence)
+	}
+
+	psb.cond.Broadcast()
+}
+
+// AddSeries encodes a series and queues it to be written in sequence order.
+// This may be called from multiple goroutines.
+func (psb *ParallelStreamBuilder) AddSeries(sequence int, seriesDataWriter interface{}, sf SeriesFooter) (err error) {
+	defer func() {
+		if state := recover(); state != nil {
+			err = log.Wrap(state.(error))
+		}
+	}()
+
+	err = psb.reserve(sequence)
+	log.PanicIf(err)
+
+	es, err := encodeSeries(seriesDataWriter, sf, psb.spillThreshold)
+	if err != nil {
+		psb.fail(err)
+		log.Panic(err)
+	}
+
+	err = psb.push(sequence, es)
+	log.PanicIf(err)
+
+	return nil
+}
+
+// push stores the encoded series. If no other goroutine is writing, it then
+// writes every series that is ready. The mutex is not held during the writes.
+func (psb *ParallelStreamBuilder) push(sequence int, es *encodedSeries) (err error) {
+	psb.mutex.Lock()
+	defer psb.mutex.Unlock()
+
+	if psb.err != nil {
+		es.buffer.Close()
+		return psb.err
+	}
+
+	psb.pending[sequence] = es
+
+	if psb.writing == true {
+		// The goroutine that's writing will get to it.
+		return nil
+	}
+
+	psb.writing = true
+
+	defer func() {
+		psb.writing = false
+		psb.cond.Broadcast()
+	}()
+
+	for {
+		ready, found := psb.pending[psb.nextSequence]
+		if found == false || ready == nil {
+			break
+		}
+
+		delete(psb.pending, psb.nextSequence)
+
+		parallelBuilderLogger.Debugf(nil, "Writing series (%d) [%s].", psb.nextSequence, ready.sf.Uuid())
+
+		psb.mutex.Unlock()
+		err := psb.writeEncodedSeries(ready)
+		psb.mutex.Lock()
+
+		if err != nil {
+			psb.failLocked(err)
+			return err
+		} else if psb.err != nil {
+			return psb.err
+		}
+
+		psb.nextSequence++
+		psb.cond.Broadcast()
+	}
+
+	return nil
+}
+
+// writeEncodedSeries writes one encoded series to the underlying builder.
+func (psb *ParallelStreamBuilder) writeEncodedSeries(es *encodedSeries) (err error) {
+	defer func() {
+		if state := recover(); state != nil {
+			err = log.Wrap(state.(error))
+		}
+	}()
+
+	defer es.buffer.Close()
+
+	r, err := es.buffer.Reader()
+	log.PanicIf(err)
+
+	err = psb.sb.addEncodedSeries(r, es.dataSize, es.fnvChecksum, es.sf)
+	log.PanicIf(err)
+
+	return nil
+}
+
+// Finish waits for any series that are being written and then writes the
+// stream footer. Every sequence number from zero up to the last one added must
+// have been added. If this fails, the builder can't be used any further.
+func (psb *ParallelStreamBuilder) Finish() (totalSize int, err error) {
+	defer func() {
+		if state := recover(); state != nil {
+			err = log.Wrap(state.(error))
+		}
+	}()
+
+	psb.mutex.Lock()
+	defer psb.mutex.Unlock()
+
+	for psb.err == nil && psb.writing == true {
+		psb.cond.Wait()
+	}
+
+	if psb.err != nil {
+		log.Panic(psb.err)
+	}
+
+	if len(psb.pending) > 0 {
+		err := log.Errorf("series (%d) was never added or is still being encoded", psb.nextSequence)
+		psb.failLocked(err)
+
+		log.Panic(err)
+	}
+
+	totalSize, err = psb.sb.Finish()
+	if err != nil {
+		psb.failLocked(err)
+		log.Panic(err)
+	}
+
+	return totalSize, nil
+}
+
+// encodeSeries encodes and checksums the series data into a spill buffer. If
+// the datasource provides a summary, it's applied to the footer.
+func encodeSeries(seriesDataWriter interface{}, sf SeriesFooter, spillThreshold int) (es *encodedSeries, err error) {
+	buffer := newSpillBuffer(spillThreshold)
+
+	defer func() {
+		if state := recover(); state != nil {
+			buffer.Close()
+			err = log.Wrap(state.(error))
+		}
+	}()
+
+	fnv1a := fnv.New32a()
+	teeWriter := io.MultiWriter(buffer, fnv1a)
+
+	dataSize, err := writeSeriesData(teeWriter, seriesDataWriter, sf)
+	log.PanicIf(err)
+
+	applySeriesSummary(seriesDataWriter, sf)
+
+	es = &encodedSeries{
+		sf:          sf,
+		buffer:      buffer,
+		dataSize:    dataSize,
+		fnvChecksum: fnv1a.Sum32(),
+	}
+
+	return es, nil
+}
@@ -0,0 +1,277 @@
+package timetogo
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/dsoprea/go-logging"
+	"github.com/randomingenuity/go-utility/filesystem"
+)
+
+func getTestParallelSeries(count int) (footers []*SeriesFooter1, data [][]byte) {
+	headRecordTime := time.Date(2016, 10, 1, 12, 34, 56, 0, time.UTC)
+
+	footers = make([]*SeriesFooter1, count)
+	data = make([][]byte, count)
+
+	for i := 0; i < count; i++ {
+		data[i] = bytes.Repeat([]byte(fmt.Sprintf("series %d data ", i)), i+1)
+
+		footers[i] = NewSeriesFooter1(
+			headRecordTime.Add(time.Minute*time.Duration(i)),
+			headRecordTime.Add(time.Minute*time.Duration(i)+time.Second*30),
+			uint64(i+1),
+			[]byte{byte(i)})
+	}
+
+	return footers, data
+}
+
+func TestParallelStreamBuilder_AddSeries(t *testing.T) {
+	footers, data := getTestParallelSeries(20)
+
+	// Build serially.
+
+	serialBuffer := rifs.NewSeekableBuffer()
+	sb := NewStreamBuilder(serialBuffer)
+
+	for i, sf := range footers {
+		err := sb.AddSeries(bytes.NewBuffer(data[i]), sf)
+		log.PanicIf(err)
+	}
+
+	serialSize, err := sb.Finish()
+	log.PanicIf(err)
+
+	// Build in parallel, in reverse submission order. Use a small spill
+	// threshold so that some series go to disk.
+
+	parallelBuffer := rifs.NewSeekableBuffer()
+	psb := NewParallelStreamBuilder(parallelBuffer, len(footers), 100)
+
+	var wg sync.WaitGroup
+	for i := len(footers) - 1; i >= 0; i-- {
+		wg.Add(1)
+
+		go func(i int) {
+			defer wg.Done()
+
+			err := psb.AddSeries(i, bytes.NewBuffer(data[i]), footers[i])
+			log.PanicIf(err)
+		}(i)
+	}
+
+	wg.Wait()
+
+	parallelSize, err := psb.Finish()
+	log.PanicIf(err)
+
+	if parallelSize != serialSize {
+		t.Fatalf("Stream sizes do not match: (%d) != (%d)", parallelSize, serialSize)
+	} else if bytes.Compare(parallelBuffer.Bytes(), serialBuffer.Bytes()) != 0 {
+		t.Fatalf("Parallel stream does not match serial stream.")
+	}
+
+	readFooters, readData := readTestStreamSeries(parallelBuffer.Bytes())
+
+	for i, sf := range readFooters {
+		if sf.Uuid() != footers[i].Uuid() {
+			t.Fatalf("Series (%d) not in the right position.", i)
+		} else if bytes.Compare(readData[i], data[i]) != 0 {
+			t.Fatalf("Series (%d) data not correct.", i)
+		}
+	}
+}
+
+func TestParallelStreamBuilder_AddSeries_Window(t *testing.T) {
+	footers, data := getTestParallelSeries(10)
+
+	b := rifs.NewSeekableBuffer()
+	psb := NewParallelStreamBuilder(b, 2, 0)
+
+	var wg sync.WaitGroup
+	for i := range footers {
+		wg.Add(1)
+
+		go func(i int) {
+			defer wg.Done()
+
+			err := psb.AddSeries(i, bytes.NewBuffer(data[i]), footers[i])
+			log.PanicIf(err)
+		}(i)
+	}
+
+	wg.Wait()
+
+	_, err := psb.Finish()
+	log.PanicIf(err)
+
+	readFooters, _ := readTestStreamSeries(b.Bytes())
+
+	if len(readFooters) != len(footers) {
+		t.Fatalf("Series count not correct: (%d)", len(readFooters))
+	}
+}
+
+func TestParallelStreamBuilder_AddSeries_Duplicate(t *testing.T) {
+	footers, data := getTestParallelSeries(2)
+
+	psb := NewParallelStreamBuilder(rifs.NewSeekableBuffer(), 2, 0)
+
+	err := psb.AddSeries(0, bytes.NewBuffer(data[0]), footers[0])
+	log.PanicIf(err)
+
+	err = psb.AddSeries(0, bytes.NewBuffer(data[1]), footers[1])
+	if err == nil {
+		t.Fatalf("Expected failure for duplicate sequence.")
+	}
+}
+
+func TestParallelStreamBuilder_Finish_Missing(t *testing.T) {
+	footers, data := getTestParallelSeries(2)
+
+	psb := NewParallelStreamBuilder(rifs.NewSeekableBuffer(), 2, 0)
+
+	err := psb.AddSeries(1, bytes.NewBuffer(data[1]), footers[1])
+	log.PanicIf(err)
+
+	_, err = psb.Finish()
+	if err == nil {
+		t.Fatalf("Expected failure for missing sequence.")
+	} else if err.Error() != "series (0) was never added or is still being encoded" {
+		log.Panic(err)
+	}
+}
+
+func TestParallelStreamBuilder_AddSeries_Summarizer(t *testing.T) {
+	headRecordTime := time.Date(2016, 10, 1, 12, 34, 56, 0, time.UTC)
+
+	tsd := &testSummarizerDatasource{
+		data:           TestTimeSeriesData,
+		headRecordTime: headRecordTime,
+		tailRecordTime: headRecordTime.Add(time.Second * 10),
+	}
+
+	b := rifs.NewSeekableBuffer()
+	psb := NewParallelStreamBuilder(b, 1, 0)
+
+	err := psb.AddSeries(0, tsd, NewSeriesFooter1(time.Time{}, time.Time{}, 0, nil))
+	log.PanicIf(err)
+
+	_, err = psb.Finish()
+	log.PanicIf(err)
+
+	footers, _ := readTestStreamSeries(b.Bytes())
+
+	sf := footers[0]
+
+	if sf.HeadRecordTime() != tsd.headRecordTime {
+		t.Fatalf("Head time not correct: [%s]", sf.HeadRecordTime())
+	} else if sf.TailRecordTime() != tsd.tailRecordTime {
+		t.Fatalf("Tail time not correct: [%s]", sf.TailRecordTime())
+	} else if sf.RecordCount() != uint64(len(TestTimeSeriesData)) {
+		t.Fatalf("Record count not correct: (%d)", sf.RecordCount())
+	}
+}
+
+func TestParallelStreamBuilder_Finish_Missing_ReleasesSpill(t *testing.T) {
+	footers, data := getTestParallelSeries(2)
+
+	// Spill everything so that there's a temporary file to release.
+	psb := NewParallelStreamBuilder(rifs.NewSeekableBuffer(), 2, 1)
+
+	err := psb.AddSeries(1, bytes.NewBuffer(data[1]), footers[1])
+	log.PanicIf(err)
+
+	spillFilepath := psb.pending[1].buffer.f.Name()
+
+	_, err = psb.Finish()
+	if err == nil {
+		t.Fatalf("Expected failure for missing sequence.")
+	}
+
+	if len(psb.pending) != 0 {
+		t.Fatalf("Pending series not released: (%d)", len(psb.pending))
+	} else if _, err := os.Stat(spillFilepath); os.IsNotExist(err) != true {
+		t.Fatalf("Spill file not removed: [%s]", spillFilepath)
+	}
+
+	// Adding the missing series now fails rather than leaking its buffer.
+
+	err = psb.AddSeries(0, bytes.NewBuffer(data[0]), footers[0])
+	if err == nil {
+		t.Fatalf("Expected failure after failed finish.")
+	}
+}
+
+func TestParallelStreamBuilder_AddSeries_WriteFailure_ReleasesSpill(t *testing.T) {
+	footers, data := getTestParallelSeries(3)
+
+	psb := NewParallelStreamBuilder(rifs.NewSeekableBuffer(), 3, 1)
+	psb.StreamBuilder().SetOverlapPolicy(OpReject, 0)
+
+	// Make the second series overlap the first so that writing it fails.
+
+	overlapping := NewSeriesFooter1(footers[0].HeadRecordTime(), footers[0].TailRecordTime(), 1, []byte{99})
+
+	err := psb.AddSeries(1, bytes.NewBuffer(data[1]), overlapping)
+	log.PanicIf(err)
+
+	err = psb.AddSeries(2, bytes.NewBuffer(data[2]), footers[2])
+	log.PanicIf(err)
+
+	spillFilepath := psb.pending[2].buffer.f.Name()
+
+	err = psb.AddSeries(0, bytes.NewBuffer(data[0]), footers[0])
+	if err == nil {
+		t.Fatalf("Expected overlap failure.")
+	} else if log.Is(err, ErrSeriesOverlap) != true {
+		log.Panic(err)
+	}
+
+	if len(psb.pending) != 0 {
+		t.Fatalf("Pending series not released: (%d)", len(psb.pending))
+	} else if _, err := os.Stat(spillFilepath); os.IsNotExist(err) != true {
+		t.Fatalf("Spill file not removed: [%s]", spillFilepath)
+	}
+
+	_, err = psb.Finish()
+	if err == nil {
+		t.Fatalf("Expected failure after failed write.")
+	}
+}
+
+func TestSpillBuffer(t *testing.T) {
+	sb := newSpillBuffer(5)
+	defer sb.Close()
+
+	_, err := sb.Write([]byte("abc"))
+	log.PanicIf(err)
+
+	if sb.f != nil {
+		t.Fatalf("Spilled too early.")
+	}
+
+	_, err = sb.Write([]byte("defgh"))
+	log.PanicIf(err)
+
+	if sb.f == nil {
+		t.Fatalf("Did not spill.")
+	}
+
+	r, err := sb.Reader()
+	log.PanicIf(err)
+
+	b := new(bytes.Buffer)
+
+	_, err = b.ReadFrom(r)
+	log.PanicIf(err)
+
+	if b.String() != "abcdefgh" {
+		t.Fatalf("Spilled data not correct: [%s]", b.String())
+	}
+}
@@ -0,0 +1,311 @@
+package timetogo
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"encoding/gob"
+
+	"github.com/dsoprea/go-logging"
+	"github.com/google/uuid"
+)
+
+var (
+	partitionerLogger = log.NewLogger("timetogo.partitioner")
+)
+
+var (
+	// ErrPartitionRecordsNotOrdered indicates that a record given to a
+	// `Partitioner` was earlier than the record before it.
+	ErrPartitionRecordsNotOrdered = errors.New("partition records not in time order")
+)
+
+// PartitionUnit is a calendar period that records are grouped by.
+type PartitionUnit int
+
+const (
+	// PuHour groups records by hour.
+	PuHour PartitionUnit = iota
+
+	// PuDay groups records by day.
+	PuDay PartitionUnit = iota
+
+	// PuIsoWeek groups records by ISO 8601 week (starting on Monday).
+	PuIsoWeek PartitionUnit = iota
+
+	// PuMonth groups records by month.
+	PuMonth PartitionUnit = iota
+
+	// PuQuarter groups records by calendar quarter.
+	PuQuarter PartitionUnit = iota
+
+	// PuYear groups records by year.
+	PuYear PartitionUnit = iota
+)
+
+var (
+	partitionUnitNames = map[PartitionUnit]string{
+		PuHour:    "hour",
+		PuDay:     "day",
+		PuIsoWeek: "isoweek",
+		PuMonth:   "month",
+		PuQuarter: "quarter",
+		PuYear:    "year",
+	}
+)
+
+func (pu PartitionUnit) String() string {
+	name, found := partitionUnitNames[pu]
+	if found == false {
+		return fmt.Sprintf("PartitionUnit<%d>", int(pu))
+	}
+
+	return name
+}
+
+// BucketStart returns the start of the bucket that the given time falls in,
+// using the calendar of the given location.
+func (pu PartitionUnit) BucketStart(t time.Time, location *time.Location) time.Time {
+	t = t.In(location)
+
+	switch pu {
+	case PuHour:
+		// Subtract rather than rebuild the time so that a repeated hour at the
+		// end of daylight-saving time stays distinct.
+		sinceHour := time.Duration(t.Minute())*time.Minute + time.Duration(t.Second())*time.Second + time.Duration(t.Nanosecond())
+		return t.Add(-sinceHour)
+	case PuDay:
+		return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, location)
+	case PuIsoWeek:
+		sinceMonday := (int(t.Weekday()) + 6) % 7
+		return time.Date(t.Year(), t.Month(), t.Day()-sinceMonday, 0, 0, 0, 0, location)
+	case PuMonth:
+		return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, location)
+	case PuQuarter:
+		month := time.Month((int(t.Month())-1)/3*3 + 1)
+		return time.Date(t.Year(), month, 1, 0, 0, 0, 0, location)
+	case PuYear:
+		return time.Date(t.Year(), time.January, 1, 0, 0, 0, 0, location)
+	}
+
+	log.Panicf("partition unit not valid: (%d)", int(pu))
+	return time.Time{}
+}
+
+// PartitionUuid returns the UUID for the series of the bucket that starts at
+// the given time. It's derived from the unit and the start of the bucket, so
+// repartitioning the same period produces the same UUID, and `Updater` will
+// replace that series rather than adding another one.
+func PartitionUuid(unit PartitionUnit, bucketStart time.Time) string {
+	name := fmt.Sprintf("timetogo/partition/%s/%s", unit, bucketStart.Format(time.RFC3339Nano))
+	return uuid.NewSHA1(uuid.NameSpaceURL, []byte(name)).String()
+}
+
+// PartitionEncoder encodes the records of one bucket as the series data.
+type PartitionEncoder func(w io.Writer, records []interface{}) (err error)
+
+// GobPartitionEncoder encodes the records one at a time with a shared
+// `gob.Encoder`. They can be read with `GobRecordDecoderDatasource` or
+// `GobRecordIterator`.
+func GobPartitionEncoder(w io.Writer, records []interface{}) (err error) {
+	defer func() {
+		if state := recover(); state != nil {
+			err = log.Wrap(state.(error))
+		}
+	}()
+
+	e := gob.NewEncoder(w)
+
+	for _, record := range records {
+		err := e.Encode(record)
+		log.PanicIf(err)
+	}
+
+	return nil
+}
+
+// PartitionTimestampGetter returns the timestamp of a record.
+type PartitionTimestampGetter func(record interface{}) time.Time
+
+// SeriesSink receives series. `StreamBuilder` satisfies this, and
+// `UpdaterSeriesSink` adapts an `Updater`.
+type SeriesSink interface {
+	AddSeries(seriesDataWriter interface{}, sf SeriesFooter) (err error)
+}
+
+// UpdaterSeriesSink queues series on an `Updater` and provides their data when
+// the update is written.
+type UpdaterSeriesSink struct {
+	updater *Updater
+	data    map[string]interface{}
+}
+
+// NewUpdaterSeriesSink returns a new `UpdaterSeriesSink` struct with a new
+// `Updater` for the given stream. Only the series that are added will be kept
+// when the update is written.
+func NewUpdaterSeriesSink(rws io.ReadWriteSeeker) *UpdaterSeriesSink {
+	uss := &UpdaterSeriesSink{
+		data: make(map[string]interface{}),
+	}
+
+	uss.updater = NewUpdater(rws, uss)
+
+	return uss
+}
+
+// Updater returns the `Updater`, to configure it and to call `Write`.
+func (uss *UpdaterSeriesSink) Updater() *Updater {
+	return uss.updater
+}
+
+// AddSeries queues the series on the `Updater`.
+func (uss *UpdaterSeriesSink) AddSeries(seriesDataWriter interface{}, sf SeriesFooter) (err error) {
+	uss.data[sf.Uuid()] = seriesDataWriter
+	uss.updater.AddSeries(sf)
+
+	return nil
+}
+
+// WriteData writes the data for the series with the same UUID.
+func (uss *UpdaterSeriesSink) WriteData(w io.Writer, sf SeriesFooter) (n int, err error) {
+	defer func() {
+		if state := recover(); state != nil {
+			err = log.Wrap(state.(error))
+		}
+	}()
+
+	seriesDataWriter, found := uss.data[sf.Uuid()]
+	if found == false {
+		log.Panicf("no data queued for series [%s]", sf.Uuid())
+	}
+
+	copiedCount, err := writeSeriesData(w, seriesDataWriter, sf)
+	log.PanicIf(err)
+
+	applySeriesSummary(seriesDataWriter, sf)
+
+	return int(copiedCount), nil
+}
+
+// Partitioner cuts a time-ordered sequence of records into one series per
+// calendar bucket (e.g. per month). Each series is given to the sink as soon
+// as its bucket is complete. The footer's head and tail times are the
+// timestamps of the first and last records, the record count is filled in, and
+// the source SHA1 is the SHA1 of the encoded records.
+type Partitioner struct {
+	sink        SeriesSink
+	unit        PartitionUnit
+	location    *time.Location
+	timestampOf PartitionTimestampGetter
+	encoder     PartitionEncoder
+
+	bucketStart   time.Time
+	records       []interface{}
+	lastTimestamp time.Time
+	seriesCount   int
+}
+
+// NewPartitioner returns a new `Partitioner` struct. If `location` is nil, UTC
+// is used.
+func NewPartitioner(sink SeriesSink, unit PartitionUnit, location *time.Location, timestampOf PartitionTimestampGetter, encoder PartitionEncoder) *Partitioner {
+	if location == nil {
+		location = time.UTC
+	}
+
+	return &Partitioner{
+		sink:        sink,
+		unit:        unit,
+		location:    location,
+		timestampOf: timestampOf,
+		encoder:     encoder,
+		records:     make([]interface{}, 0),
+	}
+}
+
+// Add adds the next record. Records must be in time order.
+func (p *Partitioner) Add(record interface{}) (err error) {
+	defer func() {
+		if state := recover(); state != nil {
+			err = log.Wrap(state.(error))
+		}
+	}()
+
+	timestamp := p.timestampOf(record)
+
+	if len(p.records) > 0 {
+		if timestamp.Before(p.lastTimestamp) == true {
+			log.Panic(ErrPartitionRecordsNotOrdered)
+		}
+
+		bucketStart := p.unit.BucketStart(timestamp, p.location)
+		if bucketStart.Equal(p.bucketStart) == false {
+			err := p.flush()
+			log.PanicIf(err)
+		}
+	}
+
+	if len(p.records) == 0 {
+		p.bucketStart = p.unit.BucketStart(timestamp, p.location)
+	}
+
+	p.records = append(p.records, record)
+	p.lastTimestamp = timestamp
+
+	return nil
+}
+
+// flush encodes the current bucket and gives it to the sink.
+func (p *Partitioner) flush() (err error) {
+	defer func() {
+		if state := recover(); state != nil {
+			err = log.Wrap(state.(error))
+		}
+	}()
+
+	if len(p.records) == 0 {
+		return nil
+	}
+
+	b := new(bytes.Buffer)
+
+	err = p.encoder(b, p.records)
+	log.PanicIf(err)
+
+	sourceSha1 := sha1.Sum(b.Bytes())
+
+	headRecordTime := p.timestampOf(p.records[0])
+	tailRecordTime := p.timestampOf(p.records[len(p.records)-1])
+
+	seriesUuid := PartitionUuid(p.unit, p.bucketStart)
+	sf := NewSeriesFooter1WithUuid(seriesUuid, headRecordTime, tailRecordTime, uint64(len(p.records)), sourceSha1[:])
+
+	partitionerLogger.Debugf(nil, "Emitting (%s) partition [%s] with (%d) records as series [%s].", p.unit, p.bucketStart, len(p.records), seriesUuid)
+
+	err = p.sink.AddSeries(bytes.NewReader(b.Bytes()), sf)
+	log.PanicIf(err)
+
+	p.records = make([]interface{}, 0)
+	p.seriesCount++
+
+	return nil
+}
+
+// Finish emits the last bucket and returns how many series were emitted. It
+// does not finish the sink (e.g. `StreamBuilder.Finish` or `Updater.Write`
+// must still be called).
+func (p *Partitioner) Finish() (seriesCount int, err error) {
+	defer func() {
+		if state := recover(); state != nil {
+			err = log.Wrap(state.(error))
+		}
+	}()
+
+	err = p.flush()
+	log.PanicIf(err)
+
+	return p.seriesCount, nil
+}
@@ -0,0 +1,199 @@
+package timetogo
+
+import (
+	"testing"
+	"time"
+
+	"github.com/dsoprea/go-logging"
+	"github.com/randomingenuity/go-utility/filesystem"
+)
+
+type testPartitionRecord struct {
+	Timestamp time.Time
+	Value     int
+}
+
+func testPartitionTimestamp(record interface{}) time.Time {
+	return record.(testPartitionRecord).Timestamp
+}
+
+func TestPartitionUnit_BucketStart(t *testing.T) {
+	timestamp := time.Date(2016, 11, 5, 12, 34, 56, 789, time.UTC)
+
+	expected := map[PartitionUnit]time.Time{
+		PuHour:    time.Date(2016, 11, 5, 12, 0, 0, 0, time.UTC),
+		PuDay:     time.Date(2016, 11, 5, 0, 0, 0, 0, time.UTC),
+		PuIsoWeek: time.Date(2016, 10, 31, 0, 0, 0, 0, time.UTC),
+		PuMonth:   time.Date(2016, 11, 1, 0, 0, 0, 0, time.UTC),
+		PuQuarter: time.Date(2016, 10, 1, 0, 0, 0, 0, time.UTC),
+		PuYear:    time.Date(2016, 1, 1, 0, 0, 0, 0, time.UTC),
+	}
+
+	for unit, expectedStart := range expected {
+		bucketStart := unit.BucketStart(timestamp, time.UTC)
+		if bucketStart.Equal(expectedStart) != true {
+			t.Fatalf("Bucket start for (%s) not correct: [%s]", unit, bucketStart)
+		}
+	}
+
+	// A Monday is the start of its own ISO week.
+
+	monday := time.Date(2016, 10, 31, 0, 0, 0, 0, time.UTC)
+	if bucketStart := PuIsoWeek.BucketStart(monday, time.UTC); bucketStart.Equal(monday) != true {
+		t.Fatalf("Bucket start for Monday not correct: [%s]", bucketStart)
+	}
+
+	// The calendar of the location is used.
+
+	location := time.FixedZone("UTC-5", -5*60*60)
+
+	bucketStart := PuDay.BucketStart(time.Date(2016, 11, 5, 2, 0, 0, 0, time.UTC), location)
+	if bucketStart.Equal(time.Date(2016, 11, 4, 0, 0, 0, 0, location)) != true {
+		t.Fatalf("Bucket start in location not correct: [%s]", bucketStart)
+	}
+}
+
+func getTestPartitionRecords() []testPartitionRecord {
+	records := make([]testPartitionRecord, 0)
+
+	// Three days, with four records each.
+
+	headRecordTime := time.Date(2016, 11, 5, 0, 0, 0, 0, time.UTC)
+	for i := 0; i < 12; i++ {
+		tpr := testPartitionRecord{
+			Timestamp: headRecordTime.Add(time.Hour * 6 * time.Duration(i)),
+			Value:     i,
+		}
+
+		records = append(records, tpr)
+	}
+
+	return records
+}
+
+func TestPartitioner_StreamBuilder(t *testing.T) {
+	sb := rifs.NewSeekableBuffer()
+	streamBuilder := NewStreamBuilder(sb)
+
+	p := NewPartitioner(streamBuilder, PuDay, nil, testPartitionTimestamp, GobPartitionEncoder)
+
+	records := getTestPartitionRecords()
+	for _, record := range records {
+		err := p.Add(record)
+		log.PanicIf(err)
+	}
+
+	seriesCount, err := p.Finish()
+	log.PanicIf(err)
+
+	if seriesCount != 3 {
+		t.Fatalf("Series count not correct: (%d)", seriesCount)
+	}
+
+	_, err = streamBuilder.Finish()
+	log.PanicIf(err)
+
+	sr := NewStreamReader(sb)
+
+	it, err := NewIterator(sr)
+	log.PanicIf(err)
+
+	if it.Count() != 3 {
+		t.Fatalf("Stream series count not correct: (%d)", it.Count())
+	}
+
+	for i := 0; i < it.Count(); i++ {
+		sisi := it.SeriesInfo(i)
+
+		dayRecords := records[i*4 : i*4+4]
+
+		if sisi.Uuid() != PartitionUuid(PuDay, PuDay.BucketStart(dayRecords[0].Timestamp, time.UTC)) {
+			t.Fatalf("Series (%d) UUID not correct: [%s]", i, sisi.Uuid())
+		} else if sisi.HeadRecordTime() != dayRecords[0].Timestamp {
+			t.Fatalf("Series (%d) head time not correct: [%s]", i, sisi.HeadRecordTime())
+		} else if sisi.TailRecordTime() != dayRecords[3].Timestamp {
+			t.Fatalf("Series (%d) tail time not correct: [%s]", i, sisi.TailRecordTime())
+		}
+
+		recovered := make([]testPartitionRecord, 0)
+
+		newRecord := func() interface{} {
+			return new(testPartitionRecord)
+		}
+
+		cb := func(record interface{}) (err error) {
+			recovered = append(recovered, *record.(*testPartitionRecord))
+			return nil
+		}
+
+		seriesFooter, _, checksumOk, err := sr.ReadSeriesWithIndexedInfo(sisi, NewGobRecordDecoderDatasource(newRecord, cb))
+		log.PanicIf(err)
+
+		if checksumOk != true {
+			t.Fatalf("Series (%d) checksum not correct.", i)
+		} else if seriesFooter.RecordCount() != 4 {
+			t.Fatalf("Series (%d) record count not correct: (%d)", i, seriesFooter.RecordCount())
+		}
+
+		for j, record := range recovered {
+			if record.Value != dayRecords[j].Value || record.Timestamp.Equal(dayRecords[j].Timestamp) != true {
+				t.Fatalf("Series (%d) record (%d) not correct: %v", i, j, record)
+			}
+		}
+	}
+}
+
+func TestPartitioner_Updater(t *testing.T) {
+	records := getTestPartitionRecords()
+
+	partition := func(rws *rifs.SeekableBuffer, records []testPartitionRecord) UpdateStats {
+		uss := NewUpdaterSeriesSink(rws)
+
+		p := NewPartitioner(uss, PuDay, nil, testPartitionTimestamp, GobPartitionEncoder)
+
+		for _, record := range records {
+			err := p.Add(record)
+			log.PanicIf(err)
+		}
+
+		_, err := p.Finish()
+		log.PanicIf(err)
+
+		_, stats, err := uss.Updater().Write()
+		log.PanicIf(err)
+
+		return stats
+	}
+
+	rws := rifs.NewSeekableBuffer()
+
+	stats := partition(rws, records)
+	if stats != (UpdateStats{Adds: 3}) {
+		t.Fatalf("Initial stats not correct: %s", stats)
+	}
+
+	// Change a record on the last day. Only that series is replaced.
+
+	records[10].Value = 100
+
+	stats = partition(rws, records)
+	if stats != (UpdateStats{Skips: 2, Replaces: 1}) {
+		t.Fatalf("Update stats not correct: %s", stats)
+	}
+}
+
+func TestPartitioner_Add_NotOrdered(t *testing.T) {
+	p := NewPartitioner(NewStreamBuilder(rifs.NewSeekableBuffer()), PuDay, nil, testPartitionTimestamp, GobPartitionEncoder)
+
+	records := getTestPartitionRecords()
+
+	err := p.Add(records[1])
+	log.PanicIf(err)
+
+	err = p.Add(records[0])
+	if err == nil {
+		t.Fatalf("Expected failure for out-of-order record.")
+	} else if log.Is(err, ErrPartitionRecordsNotOrdered) != true {
+		log.Panic(err)
+	}
+}
@@ -0,0 +1,688 @@
+package timetogo
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"errors"
+	"io"
+	"math"
+	"time"
+
+	"io/ioutil"
+	"math/bits"
+
+	"github.com/dsoprea/go-logging"
+	"github.com/randomingenuity/go-utility/filesystem"
+)
+
+var (
+	pointsLogger = log.NewLogger("timetogo.points")
+)
+
+var (
+	// ErrPointTimestampOutOfRange indicates that the timestamp of a point can
+	// not be represented as nanoseconds since the epoch in an int64 (roughly
+	// the years 1678 through 2262). This includes the zero `time.Time`.
+	ErrPointTimestampOutOfRange = errors.New("point timestamp out of range")
+)
+
+var (
+	minPointTimestamp = time.Unix(0, math.MinInt64)
+	maxPointTimestamp = time.Unix(0, math.MaxInt64)
+)
+
+// Point is one value in a numeric time-series. The timestamp must be
+// representable with `UnixNano`.
+type Point struct {
+	Timestamp time.Time
+	Value     float64
+}
+
+// >>>>>>>>>>
+// Bit stream
+// <<<<<<<<<<
+
+// bitWriter writes values of arbitrary bit-widths, most-significant bit first.
+type bitWriter struct {
+	w       *bufio.Writer
+	current byte
+	filled  uint
+}
+
+func newBitWriter(w io.Writer) *bitWriter {
+	return &bitWriter{
+		w: bufio.NewWriter(w),
+	}
+}
+
+// writeBits writes the lowest `n` bits of the value.
+func (bw *bitWriter) writeBits(value uint64, n uint) (err error) {
+	for n > 0 {
+		n--
+
+		bw.current = bw.current<<1 | byte(value>>n)&1
+		bw.filled++
+
+		if bw.filled == 8 {
+			err := bw.w.WriteByte(bw.current)
+			if err != nil {
+				return err
+			}
+
+			bw.current = 0
+			bw.filled = 0
+		}
+	}
+
+	return nil
+}
+
+// flush pads the last byte with zeros and flushes the underlying writer.
+func (bw *bitWriter) flush() (err error) {
+	if bw.filled > 0 {
+		err := bw.writeBits(0, 8-bw.filled)
+		if err != nil {
+			return err
+		}
+	}
+
+	return bw.w.Flush()
+}
+
+// bitReader reads values written by `bitWriter`.
+type bitReader struct {
+	r         io.ByteReader
+	current   byte
+	remaining uint
+}
+
+func newBitReader(r io.ByteReader) *bitReader {
+	return &bitReader{
+		r: r,
+	}
+}
+
+// readBits reads a value with the given number of bits. Running out of data
+// produces `io.ErrUnexpectedEOF`.
+func (br *bitReader) readBits(n uint) (value uint64, err error) {
+	for ; n > 0; n-- {
+		if br.remaining == 0 {
+			br.current, err = br.r.ReadByte()
+			if err != nil {
+				if err == io.EOF {
+					return 0, io.ErrUnexpectedEOF
+				}
+
+				return 0, err
+			}
+
+			br.remaining = 8
+		}
+
+		br.remaining--
+		value = value<<1 | uint64(br.current>>br.remaining)&1
+	}
+
+	return value, nil
+}
+
+// >>>>>>>>>>>>>>>>>>>>>>>>>>>>>>
+// Delta-of-delta and XOR coding
+// <<<<<<<<<<<<<<<<<<<<<<<<<<<<<<
+
+// The points are preceded by a 64-bit count. The first point has a raw 64-bit
+// timestamp (Unix nanoseconds) and value. Each following timestamp is encoded
+// as the difference between its delta and the previous delta:
+//
+//   0                      dod is zero
+//   10   + 7-bit dod
+//   110  + 9-bit dod
+//   1110 + 12-bit dod
+//   1111 + 64-bit dod
+//
+// Each following value is XORed with the previous value:
+//
+//   0                      same value
+//   10   + meaningful bits using the previous leading/trailing zero counts
+//   11   + 6-bit leading zero count + 6-bit (meaningful length - 1) +
+//          meaningful bits
+
+type dodBucket struct {
+	prefix       uint64
+	prefixLength uint
+	valueLength  uint
+}
+
+var (
+	dodBuckets = []dodBucket{
+		{prefix: 0x2, prefixLength: 2, valueLength: 7},
+		{prefix: 0x6, prefixLength: 3, valueLength: 9},
+		{prefix: 0xe, prefixLength: 4, valueLength: 12},
+		{prefix: 0xf, prefixLength: 4, valueLength: 64},
+	}
+)
+
+// fitsSigned returns true if the value can be represented in `n` bits of two's
+// complement.
+func fitsSigned(value int64, n uint) bool {
+	if n >= 64 {
+		return true
+	}
+
+	limit := int64(1) << (n - 1)
+	return value >= -limit && value < limit
+}
+
+// signExtend converts an `n`-bit two's complement value to an int64.
+func signExtend(value uint64, n uint) int64 {
+	shift := 64 - n
+	return int64(value<<shift) >> shift
+}
+
+// pointEncoder holds the state carried from one point to the next.
+type pointEncoder struct {
+	bw *bitWriter
+
+	count         int
+	prevTimestamp int64
+	prevDelta     int64
+	prevValue     uint64
+	prevLeading   uint
+	prevTrailing  uint
+	hasWindow     bool
+}
+
+func (pe *pointEncoder) encode(p Point) (err error) {
+	defer func() {
+		if state := recover(); state != nil {
+			err = log.Wrap(state.(error))
+		}
+	}()
+
+	if p.Timestamp.Before(minPointTimestamp) == true || p.Timestamp.After(maxPointTimestamp) == true {
+		pointsLogger.Debugf(nil, "Point timestamp can not be encoded: [%s]", p.Timestamp)
+		log.Panic(ErrPointTimestampOutOfRange)
+	}
+
+	timestamp := p.Timestamp.UnixNano()
+	value := math.Float64bits(p.Value)
+
+	if pe.count == 0 {
+		err := pe.bw.writeBits(uint64(timestamp), 64)
+		log.PanicIf(err)
+
+		err = pe.bw.writeBits(value, 64)
+		log.PanicIf(err)
+
+		pe.prevTimestamp = timestamp
+	} else {
+		err := pe.encodeTimestamp(timestamp)
+		log.PanicIf(err)
+
+		err = pe.encodeValue(value)
+		log.PanicIf(err)
+	}
+
+	pe.prevValue = value
+	pe.count++
+
+	return nil
+}
+
+func (pe *pointEncoder) encodeTimestamp(timestamp int64) (err error) {
+	defer func() {
+		if state := recover(); state != nil {
+			err = log.Wrap(state.(error))
+		}
+	}()
+
+	delta := timestamp - pe.prevTimestamp
+	dod := delta - pe.prevDelta
+
+	pe.prevTimestamp = timestamp
+	pe.prevDelta = delta
+
+	if dod == 0 {
+		err := pe.bw.writeBits(0, 1)
+		log.PanicIf(err)
+
+		return nil
+	}
+
+	for _, bucket := range dodBuckets {
+		if fitsSigned(dod, bucket.valueLength) == false {
+			continue
+		}
+
+		err := pe.bw.writeBits(bucket.prefix, bucket.prefixLength)
+		log.PanicIf(err)
+
+		err = pe.bw.writeBits(uint64(dod), bucket.valueLength)
+		log.PanicIf(err)
+
+		break
+	}
+
+	return nil
+}
+
+func (pe *pointEncoder) encodeValue(value uint64) (err error) {
+	defer func() {
+		if state := recover(); state != nil {
+			err = log.Wrap(state.(error))
+		}
+	}()
+
+	xor := value ^ pe.prevValue
+
+	if xor == 0 {
+		err := pe.bw.writeBits(0, 1)
+		log.PanicIf(err)
+
+		return nil
+	}
+
+	leading := uint(bits.LeadingZeros64(xor))
+	trailing := uint(bits.TrailingZeros64(xor))
+
+	if pe.hasWindow == true && leading >= pe.prevLeading && trailing >= pe.prevTrailing {
+		err := pe.bw.writeBits(0x2, 2)
+		log.PanicIf(err)
+
+		err = pe.bw.writeBits(xor>>pe.prevTrailing, 64-pe.prevLeading-pe.prevTrailing)
+		log.PanicIf(err)
+
+		return nil
+	}
+
+	meaningful := 64 - leading - trailing
+
+	err = pe.bw.writeBits(0x3, 2)
+	log.PanicIf(err)
+
+	err = pe.bw.writeBits(uint64(leading), 6)
+	log.PanicIf(err)
+
+	err = pe.bw.writeBits(uint64(meaningful-1), 6)
+	log.PanicIf(err)
+
+	err = pe.bw.writeBits(xor>>trailing, meaningful)
+	log.PanicIf(err)
+
+	pe.prevLeading = leading
+	pe.prevTrailing = trailing
+	pe.hasWindow = true
+
+	return nil
+}
+
+// pointDecoder holds the state carried from one point to the next.
+type pointDecoder struct {
+	br *bitReader
+
+	count         uint64
+	decoded       uint64
+	prevTimestamp int64
+	prevDelta     int64
+	prevValue     uint64
+	prevLeading   uint
+	prevTrailing  uint
+}
+
+func newPointDecoder(r io.ByteReader) (pd *pointDecoder, err error) {
+	defer func() {
+		if state := recover(); state != nil {
+			err = log.Wrap(state.(error))
+		}
+	}()
+
+	br := newBitReader(r)
+
+	count, err := br.readBits(64)
+	log.PanicIf(err)
+
+	pd = &pointDecoder{
+		br:    br,
+		count: count,
+	}
+
+	return pd, nil
+}
+
+// decode returns the next point or `io.EOF` after the last one.
+func (pd *pointDecoder) decode() (p Point, err error) {
+	defer func() {
+		if state := recover(); state != nil {
+			err = log.Wrap(state.(error))
+		}
+	}()
+
+	if pd.decoded >= pd.count {
+		return p, io.EOF
+	}
+
+	if pd.decoded == 0 {
+		timestamp, err := pd.br.readBits(64)
+		log.PanicIf(err)
+
+		value, err := pd.br.readBits(64)
+		log.PanicIf(err)
+
+		pd.prevTimestamp = int64(timestamp)
+		pd.prevValue = value
+	} else {
+		err := pd.decodeTimestamp()
+		log.PanicIf(err)
+
+		err = pd.decodeValue()
+		log.PanicIf(err)
+	}
+
+	pd.decoded++
+
+	p = Point{
+		Timestamp: time.Unix(0, pd.prevTimestamp).UTC(),
+		Value:     math.Float64frombits(pd.prevValue),
+	}
+
+	return p, nil
+}
+
+func (pd *pointDecoder) decodeTimestamp() (err error) {
+	defer func() {
+		if state := recover(); state != nil {
+			err = log.Wrap(state.(error))
+		}
+	}()
+
+	// Count the leading ones (up to four) to find the bucket.
+
+	ones := 0
+	for ones < len(dodBuckets) {
+		bit, err := pd.br.readBits(1)
+		log.PanicIf(err)
+
+		if bit == 0 {
+			break
+		}
+
+		ones++
+	}
+
+	dod := int64(0)
+	if ones > 0 {
+		valueLength := dodBuckets[ones-1].valueLength
+
+		raw, err := pd.br.readBits(valueLength)
+		log.PanicIf(err)
+
+		dod = signExtend(raw, valueLength)
+	}
+
+	pd.prevDelta += dod
+	pd.prevTimestamp += pd.prevDelta
+
+	return nil
+}
+
+func (pd *pointDecoder) decodeValue() (err error) {
+	defer func() {
+		if state := recover(); state != nil {
+			err = log.Wrap(state.(error))
+		}
+	}()
+
+	bit, err := pd.br.readBits(1)
+	log.PanicIf(err)
+
+	if bit == 0 {
+		return nil
+	}
+
+	bit, err = pd.br.readBits(1)
+	log.PanicIf(err)
+
+	if bit == 1 {
+		leading, err := pd.br.readBits(6)
+		log.PanicIf(err)
+
+		meaningful, err := pd.br.readBits(6)
+		log.PanicIf(err)
+
+		pd.prevLeading = uint(leading)
+		pd.prevTrailing = 64 - uint(leading) - uint(meaningful+1)
+	}
+
+	meaningful := 64 - pd.prevLeading - pd.prevTrailing
+
+	xor, err := pd.br.readBits(meaningful)
+	log.PanicIf(err)
+
+	pd.prevValue ^= xor << pd.prevTrailing
+
+	return nil
+}
+
+// >>>>>>>>>>>>>>>>>>>>>>>>>>>>>>
+// Point encoder/decoder wrappers
+// <<<<<<<<<<<<<<<<<<<<<<<<<<<<<<
+
+// PointsEncoderDatasource compresses (timestamp, float64) points and satisfies
+// `SeriesDataDatasourceWriter`. Timestamps are delta-of-delta encoded and
+// values are XOR encoded, so regular intervals and slowly-changing values take
+// very little space. The head and tail times (the earliest and latest
+// timestamps), the record count, and the SHA1 of the encoded points are
+// provided via `SeriesSummary`, and the builder sets them on the series footer
+// before the footer is written.
+type PointsEncoderDatasource struct {
+	points []Point
+
+	headRecordTime time.Time
+	tailRecordTime time.Time
+	sourceSha1     []byte
+}
+
+// NewPointsEncoderDatasource returns a new `PointsEncoderDatasource` struct.
+// There must be at least one point.
+func NewPointsEncoderDatasource(points []Point) *PointsEncoderDatasource {
+	return &PointsEncoderDatasource{
+		points: points,
+	}
+}
+
+// encode writes the points to the given writer and returns their summary.
+func (ped *PointsEncoderDatasource) encode(w io.Writer) (headRecordTime, tailRecordTime time.Time, sourceSha1 []byte, err error) {
+	defer func() {
+		if state := recover(); state != nil {
+			err = log.Wrap(state.(error))
+		}
+	}()
+
+	if len(ped.points) == 0 {
+		log.Panicf("no points to encode")
+	}
+
+	h := sha1.New()
+	bw := newBitWriter(io.MultiWriter(w, h))
+
+	err = bw.writeBits(uint64(len(ped.points)), 64)
+	log.PanicIf(err)
+
+	pe := &pointEncoder{
+		bw: bw,
+	}
+
+	for i, p := range ped.points {
+		if i == 0 || p.Timestamp.Before(headRecordTime) == true {
+			headRecordTime = p.Timestamp
+		}
+
+		if i == 0 || p.Timestamp.After(tailRecordTime) == true {
+			tailRecordTime = p.Timestamp
+		}
+
+		err := pe.encode(p)
+		log.PanicIf(err)
+	}
+
+	err = bw.flush()
+	log.PanicIf(err)
+
+	return headRecordTime, tailRecordTime, h.Sum(nil), nil
+}
+
+// NewSeriesFooter returns a new series footer with the fields derived from the
+// points. This is needed when the footer has to be known before the data is
+// written (e.g. to let `Updater` determine whether the series has changed).
+func (ped *PointsEncoderDatasource) NewSeriesFooter() (sf *SeriesFooter1, err error) {
+	defer func() {
+		if state := recover(); state != nil {
+			err = log.Wrap(state.(error))
+		}
+	}()
+
+	headRecordTime, tailRecordTime, sourceSha1, err := ped.encode(ioutil.Discard)
+	log.PanicIf(err)
+
+	sf = NewSeriesFooter1(headRecordTime, tailRecordTime, uint64(len(ped.points)), sourceSha1)
+
+	return sf, nil
+}
+
+// WriteData is called when series data needs to be written. It encodes the
+// points and keeps the fields derived from them for `SeriesSummary`.
+func (ped *PointsEncoderDatasource) WriteData(w io.Writer, sf SeriesFooter) (n int, err error) {
+	defer func() {
+		if state := recover(); state != nil {
+			err = log.Wrap(state.(error))
+		}
+	}()
+
+	wc := rifs.NewWriteCounter(w)
+
+	headRecordTime, tailRecordTime, sourceSha1, err := ped.encode(wc)
+	log.PanicIf(err)
+
+	ped.headRecordTime = headRecordTime
+	ped.tailRecordTime = tailRecordTime
+	ped.sourceSha1 = sourceSha1
+
+	return wc.Count(), nil
+}
+
+// SeriesSummary returns the head and tail times, record count, and source SHA1
+// derived by the last `WriteData` call. This satisfies
+// `SeriesDataDatasourceSummarizer`.
+func (ped *PointsEncoderDatasource) SeriesSummary() (headRecordTime, tailRecordTime time.Time, recordCount uint64, sourceSha1 []byte) {
+	return ped.headRecordTime, ped.tailRecordTime, uint64(len(ped.points)), ped.sourceSha1
+}
+
+// PointsDecoderDatasource decodes points into a slice. It satisfies
+// `SeriesDataDatasourceReader`.
+type PointsDecoderDatasource struct {
+	points []Point
+}
+
+// NewPointsDecoderDatasource returns a new `PointsDecoderDatasource` struct.
+func NewPointsDecoderDatasource() *PointsDecoderDatasource {
+	return new(PointsDecoderDatasource)
+}
+
+// Points returns the points decoded by the last read.
+func (pdd *PointsDecoderDatasource) Points() []Point {
+	return pdd.points
+}
+
+// ReadData is called when series data needs to be read and decodes all of the
+// points.
+func (pdd *PointsDecoderDatasource) ReadData(r io.Reader, sf SeriesFooter) (n int, err error) {
+	defer func() {
+		if state := recover(); state != nil {
+			err = log.Wrap(state.(error))
+		}
+	}()
+
+	rc := rifs.NewReadCounter(r)
+	br := bufio.NewReader(rc)
+
+	pd, err := newPointDecoder(br)
+	log.PanicIf(err)
+
+	pdd.points = make([]Point, 0)
+
+	for {
+		p, err := pd.decode()
+		if err != nil {
+			if err == io.EOF {
+				break
+			}
+
+			log.Panic(err)
+		}
+
+		pdd.points = append(pdd.points, p)
+	}
+
+	// Consume the padding.
+
+	_, err = io.Copy(ioutil.Discard, br)
+	log.PanicIf(err)
+
+	return rc.Count(), nil
+}
+
+// PointIterator decodes the points in one series on demand. The series is read
+// in the background as the points are consumed.
+type PointIterator struct {
+	sdp *seriesDataPipe
+	br  *bufio.Reader
+	pd  *pointDecoder
+}
+
+// NewPointIterator returns a new `PointIterator` struct for the given series.
+// The `StreamReader` must not be used for anything else until the iterator has
+// returned `io.EOF` or has been closed.
+func NewPointIterator(sr *StreamReader, sisi StreamIndexedSequenceInfo) *PointIterator {
+	sdp := newSeriesDataPipe(sr, sisi)
+
+	return &PointIterator{
+		sdp: sdp,
+		br:  bufio.NewReader(sdp),
+	}
+}
+
+// Next returns the next point. It returns `io.EOF` after the last point. If the
+// series fails its checksum, `ErrSeriesChecksumMismatch` is returned instead of
+// `io.EOF`.
+func (pi *PointIterator) Next() (p Point, err error) {
+	defer func() {
+		if state := recover(); state != nil {
+			err = log.Wrap(state.(error))
+		}
+	}()
+
+	if pi.pd == nil {
+		pi.pd, err = newPointDecoder(pi.br)
+		log.PanicIf(err)
+	}
+
+	p, err = pi.pd.decode()
+	if err == io.EOF {
+		// Consume the padding so that the checksum is verified.
+
+		_, err := io.Copy(ioutil.Discard, pi.br)
+		log.PanicIf(err)
+
+		return p, io.EOF
+	} else if err != nil {
+		log.Panic(err)
+	}
+
+	return p, nil
+}
+
+// Close stops reading the series. It must be called if the iterator is
+// abandoned before it returns `io.EOF`.
+func (pi *PointIterator) Close() (err error) {
+	return pi.sdp.Close()
+}
@@ -0,0 +1,188 @@
+package timetogo
+
+import (
+	"bytes"
+	"io"
+	"math"
+	"reflect"
+	"testing"
+	"time"
+
+	"io/ioutil"
+
+	"github.com/dsoprea/go-logging"
+	"github.com/randomingenuity/go-utility/filesystem"
+)
+
+func getTestPoints() []Point {
+	headRecordTime := time.Date(2016, 10, 1, 12, 34, 56, 0, time.UTC)
+
+	points := make([]Point, 0)
+	for i := 0; i < 1000; i++ {
+		p := Point{
+			Timestamp: headRecordTime.Add(time.Second * 10 * time.Duration(i)),
+			Value:     20 + float64(i%7)/4,
+		}
+
+		points = append(points, p)
+	}
+
+	// Irregular intervals, a large jump, a timestamp that goes backwards, and
+	// special values.
+
+	extra := []Point{
+		{Timestamp: headRecordTime.Add(time.Hour*3 + time.Millisecond*13), Value: -1.25},
+		{Timestamp: headRecordTime.Add(time.Hour * 24 * 365), Value: math.MaxFloat64},
+		{Timestamp: headRecordTime.Add(-time.Hour), Value: 0},
+		{Timestamp: headRecordTime.Add(-time.Hour + time.Nanosecond), Value: math.Inf(-1)},
+		{Timestamp: headRecordTime.Add(-time.Hour + time.Nanosecond*2), Value: math.SmallestNonzeroFloat64},
+	}
+
+	return append(points, extra...)
+}
+
+func TestPointsDatasource(t *testing.T) {
+	points := getTestPoints()
+
+	sb := rifs.NewSeekableBuffer()
+	streamBuilder := NewStreamBuilder(sb)
+
+	seriesFooter := NewSeriesFooter1(time.Time{}, time.Time{}, 0, nil)
+
+	err := streamBuilder.AddSeries(NewPointsEncoderDatasource(points), seriesFooter)
+	log.PanicIf(err)
+
+	_, err = streamBuilder.Finish()
+	log.PanicIf(err)
+
+	// Regular points should only need a few bits each.
+
+	if seriesFooter.BytesLength() > uint64(len(points)*2) {
+		t.Fatalf("Points not compressed: (%d)", seriesFooter.BytesLength())
+	}
+
+	sr := NewStreamReader(sb)
+
+	it, err := NewIterator(sr)
+	log.PanicIf(err)
+
+	sisi := it.SeriesInfo(0)
+
+	headRecordTime := time.Date(2016, 10, 1, 12, 34, 56, 0, time.UTC)
+
+	if sisi.HeadRecordTime() != headRecordTime.Add(-time.Hour) {
+		t.Fatalf("Head time not correct: [%s]", sisi.HeadRecordTime())
+	} else if sisi.TailRecordTime() != headRecordTime.Add(time.Hour*24*365) {
+		t.Fatalf("Tail time not correct: [%s]", sisi.TailRecordTime())
+	}
+
+	pdd := NewPointsDecoderDatasource()
+
+	recoveredSeriesFooter, _, checksumOk, err := sr.ReadSeriesWithIndexedInfo(sisi, pdd)
+	log.PanicIf(err)
+
+	if checksumOk != true {
+		t.Fatalf("Checksum not correct.")
+	} else if recoveredSeriesFooter.RecordCount() != uint64(len(points)) {
+		t.Fatalf("Record count not correct: (%d)", recoveredSeriesFooter.RecordCount())
+	} else if reflect.DeepEqual(pdd.Points(), points) != true {
+		t.Fatalf("Points not correct.")
+	}
+}
+
+func TestPointIterator(t *testing.T) {
+	points := getTestPoints()
+
+	ped := NewPointsEncoderDatasource(points)
+
+	seriesFooter, err := ped.NewSeriesFooter()
+	log.PanicIf(err)
+
+	sb := rifs.NewSeekableBuffer()
+	streamBuilder := NewStreamBuilder(sb)
+
+	err = streamBuilder.AddSeries(ped, seriesFooter)
+	log.PanicIf(err)
+
+	_, err = streamBuilder.Finish()
+	log.PanicIf(err)
+
+	sr := NewStreamReader(sb)
+
+	it, err := NewIterator(sr)
+	log.PanicIf(err)
+
+	pi := NewPointIterator(sr, it.SeriesInfo(0))
+
+	recovered := make([]Point, 0)
+	for {
+		p, err := pi.Next()
+		if err == io.EOF {
+			break
+		}
+
+		log.PanicIf(err)
+
+		recovered = append(recovered, p)
+	}
+
+	if reflect.DeepEqual(recovered, points) != true {
+		t.Fatalf("Points not correct.")
+	}
+}
+
+func TestPointsEncoderDatasource_NewSeriesFooter(t *testing.T) {
+	ped := NewPointsEncoderDatasource(getTestPoints())
+
+	sf, err := ped.NewSeriesFooter()
+	log.PanicIf(err)
+
+	_, err = ped.WriteData(new(bytes.Buffer), NewSeriesFooter1(time.Time{}, time.Time{}, 0, nil))
+	log.PanicIf(err)
+
+	headRecordTime, tailRecordTime, recordCount, sourceSha1 := ped.SeriesSummary()
+
+	if sf.HeadRecordTime().Equal(headRecordTime) != true || sf.TailRecordTime().Equal(tailRecordTime) != true {
+		t.Fatalf("Times not correct: %s", sf)
+	} else if sf.RecordCount() != recordCount {
+		t.Fatalf("Record count not correct: (%d)", sf.RecordCount())
+	} else if bytes.Equal(sf.SourceSha1(), sourceSha1) != true {
+		t.Fatalf("Source SHA1 not correct: [%x]", sf.SourceSha1())
+	}
+}
+
+func TestPointsDecoderDatasource_Truncated(t *testing.T) {
+	b := new(bytes.Buffer)
+
+	_, err := NewPointsEncoderDatasource(getTestPoints()).WriteData(b, NewSeriesFooter1(time.Time{}, time.Time{}, 0, nil))
+	log.PanicIf(err)
+
+	truncated := b.Bytes()[:b.Len()/2]
+
+	_, err = NewPointsDecoderDatasource().ReadData(bytes.NewReader(truncated), nil)
+	if err == nil {
+		t.Fatalf("Expected failure for truncated data.")
+	} else if log.Is(err, io.ErrUnexpectedEOF) != true {
+		log.Panic(err)
+	}
+}
+
+func TestPointsEncoderDatasource_TimestampOutOfRange(t *testing.T) {
+	outOfRange := []time.Time{
+		time.Time{},
+		time.Date(1677, 1, 1, 0, 0, 0, 0, time.UTC),
+		time.Date(2263, 1, 1, 0, 0, 0, 0, time.UTC),
+	}
+
+	for _, timestamp := range outOfRange {
+		points := getTestPoints()
+		points[1].Timestamp = timestamp
+
+		_, err := NewPointsEncoderDatasource(points).WriteData(ioutil.Discard, NewSeriesFooter1(time.Time{}, time.Time{}, 0, nil))
+		if err == nil {
+			t.Fatalf("Expected failure for timestamp [%s].", timestamp)
+		} else if log.Is(err, ErrPointTimestampOutOfRange) != true {
+			log.Panic(err)
+		}
+	}
+}
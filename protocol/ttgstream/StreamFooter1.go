@@ -46,8 +46,28 @@ func (rcv *StreamFooter1) SeriesLength() int {
 	return 0
 }
 
+func (rcv *StreamFooter1) FreeRegions(obj *StreamFreeRegion, j int) bool {
+	o := flatbuffers.UOffsetT(rcv._tab.Offset(6))
+	if o != 0 {
+		x := rcv._tab.Vector(o)
+		x += flatbuffers.UOffsetT(j) * 4
+		x = rcv._tab.Indirect(x)
+		obj.Init(rcv._tab.Bytes, x)
+		return true
+	}
+	return false
+}
+
+func (rcv *StreamFooter1) FreeRegionsLength() int {
+	o := flatbuffers.UOffsetT(rcv._tab.Offset(6))
+	if o != 0 {
+		return rcv._tab.VectorLen(o)
+	}
+	return 0
+}
+
 func StreamFooter1Start(builder *flatbuffers.Builder) {
-	builder.StartObject(1)
+	builder.StartObject(2)
 }
 func StreamFooter1AddSeries(builder *flatbuffers.Builder, series flatbuffers.UOffsetT) {
 	builder.PrependUOffsetTSlot(0, flatbuffers.UOffsetT(series), 0)
@@ -55,6 +75,12 @@ func StreamFooter1AddSeries(builder *flatbuffers.Builder, series flatbuffers.UOf
 func StreamFooter1StartSeriesVector(builder *flatbuffers.Builder, numElems int) flatbuffers.UOffsetT {
 	return builder.StartVector(4, numElems, 4)
 }
+func StreamFooter1AddFreeRegions(builder *flatbuffers.Builder, freeRegions flatbuffers.UOffsetT) {
+	builder.PrependUOffsetTSlot(1, flatbuffers.UOffsetT(freeRegions), 0)
+}
+func StreamFooter1StartFreeRegionsVector(builder *flatbuffers.Builder, numElems int) flatbuffers.UOffsetT {
+	return builder.StartVector(4, numElems, 4)
+}
 func StreamFooter1End(builder *flatbuffers.Builder) flatbuffers.UOffsetT {
 	return builder.EndObject()
 }
@@ -0,0 +1,387 @@
+package timetogo
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+	"sort"
+	"time"
+
+	"container/heap"
+	"encoding/gob"
+
+	"github.com/dsoprea/go-logging"
+)
+
+var (
+	queryLogger = log.NewLogger("timetogo.query")
+)
+
+var (
+	// ErrQueryRecordsNotOrdered indicates that a series returned a record that
+	// was earlier than the record before it, or earlier than a record already
+	// returned from another series (e.g. the head time in its footer was
+	// wrong). The merge relies on the records in each series being in time
+	// order.
+	ErrQueryRecordsNotOrdered = errors.New("query records not in time order")
+)
+
+// RecordDecoder decodes the records in one series, in order.
+type RecordDecoder interface {
+	// Next returns the next record and its timestamp. It returns `io.EOF`
+	// after the last record.
+	Next() (record interface{}, timestamp time.Time, err error)
+}
+
+// RecordDecoderFactory returns a `RecordDecoder` for the data of one series.
+// `r` only returns the data for that series.
+type RecordDecoderFactory func(r io.Reader, sf SeriesFooter) (rd RecordDecoder, err error)
+
+// gobRecordDecoder decodes records written with `GobPartitionEncoder` or
+// `GobRecordEncoderDatasource`.
+type gobRecordDecoder struct {
+	d           *gob.Decoder
+	newRecord   func() interface{}
+	timestampOf PartitionTimestampGetter
+}
+
+// Next decodes the next record.
+func (grd *gobRecordDecoder) Next() (record interface{}, timestamp time.Time, err error) {
+	record = grd.newRecord()
+
+	err = grd.d.Decode(record)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+
+	return record, grd.timestampOf(record), nil
+}
+
+// GobRecordDecoderFactory returns a `RecordDecoderFactory` for series of gob
+// records (e.g. from `Partitioner` with `GobPartitionEncoder`). `newRecord`
+// returns a pointer to decode the next record into, and `timestampOf` is given
+// that pointer.
+func GobRecordDecoderFactory(newRecord func() interface{}, timestampOf PartitionTimestampGetter) RecordDecoderFactory {
+	return func(r io.Reader, sf SeriesFooter) (rd RecordDecoder, err error) {
+		grd := &gobRecordDecoder{
+			d:           gob.NewDecoder(r),
+			newRecord:   newRecord,
+			timestampOf: timestampOf,
+		}
+
+		return grd, nil
+	}
+}
+
+// pointRecordDecoder decodes series written with `PointsEncoderDatasource`.
+type pointRecordDecoder struct {
+	br *bufio.Reader
+	pd *pointDecoder
+}
+
+// Next decodes the next point. The record is a `Point`.
+func (prd *pointRecordDecoder) Next() (record interface{}, timestamp time.Time, err error) {
+	defer func() {
+		if state := recover(); state != nil {
+			err = log.Wrap(state.(error))
+		}
+	}()
+
+	if prd.pd == nil {
+		prd.pd, err = newPointDecoder(prd.br)
+		log.PanicIf(err)
+	}
+
+	p, err := prd.pd.decode()
+	if err == io.EOF {
+		return nil, time.Time{}, io.EOF
+	}
+
+	log.PanicIf(err)
+
+	return p, p.Timestamp, nil
+}
+
+// NewPointRecordDecoder is a `RecordDecoderFactory` for series written with
+// `PointsEncoderDatasource`. Each record is a `Point`.
+func NewPointRecordDecoder(r io.Reader, sf SeriesFooter) (rd RecordDecoder, err error) {
+	prd := &pointRecordDecoder{
+		br: bufio.NewReader(r),
+	}
+
+	return prd, nil
+}
+
+// QueriedRecord is one record returned by a query.
+type QueriedRecord struct {
+	Timestamp time.Time
+	Record    interface{}
+
+	// SeriesFooter is the footer of the series that the record came from.
+	SeriesFooter SeriesFooter
+}
+
+// recordQuerySource is a series that is being merged.
+type recordQuerySource struct {
+	// position is the position of the series in the stream. It breaks ties
+	// between records with the same timestamp.
+	position int
+
+	sf SeriesFooter
+	rd RecordDecoder
+
+	record        interface{}
+	timestamp     time.Time
+	lastTimestamp time.Time
+	hasDecoded    bool
+}
+
+// recordQueryHeap orders the active sources by their current record.
+type recordQueryHeap []*recordQuerySource
+
+func (rqh recordQueryHeap) Len() int {
+	return len(rqh)
+}
+
+func (rqh recordQueryHeap) Less(i, j int) bool {
+	if rqh[i].timestamp.Equal(rqh[j].timestamp) == true {
+		return rqh[i].position < rqh[j].position
+	}
+
+	return rqh[i].timestamp.Before(rqh[j].timestamp)
+}
+
+func (rqh recordQueryHeap) Swap(i, j int) {
+	rqh[i], rqh[j] = rqh[j], rqh[i]
+}
+
+func (rqh *recordQueryHeap) Push(x interface{}) {
+	*rqh = append(*rqh, x.(*recordQuerySource))
+}
+
+func (rqh *recordQueryHeap) Pop() interface{} {
+	old := *rqh
+	rqs := old[len(old)-1]
+	*rqh = old[:len(old)-1]
+
+	return rqs
+}
+
+// pendingRecordQuerySeries is a series that matched the query but hasn't been
+// read yet.
+type pendingRecordQuerySeries struct {
+	position int
+	sisi     StreamIndexedSequenceInfo
+}
+
+// RecordQuery reads the records in a time range across all of the series in a
+// stream that intersect it, as one stream of records in time order.
+type RecordQuery struct {
+	index   *Index
+	factory RecordDecoderFactory
+}
+
+// NewRecordQuery returns a new `RecordQuery` struct. The factory provides the
+// decoder for each series.
+func NewRecordQuery(index *Index, factory RecordDecoderFactory) *RecordQuery {
+	return &RecordQuery{
+		index:   index,
+		factory: factory,
+	}
+}
+
+// Range returns a cursor over the records from `start` to `end` (inclusive).
+// The records in each series must be in time order. Series that overlap are
+// merged, and records with the same timestamp are returned in stream order.
+// The `Index` must not be used to read anything else until the cursor has
+// returned `io.EOF` or an error.
+func (rq *RecordQuery) Range(start, end time.Time) (rc *RecordCursor, err error) {
+	defer func() {
+		if state := recover(); state != nil {
+			err = log.Wrap(state.(error))
+		}
+	}()
+
+	if start.After(end) == true {
+		log.Panicf("query start (%s) is after end (%s)", start, end)
+	}
+
+	pending := make([]pendingRecordQuerySeries, 0)
+	for position, sisi := range rq.index.Series() {
+		if seriesIntersectsRange(sisi, start, end) == false {
+			continue
+		}
+
+		prqs := pendingRecordQuerySeries{
+			position: position,
+			sisi:     sisi,
+		}
+
+		pending = append(pending, prqs)
+	}
+
+	sort.SliceStable(pending, func(i, j int) bool {
+		return pending[i].sisi.HeadRecordTime().Before(pending[j].sisi.HeadRecordTime())
+	})
+
+	queryLogger.Debugf(nil, "Querying (%d) series from [%s] to [%s].", len(pending), start, end)
+
+	rc = &RecordCursor{
+		query:   rq,
+		start:   start,
+		end:     end,
+		pending: pending,
+		active:  make(recordQueryHeap, 0),
+	}
+
+	return rc, nil
+}
+
+// RecordCursor returns the records found by a query. Each series is read only
+// once the merge reaches its head time, and all of its data is held in memory
+// while its records are being returned.
+type RecordCursor struct {
+	query *RecordQuery
+	start time.Time
+	end   time.Time
+
+	pending []pendingRecordQuerySeries
+	active  recordQueryHeap
+
+	lastTimestamp time.Time
+	hasReturned   bool
+}
+
+// Next returns the next record. It returns `io.EOF` after the last record.
+func (rc *RecordCursor) Next() (qr QueriedRecord, err error) {
+	defer func() {
+		if state := recover(); state != nil {
+			err = log.Wrap(state.(error))
+		}
+	}()
+
+	// Start reading any series that could have a record before the earliest
+	// one that we already have.
+
+	for len(rc.pending) > 0 {
+		if len(rc.active) > 0 && rc.pending[0].sisi.HeadRecordTime().After(rc.active[0].timestamp) == true {
+			break
+		}
+
+		prqs := rc.pending[0]
+		rc.pending = rc.pending[1:]
+
+		rqs, err := rc.open(prqs)
+		log.PanicIf(err)
+
+		if rqs != nil {
+			heap.Push(&rc.active, rqs)
+		}
+	}
+
+	if len(rc.active) == 0 {
+		return qr, io.EOF
+	}
+
+	rqs := rc.active[0]
+
+	if rc.hasReturned == true && rqs.timestamp.Before(rc.lastTimestamp) == true {
+		log.Panic(ErrQueryRecordsNotOrdered)
+	}
+
+	qr = QueriedRecord{
+		Timestamp:    rqs.timestamp,
+		Record:       rqs.record,
+		SeriesFooter: rqs.sf,
+	}
+
+	rc.lastTimestamp = rqs.timestamp
+	rc.hasReturned = true
+
+	found, err := rc.advance(rqs)
+	log.PanicIf(err)
+
+	if found == true {
+		heap.Fix(&rc.active, 0)
+	} else {
+		heap.Pop(&rc.active)
+	}
+
+	return qr, nil
+}
+
+// open reads the data for the series and moves to its first record in range.
+// Returns nil if it has none.
+func (rc *RecordCursor) open(prqs pendingRecordQuerySeries) (rqs *recordQuerySource, err error) {
+	defer func() {
+		if state := recover(); state != nil {
+			err = log.Wrap(state.(error))
+		}
+	}()
+
+	b := new(bytes.Buffer)
+
+	sf, _, checksumOk, err := rc.query.index.sr.ReadSeriesWithIndexedInfo(prqs.sisi, b)
+	log.PanicIf(err)
+
+	if checksumOk == false {
+		log.Panic(ErrSeriesChecksumMismatch)
+	}
+
+	rd, err := rc.query.factory(b, sf)
+	log.PanicIf(err)
+
+	rqs = &recordQuerySource{
+		position: prqs.position,
+		sf:       sf,
+		rd:       rd,
+	}
+
+	found, err := rc.advance(rqs)
+	log.PanicIf(err)
+
+	if found == false {
+		return nil, nil
+	}
+
+	return rqs, nil
+}
+
+// advance moves the source to its next record in range. Returns false if there
+// are no more. Since the records are in order, the first record after the end
+// of the range finishes the series.
+func (rc *RecordCursor) advance(rqs *recordQuerySource) (found bool, err error) {
+	defer func() {
+		if state := recover(); state != nil {
+			err = log.Wrap(state.(error))
+		}
+	}()
+
+	for {
+		record, timestamp, err := rqs.rd.Next()
+		if err == io.EOF {
+			return false, nil
+		}
+
+		log.PanicIf(err)
+
+		if rqs.hasDecoded == true && timestamp.Before(rqs.lastTimestamp) == true {
+			log.Panic(ErrQueryRecordsNotOrdered)
+		}
+
+		rqs.lastTimestamp = timestamp
+		rqs.hasDecoded = true
+
+		if timestamp.Before(rc.start) == true {
+			continue
+		} else if timestamp.After(rc.end) == true {
+			return false, nil
+		}
+
+		rqs.record = record
+		rqs.timestamp = timestamp
+
+		return true, nil
+	}
+}
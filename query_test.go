@@ -0,0 +1,256 @@
+package timetogo
+
+import (
+	"io"
+	"testing"
+	"time"
+
+	"github.com/dsoprea/go-logging"
+	"github.com/randomingenuity/go-utility/filesystem"
+)
+
+func writeTestQueryPointsStream(series [][]Point) *rifs.SeekableBuffer {
+	sb := rifs.NewSeekableBuffer()
+	streamBuilder := NewStreamBuilder(sb)
+
+	for _, points := range series {
+		ped := NewPointsEncoderDatasource(points)
+
+		err := streamBuilder.AddSeries(ped, NewSeriesFooter1(time.Time{}, time.Time{}, 0, nil))
+		log.PanicIf(err)
+	}
+
+	_, err := streamBuilder.Finish()
+	log.PanicIf(err)
+
+	return sb
+}
+
+func readTestQueryRecords(rc *RecordCursor) (records []QueriedRecord) {
+	records = make([]QueriedRecord, 0)
+
+	for {
+		qr, err := rc.Next()
+		if err == io.EOF {
+			break
+		}
+
+		log.PanicIf(err)
+
+		records = append(records, qr)
+	}
+
+	return records
+}
+
+func TestRecordQuery_Range_Merge(t *testing.T) {
+	headRecordTime := time.Date(2016, 10, 1, 12, 34, 56, 0, time.UTC)
+
+	// The first two series overlap and interleave, and share one timestamp.
+	// The third is after both.
+
+	series := [][]Point{
+		{
+			{Timestamp: headRecordTime, Value: 1},
+			{Timestamp: headRecordTime.Add(time.Second * 2), Value: 3},
+			{Timestamp: headRecordTime.Add(time.Second * 4), Value: 5},
+			{Timestamp: headRecordTime.Add(time.Second * 6), Value: 7},
+		},
+		{
+			{Timestamp: headRecordTime.Add(time.Second * 1), Value: 2},
+			{Timestamp: headRecordTime.Add(time.Second * 3), Value: 4},
+			{Timestamp: headRecordTime.Add(time.Second * 4), Value: 6},
+			{Timestamp: headRecordTime.Add(time.Second * 5), Value: 6.5},
+		},
+		{
+			{Timestamp: headRecordTime.Add(time.Second * 10), Value: 8},
+			{Timestamp: headRecordTime.Add(time.Second * 11), Value: 9},
+			{Timestamp: headRecordTime.Add(time.Second * 20), Value: 10},
+		},
+	}
+
+	sb := writeTestQueryPointsStream(series)
+
+	index, err := NewIndex(sb)
+	log.PanicIf(err)
+
+	rq := NewRecordQuery(index, NewPointRecordDecoder)
+
+	rc, err := rq.Range(headRecordTime.Add(time.Second*1), headRecordTime.Add(time.Second*11))
+	log.PanicIf(err)
+
+	records := readTestQueryRecords(rc)
+
+	expected := []float64{2, 3, 4, 5, 6, 6.5, 7, 8, 9}
+	if len(records) != len(expected) {
+		t.Fatalf("Record count not correct: (%d)", len(records))
+	}
+
+	for i, qr := range records {
+		p := qr.Record.(Point)
+
+		if p.Value != expected[i] {
+			t.Fatalf("Record (%d) not correct: %v", i, p)
+		} else if qr.Timestamp.Equal(p.Timestamp) != true {
+			t.Fatalf("Record (%d) timestamp not correct: [%s]", i, qr.Timestamp)
+		}
+	}
+
+	// The tie is broken by stream order.
+
+	if records[3].SeriesFooter.Uuid() != index.Series()[0].Uuid() {
+		t.Fatalf("Record with tied timestamp not from the first series.")
+	} else if records[4].SeriesFooter.Uuid() != index.Series()[1].Uuid() {
+		t.Fatalf("Record with tied timestamp not from the second series.")
+	}
+}
+
+func TestRecordQuery_Range_NoSeries(t *testing.T) {
+	headRecordTime := time.Date(2016, 10, 1, 12, 34, 56, 0, time.UTC)
+
+	series := [][]Point{
+		{
+			{Timestamp: headRecordTime, Value: 1},
+		},
+	}
+
+	sb := writeTestQueryPointsStream(series)
+
+	index, err := NewIndex(sb)
+	log.PanicIf(err)
+
+	rq := NewRecordQuery(index, NewPointRecordDecoder)
+
+	rc, err := rq.Range(headRecordTime.Add(time.Second), headRecordTime.Add(time.Hour))
+	log.PanicIf(err)
+
+	_, err = rc.Next()
+	if err != io.EOF {
+		t.Fatalf("Expected EOF: %v", err)
+	}
+
+	_, err = rq.Range(headRecordTime.Add(time.Hour), headRecordTime)
+	if err == nil {
+		t.Fatalf("Expected failure for inverted range.")
+	}
+}
+
+func TestRecordQuery_Range_SubsecondTail(t *testing.T) {
+	headRecordTime := time.Date(2016, 10, 1, 12, 34, 56, 0, time.UTC)
+
+	// The footer stores the tail as 12:34:57, which is before the start of the
+	// query.
+
+	series := [][]Point{
+		{
+			{Timestamp: headRecordTime, Value: 1},
+			{Timestamp: headRecordTime.Add(time.Millisecond * 1500), Value: 2},
+		},
+	}
+
+	sb := writeTestQueryPointsStream(series)
+
+	index, err := NewIndex(sb)
+	log.PanicIf(err)
+
+	rq := NewRecordQuery(index, NewPointRecordDecoder)
+
+	rc, err := rq.Range(headRecordTime.Add(time.Millisecond*1200), headRecordTime.Add(time.Second*2))
+	log.PanicIf(err)
+
+	records := readTestQueryRecords(rc)
+
+	if len(records) != 1 {
+		t.Fatalf("Record count not correct: (%d)", len(records))
+	} else if records[0].Record.(Point).Value != 2 {
+		t.Fatalf("Record not correct: %v", records[0].Record)
+	}
+}
+
+func TestRecordQuery_Range_NotOrdered(t *testing.T) {
+	headRecordTime := time.Date(2016, 10, 1, 12, 34, 56, 0, time.UTC)
+
+	series := [][]Point{
+		{
+			{Timestamp: headRecordTime, Value: 1},
+			{Timestamp: headRecordTime.Add(time.Second * 2), Value: 2},
+			{Timestamp: headRecordTime.Add(time.Second * 1), Value: 3},
+		},
+	}
+
+	sb := writeTestQueryPointsStream(series)
+
+	index, err := NewIndex(sb)
+	log.PanicIf(err)
+
+	rq := NewRecordQuery(index, NewPointRecordDecoder)
+
+	rc, err := rq.Range(headRecordTime, headRecordTime.Add(time.Second*2))
+	log.PanicIf(err)
+
+	for {
+		_, err = rc.Next()
+		if err != nil {
+			break
+		}
+	}
+
+	if err == io.EOF {
+		t.Fatalf("Expected failure for records out of order.")
+	} else if log.Is(err, ErrQueryRecordsNotOrdered) != true {
+		log.Panic(err)
+	}
+}
+
+func TestRecordQuery_Range_Gob(t *testing.T) {
+	sb := rifs.NewSeekableBuffer()
+	streamBuilder := NewStreamBuilder(sb)
+
+	p := NewPartitioner(streamBuilder, PuDay, nil, testPartitionTimestamp, GobPartitionEncoder)
+
+	records := getTestPartitionRecords()
+	for _, record := range records {
+		err := p.Add(record)
+		log.PanicIf(err)
+	}
+
+	_, err := p.Finish()
+	log.PanicIf(err)
+
+	_, err = streamBuilder.Finish()
+	log.PanicIf(err)
+
+	index, err := NewIndex(sb)
+	log.PanicIf(err)
+
+	newRecord := func() interface{} {
+		return new(testPartitionRecord)
+	}
+
+	timestampOf := func(record interface{}) time.Time {
+		return record.(*testPartitionRecord).Timestamp
+	}
+
+	rq := NewRecordQuery(index, GobRecordDecoderFactory(newRecord, timestampOf))
+
+	// Span the end of the first day and the start of the third.
+
+	rc, err := rq.Range(records[3].Timestamp, records[8].Timestamp)
+	log.PanicIf(err)
+
+	queried := readTestQueryRecords(rc)
+
+	if len(queried) != 6 {
+		t.Fatalf("Record count not correct: (%d)", len(queried))
+	}
+
+	for i, qr := range queried {
+		tpr := qr.Record.(*testPartitionRecord)
+
+		if tpr.Value != i+3 {
+			t.Fatalf("Record (%d) not correct: %v", i, tpr)
+		} else if tpr.Timestamp.Equal(records[i+3].Timestamp) != true {
+			t.Fatalf("Record (%d) timestamp not correct: [%s]", i, tpr.Timestamp)
+		}
+	}
+}
@@ -0,0 +1,152 @@
+package timetogo
+
+import (
+	"io"
+	"os"
+
+	"github.com/dsoprea/go-logging"
+)
+
+var (
+	seriesAppendLogger = log.NewLogger("timetogo.series_append")
+)
+
+const (
+	fnv1a32Prime = 16777619
+)
+
+// fnv1a32Continuation continues an FNV-1a (32-bit) checksum from a previous
+// sum. The sum is the complete state of the hash, so the data that produced it
+// doesn't have to be reread.
+type fnv1a32Continuation uint32
+
+// Write adds the bytes to the checksum.
+func (fc *fnv1a32Continuation) Write(data []byte) (n int, err error) {
+	sum := uint32(*fc)
+	for _, c := range data {
+		sum ^= uint32(c)
+		sum *= fnv1a32Prime
+	}
+
+	*fc = fnv1a32Continuation(sum)
+
+	return len(data), nil
+}
+
+// Sum32 returns the current checksum.
+func (fc *fnv1a32Continuation) Sum32() uint32 {
+	return uint32(*fc)
+}
+
+// AppendToSeries appends data to the series that is physically last in the
+// stream (immediately in front of the stream footer) without rewriting the
+// data that is already there. The new data is written over the existing series
+// footer, and then the series footer and stream footer are written again. The
+// given footer must have the same UUID and describe the whole series after the
+// append (e.g. the new tail time and total record count). The bytes-length and
+// checksum are calculated, the created-time is retained, and the updated-time
+// is bumped. `seriesDataWriter` may be an `io.Reader` or a
+// `SeriesDataDatasourceWriter` and only provides the new data.
+func AppendToSeries(rws io.ReadWriteSeeker, seriesFooter SeriesFooter, seriesDataWriter interface{}) (totalSize int, err error) {
+	defer func() {
+		if state := recover(); state != nil {
+			err = log.Wrap(state.(error))
+		}
+	}()
+
+	sr := NewStreamReader(rws)
+
+	it, err := NewIterator(sr)
+	log.PanicIf(err)
+
+	// Find the series and make sure that it's the last one.
+
+	seriesPosition := -1
+	lastPosition := -1
+	for i := 0; i < it.Count(); i++ {
+		sisi := it.SeriesInfo(i)
+
+		if sisi.Uuid() == seriesFooter.Uuid() {
+			seriesPosition = i
+		}
+
+		if lastPosition == -1 || sisi.AbsolutePosition() > it.SeriesInfo(lastPosition).AbsolutePosition() {
+			lastPosition = i
+		}
+	}
+
+	if seriesPosition == -1 {
+		log.Panicf("series [%s] not found in stream", seriesFooter.Uuid())
+	} else if seriesPosition != lastPosition {
+		log.Panicf("series [%s] is not the last series in the stream", seriesFooter.Uuid())
+	}
+
+	existingSeriesFooter, dataOffset, existingSeriesSize, err := sr.ReadSeriesInfoWithIndexedInfo(it.SeriesInfo(seriesPosition))
+	log.PanicIf(err)
+
+	err = sr.Reset()
+	log.PanicIf(err)
+
+	_, _, _, streamFooterOffset, err := sr.readOneFooter()
+	log.PanicIf(err)
+
+	if dataOffset+int64(existingSeriesSize) != streamFooterOffset {
+		log.Panicf("series [%s] is not immediately followed by the stream footer: (%d) != (%d)", seriesFooter.Uuid(), dataOffset+int64(existingSeriesSize), streamFooterOffset)
+	}
+
+	// Write the new data over the existing series footer.
+
+	existingBytesLength := existingSeriesFooter.BytesLength()
+	footerPosition := dataOffset + int64(existingBytesLength)
+
+	_, err = rws.Seek(footerPosition, os.SEEK_SET)
+	log.PanicIf(err)
+
+	fc := fnv1a32Continuation(existingSeriesFooter.DataFnv1aChecksum())
+	teeWriter := io.MultiWriter(rws, &fc)
+
+	copiedCount, err := writeSeriesData(teeWriter, seriesDataWriter, seriesFooter)
+	log.PanicIf(err)
+
+	seriesAppendLogger.Debugf(nil, "Appended (%d) bytes to series [%s].", copiedCount, seriesFooter.Uuid())
+
+	// Write the series footer.
+
+	seriesFooter.SetBytesLength(existingBytesLength + copiedCount)
+	carryCreatedTime(seriesFooter, existingSeriesFooter.CreatedTime())
+	seriesFooter.TouchUpdatedTime()
+
+	sw := NewStreamWriter(rws)
+
+	footerSize, err := sw.writeSeriesFooter1(seriesFooter, fc.Sum32())
+	log.PanicIf(err)
+
+	seriesEnd := footerPosition + int64(copiedCount) + int64(footerSize)
+
+	// Write the stream footer.
+
+	indexedSeries := make([]StreamIndexedSequenceInfo, it.Count())
+	for i := 0; i < it.Count(); i++ {
+		if i == seriesPosition {
+			indexedSeries[i] = NewStreamIndexedSequenceInfo1WithSeriesFooter(seriesFooter, seriesEnd-1)
+		} else {
+			indexedSeries[i] = it.SeriesInfo(i)
+		}
+	}
+
+	streamFooter := NewStreamFooter1WithFreeRegions(indexedSeries, it.FreeRegions())
+
+	streamFooterSize, err := sw.writeStreamFooter(streamFooter)
+	log.PanicIf(err)
+
+	totalSize = int(seriesEnd) + streamFooterSize
+
+	if truncater, ok := rws.(Truncater); ok == true {
+		seriesAppendLogger.Debugf(nil, "Underlying RWS is also a truncater. Truncating stream to right size after append.")
+
+		err = truncater.Truncate(int64(totalSize))
+		log.PanicIf(err)
+	}
+
+	return totalSize, nil
+}
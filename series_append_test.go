@@ -0,0 +1,122 @@
+package timetogo
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"hash/fnv"
+
+	"github.com/dsoprea/go-logging"
+	"github.com/randomingenuity/go-utility/filesystem"
+)
+
+func TestFnv1a32Continuation(t *testing.T) {
+	h := fnv.New32a()
+
+	_, err := h.Write([]byte("abc"))
+	log.PanicIf(err)
+
+	fc := fnv1a32Continuation(h.Sum32())
+
+	_, err = fc.Write([]byte("def"))
+	log.PanicIf(err)
+
+	expected := fnv.New32a()
+
+	_, err = expected.Write([]byte("abcdef"))
+	log.PanicIf(err)
+
+	if fc.Sum32() != expected.Sum32() {
+		t.Fatalf("Continued checksum not correct: (%d) != (%d)", fc.Sum32(), expected.Sum32())
+	}
+}
+
+func TestAppendToSeries(t *testing.T) {
+	raw, series, _ := WriteTestMultiseriesStream()
+
+	originalRaw := make([]byte, len(raw))
+	copy(originalRaw, raw)
+
+	extraData := []byte("more data")
+	newTailRecordTime := series[1].TailRecordTime().Add(time.Hour)
+
+	appended := NewSeriesFooter1WithUuid(
+		series[1].Uuid(),
+		series[1].HeadRecordTime(),
+		newTailRecordTime,
+		series[1].RecordCount()+3,
+		series[1].SourceSha1())
+
+	rws := rifs.NewSeekableBufferWithBytes(raw)
+
+	totalSize, err := AppendToSeries(rws, appended, bytes.NewBuffer(extraData))
+	log.PanicIf(err)
+
+	if totalSize != len(originalRaw)+len(extraData) {
+		t.Fatalf("Total size not correct: (%d)", totalSize)
+	}
+
+	finalRaw := rws.Bytes()[:totalSize]
+
+	// The first series and the existing data of the second one shouldn't have
+	// been touched.
+
+	unchangedSize := 171 + len(TestTimeSeriesData2)
+	if bytes.Compare(finalRaw[:unchangedSize], originalRaw[:unchangedSize]) != 0 {
+		t.Fatalf("Existing data was modified.")
+	}
+
+	// This also verifies the checksums.
+	footers, data := readTestStreamSeries(finalRaw)
+
+	expectedData := append(append([]byte{}, TestTimeSeriesData2...), extraData...)
+
+	if len(footers) != 2 {
+		t.Fatalf("Series count not correct: (%d)", len(footers))
+	} else if bytes.Compare(data[0], TestTimeSeriesData) != 0 {
+		t.Fatalf("First series data not correct.")
+	} else if bytes.Compare(data[1], expectedData) != 0 {
+		t.Fatalf("Appended series data not correct: [%s]", string(data[1]))
+	}
+
+	sf := footers[1]
+
+	if sf.BytesLength() != uint64(len(expectedData)) {
+		t.Fatalf("Bytes-length not correct: (%d)", sf.BytesLength())
+	} else if sf.TailRecordTime().Equal(newTailRecordTime) == false {
+		t.Fatalf("Tail time not correct: [%s]", sf.TailRecordTime())
+	} else if sf.RecordCount() != series[1].RecordCount()+3 {
+		t.Fatalf("Record count not correct: (%d)", sf.RecordCount())
+	} else if sf.CreatedTime().Equal(series[1].CreatedTime()) == false {
+		t.Fatalf("Created-time not retained.")
+	}
+
+	index, err := NewIndex(bytes.NewReader(finalRaw))
+	log.PanicIf(err)
+
+	sisi, found := index.GetWithUuid(series[1].Uuid())
+	if found == false {
+		t.Fatalf("Appended series not in index.")
+	} else if sisi.TailRecordTime().Equal(newTailRecordTime) == false {
+		t.Fatalf("Tail time in stream footer not correct: [%s]", sisi.TailRecordTime())
+	}
+}
+
+func TestAppendToSeries_NotLast(t *testing.T) {
+	raw, series, _ := WriteTestMultiseriesStream()
+
+	appended := NewSeriesFooter1WithUuid(
+		series[0].Uuid(),
+		series[0].HeadRecordTime(),
+		series[0].TailRecordTime(),
+		series[0].RecordCount()+1,
+		series[0].SourceSha1())
+
+	rws := rifs.NewSeekableBufferWithBytes(raw)
+
+	_, err := AppendToSeries(rws, appended, bytes.NewBuffer([]byte("more data")))
+	if err == nil {
+		t.Fatalf("Expected failure for series that isn't last.")
+	}
+}
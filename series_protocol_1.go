@@ -53,6 +53,13 @@ type SeriesFooter1 struct {
 func NewSeriesFooter1(headRecordTime time.Time, tailRecordTime time.Time, recordCount uint64, sourceSha1 []byte) *SeriesFooter1 {
 	uuid := uuid.New().String()
 
+	return NewSeriesFooter1WithUuid(uuid, headRecordTime, tailRecordTime, recordCount, sourceSha1)
+}
+
+// NewSeriesFooter1WithUuid returns a series footer structure with an explicit
+// UUID. This is used to replace the data for a series that is already in the
+// stream.
+func NewSeriesFooter1WithUuid(uuid string, headRecordTime time.Time, tailRecordTime time.Time, recordCount uint64, sourceSha1 []byte) *SeriesFooter1 {
 	now := time.Now().UTC()
 	now = now.Add(-time.Nanosecond * time.Duration(now.Nanosecond()))
 
@@ -71,6 +78,24 @@ func (sf *SeriesFooter1) SetBytesLength(bytesLength uint64) {
 	sf.bytesLength = bytesLength
 }
 
+// SetCreatedTime sets the created-time field.
+func (sf *SeriesFooter1) SetCreatedTime(createdTime time.Time) {
+	sf.createdTime = createdTime.UTC()
+}
+
+// SetUpdatedTime sets the updated-time field.
+func (sf *SeriesFooter1) SetUpdatedTime(updatedTime time.Time) {
+	sf.updatedTime = updatedTime.UTC()
+}
+
+// SetRecordSummary sets the head and tail times, record count, and source SHA1.
+func (sf *SeriesFooter1) SetRecordSummary(headRecordTime, tailRecordTime time.Time, recordCount uint64, sourceSha1 []byte) {
+	sf.headRecordTime = headRecordTime.UTC()
+	sf.tailRecordTime = tailRecordTime.UTC()
+	sf.recordCount = recordCount
+	sf.sourceSha1 = sourceSha1
+}
+
 // NewSeriesFooter1FromEncoded returns a series footer struct (version 1). The
 // checksum that was recorded during the write will be populated.
 func NewSeriesFooter1FromEncoded(footerBytes []byte) (sf *SeriesFooter1, err error) {
@@ -0,0 +1,264 @@
+package timetogo
+
+import (
+	"io"
+	"sort"
+	"time"
+
+	"github.com/dsoprea/go-logging"
+)
+
+var (
+	splitterLogger = log.NewLogger("timetogo.splitter")
+)
+
+// SplitIndexedOutputFactory returns the builder for the output with the given
+// index. It is called once per output, the first time that a series is
+// assigned to it. Returning nil leaves those series in the source stream.
+type SplitIndexedOutputFactory func(output int) (sb *StreamBuilder, err error)
+
+// SplitLabeledOutputFactory returns the builder for the output with the given
+// label. It is called once per label, the first time that a series is assigned
+// to it. Returning nil leaves those series in the source stream.
+type SplitLabeledOutputFactory func(label string) (sb *StreamBuilder, err error)
+
+// SplitLabeler returns a label for the given series. Series with the same
+// label are written to the same output.
+type SplitLabeler func(seriesFooter SeriesFooter) (label string)
+
+// splitTarget returns the builder that the given series is to be copied into,
+// or nil if it is to be left alone.
+type splitTarget func(seriesFooter SeriesFooter, seriesSize int) (sb *StreamBuilder, err error)
+
+// Splitter partitions the series in a stream into several output streams
+// without decoding the series data. Series are copied in stream order and
+// checksums are verified as the data is copied. The caller is responsible for
+// calling `Finish()` on the builders that it provides.
+type Splitter struct {
+	rs io.ReadSeeker
+	sr *StreamReader
+	it *Iterator
+
+	moved []string
+}
+
+// NewSplitter returns a new `Splitter` struct. Returns `io.EOF` if the stream
+// is empty.
+func NewSplitter(rs io.ReadSeeker) (splitter *Splitter, err error) {
+	defer func() {
+		if state := recover(); state != nil {
+			err = log.Wrap(state.(error))
+		}
+	}()
+
+	sr := NewStreamReader(rs)
+
+	it, err := NewIterator(sr)
+	if err != nil {
+		if err == io.EOF {
+			return nil, err
+		}
+
+		log.Panic(err)
+	}
+
+	splitter = &Splitter{
+		rs:    rs,
+		sr:    sr,
+		it:    it,
+		moved: make([]string, 0),
+	}
+
+	return splitter, nil
+}
+
+// Moved returns the UUIDs of the series that have been copied to an output so
+// far.
+func (splitter *Splitter) Moved() []string {
+	return splitter.moved
+}
+
+// split copies every series to the builder returned by `target`.
+func (splitter *Splitter) split(target splitTarget) (err error) {
+	defer func() {
+		if state := recover(); state != nil {
+			err = log.Wrap(state.(error))
+		}
+	}()
+
+	for i := 0; i < splitter.it.Count(); i++ {
+		sisi := splitter.it.SeriesInfo(i)
+
+		seriesFooter, _, seriesSize, err := splitter.sr.ReadSeriesInfoWithIndexedInfo(sisi)
+		log.PanicIf(err)
+
+		sb, err := target(seriesFooter, seriesSize)
+		log.PanicIf(err)
+
+		if sb == nil {
+			continue
+		}
+
+		err = copySeriesVerified(splitter.sr, splitter.rs, sisi, sb, nil)
+		log.PanicIf(err)
+
+		splitter.moved = append(splitter.moved, seriesFooter.Uuid())
+	}
+
+	return nil
+}
+
+// SplitByTime assigns each series to an output by its head time. Output (0)
+// receives the series before the first cutoff, output (1) receives the series
+// from the first cutoff up to the second, and so on. Output (len(cutoffs))
+// receives the rest. The cutoffs must be in ascending order.
+func (splitter *Splitter) SplitByTime(cutoffs []time.Time, factory SplitIndexedOutputFactory) (err error) {
+	defer func() {
+		if state := recover(); state != nil {
+			err = log.Wrap(state.(error))
+		}
+	}()
+
+	for i := 1; i < len(cutoffs); i++ {
+		if cutoffs[i].After(cutoffs[i-1]) == false {
+			log.Panicf("split cutoffs are not in ascending order: [%s] then [%s]", cutoffs[i-1], cutoffs[i])
+		}
+	}
+
+	outputs := make(map[int]*StreamBuilder)
+
+	target := func(seriesFooter SeriesFooter, seriesSize int) (sb *StreamBuilder, err error) {
+		headRecordTime := seriesFooter.HeadRecordTime()
+
+		output := sort.Search(len(cutoffs), func(i int) bool {
+			return headRecordTime.Before(cutoffs[i])
+		})
+
+		sb, found := outputs[output]
+		if found == false {
+			sb, err = factory(output)
+			if err != nil {
+				return nil, err
+			}
+
+			outputs[output] = sb
+		}
+
+		splitterLogger.Debugf(nil, "Series [%s] with head [%s] assigned to output (%d).", seriesFooter.Uuid(), headRecordTime, output)
+
+		return sb, nil
+	}
+
+	err = splitter.split(target)
+	log.PanicIf(err)
+
+	return nil
+}
+
+// SplitByLabel assigns each series to the output for the label that `labeler`
+// returns for it.
+func (splitter *Splitter) SplitByLabel(labeler SplitLabeler, factory SplitLabeledOutputFactory) (err error) {
+	defer func() {
+		if state := recover(); state != nil {
+			err = log.Wrap(state.(error))
+		}
+	}()
+
+	outputs := make(map[string]*StreamBuilder)
+
+	target := func(seriesFooter SeriesFooter, seriesSize int) (sb *StreamBuilder, err error) {
+		label := labeler(seriesFooter)
+
+		sb, found := outputs[label]
+		if found == false {
+			sb, err = factory(label)
+			if err != nil {
+				return nil, err
+			}
+
+			outputs[label] = sb
+		}
+
+		return sb, nil
+	}
+
+	err = splitter.split(target)
+	log.PanicIf(err)
+
+	return nil
+}
+
+// SplitBySize fills each output, in stream order, until the next series would
+// take its series bytes (data and series footers, but not the stream footer)
+// past `maxSize`, and then moves on to the next output. A series that is larger
+// than `maxSize` by itself gets an output of its own.
+func (splitter *Splitter) SplitBySize(maxSize int, factory SplitIndexedOutputFactory) (err error) {
+	defer func() {
+		if state := recover(); state != nil {
+			err = log.Wrap(state.(error))
+		}
+	}()
+
+	output := 0
+	outputSize := 0
+
+	var current *StreamBuilder
+
+	target := func(seriesFooter SeriesFooter, seriesSize int) (sb *StreamBuilder, err error) {
+		if outputSize > 0 && outputSize+seriesSize > maxSize {
+			output++
+			outputSize = 0
+		}
+
+		if outputSize == 0 {
+			current, err = factory(output)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		outputSize += seriesSize
+
+		return current, nil
+	}
+
+	err = splitter.split(target)
+	log.PanicIf(err)
+
+	return nil
+}
+
+// RemoveMoved rewrites the source stream, using `Updater`, without the series
+// that were moved. `rws` must be the same stream that the splitter was created
+// with.
+func (splitter *Splitter) RemoveMoved(rws io.ReadWriteSeeker) (totalSize int, stats UpdateStats, err error) {
+	defer func() {
+		if state := recover(); state != nil {
+			err = log.Wrap(state.(error))
+		}
+	}()
+
+	moved := make(map[string]struct{})
+	for _, uuid := range splitter.moved {
+		moved[uuid] = struct{}{}
+	}
+
+	existing, err := readAllSeriesFooters(rws)
+	log.PanicIf(err)
+
+	// None of the series that we keep are new, so no data will be requested.
+	updater := NewUpdater(rws, nil)
+
+	for _, seriesFooter := range existing {
+		if _, found := moved[seriesFooter.Uuid()]; found == true {
+			continue
+		}
+
+		updater.AddSeries(seriesFooter)
+	}
+
+	totalSize, stats, err = updater.Write()
+	log.PanicIf(err)
+
+	return totalSize, stats, nil
+}
@@ -0,0 +1,187 @@
+package timetogo
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/dsoprea/go-logging"
+	"github.com/randomingenuity/go-utility/filesystem"
+)
+
+func TestSplitter_SplitByTime(t *testing.T) {
+	raw, series, _ := WriteTestMultiseriesStream()
+
+	b := rifs.NewSeekableBuffer()
+
+	_, err := b.Write(raw)
+	log.PanicIf(err)
+
+	splitter, err := NewSplitter(b)
+	log.PanicIf(err)
+
+	// Move everything that starts before the second series out, and leave the
+	// rest.
+
+	cutoffs := []time.Time{
+		series[1].HeadRecordTime(),
+	}
+
+	archiveBuffer := rifs.NewSeekableBuffer()
+	archiveSb := NewStreamBuilder(archiveBuffer)
+
+	factory := func(output int) (sb *StreamBuilder, err error) {
+		if output == 0 {
+			return archiveSb, nil
+		}
+
+		return nil, nil
+	}
+
+	err = splitter.SplitByTime(cutoffs, factory)
+	log.PanicIf(err)
+
+	_, err = archiveSb.Finish()
+	log.PanicIf(err)
+
+	moved := splitter.Moved()
+	if len(moved) != 1 || moved[0] != series[0].Uuid() {
+		t.Fatalf("Moved series not correct: %v", moved)
+	}
+
+	archiveFooters, archiveData := readTestStreamSeries(archiveBuffer.Bytes())
+
+	if len(archiveFooters) != 1 {
+		t.Fatalf("Archive series count not correct: (%d)", len(archiveFooters))
+	} else if archiveFooters[0].Uuid() != series[0].Uuid() {
+		t.Fatalf("Archived series not correct.")
+	} else if bytes.Compare(archiveData[0], TestTimeSeriesData) != 0 {
+		t.Fatalf("Archived series data not correct.")
+	}
+
+	// Remove the moved series from the source.
+
+	totalSize, stats, err := splitter.RemoveMoved(b)
+	log.PanicIf(err)
+
+	if stats != (UpdateStats{Skips: 1, Drops: 1}) {
+		t.Fatalf("Update stats not correct: %s", stats)
+	}
+
+	remainingFooters, remainingData := readTestStreamSeries(b.Bytes()[:totalSize])
+
+	if len(remainingFooters) != 1 {
+		t.Fatalf("Remaining series count not correct: (%d)", len(remainingFooters))
+	} else if remainingFooters[0].Uuid() != series[1].Uuid() {
+		t.Fatalf("Remaining series not correct.")
+	} else if bytes.Compare(remainingData[0], TestTimeSeriesData2) != 0 {
+		t.Fatalf("Remaining series data not correct.")
+	}
+}
+
+func TestSplitter_SplitByTime_BadCutoffs(t *testing.T) {
+	raw, series, _ := WriteTestMultiseriesStream()
+
+	splitter, err := NewSplitter(bytes.NewReader(raw))
+	log.PanicIf(err)
+
+	cutoffs := []time.Time{
+		series[1].HeadRecordTime(),
+		series[0].HeadRecordTime(),
+	}
+
+	factory := func(output int) (sb *StreamBuilder, err error) {
+		return nil, nil
+	}
+
+	err = splitter.SplitByTime(cutoffs, factory)
+	if err == nil {
+		t.Fatalf("Expected failure for unordered cutoffs.")
+	}
+}
+
+func TestSplitter_SplitByLabel(t *testing.T) {
+	raw, series, _ := WriteTestMultiseriesStream()
+
+	splitter, err := NewSplitter(bytes.NewReader(raw))
+	log.PanicIf(err)
+
+	labeler := func(seriesFooter SeriesFooter) string {
+		return fmt.Sprintf("%d", seriesFooter.RecordCount())
+	}
+
+	buffers := make(map[string]*rifs.SeekableBuffer)
+	builders := make(map[string]*StreamBuilder)
+
+	factory := func(label string) (sb *StreamBuilder, err error) {
+		b := rifs.NewSeekableBuffer()
+		sb = NewStreamBuilder(b)
+
+		buffers[label] = b
+		builders[label] = sb
+
+		return sb, nil
+	}
+
+	err = splitter.SplitByLabel(labeler, factory)
+	log.PanicIf(err)
+
+	if len(builders) != 2 {
+		t.Fatalf("Output count not correct: (%d)", len(builders))
+	}
+
+	for label, sb := range builders {
+		_, err := sb.Finish()
+		log.PanicIf(err)
+
+		footers, _ := readTestStreamSeries(buffers[label].Bytes())
+
+		if len(footers) != 1 {
+			t.Fatalf("Series count for label [%s] not correct: (%d)", label, len(footers))
+		} else if labeler(footers[0]) != label {
+			t.Fatalf("Series in output [%s] not correct.", label)
+		}
+	}
+
+	if len(splitter.Moved()) != len(series) {
+		t.Fatalf("Not all series were moved.")
+	}
+}
+
+func TestSplitter_SplitBySize(t *testing.T) {
+	raw, _, _ := WriteTestMultiseriesStream()
+
+	cases := []struct {
+		maxSize     int
+		outputCount int
+	}{
+		// Both series (171 + 177) fit.
+		{348, 1},
+
+		// Each series needs its own output.
+		{200, 2},
+
+		// Each series is larger than the max by itself.
+		{1, 2},
+	}
+
+	for _, c := range cases {
+		splitter, err := NewSplitter(bytes.NewReader(raw))
+		log.PanicIf(err)
+
+		outputs := make([]int, 0)
+
+		factory := func(output int) (sb *StreamBuilder, err error) {
+			outputs = append(outputs, output)
+			return NewStreamBuilder(rifs.NewSeekableBuffer()), nil
+		}
+
+		err = splitter.SplitBySize(c.maxSize, factory)
+		log.PanicIf(err)
+
+		if len(outputs) != c.outputCount {
+			t.Fatalf("Output count for max-size (%d) not correct: %v", c.maxSize, outputs)
+		}
+	}
+}
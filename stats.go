@@ -0,0 +1,190 @@
+package timetogo
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sort"
+
+	"github.com/dsoprea/go-logging"
+)
+
+// StreamStats describes how the space in a stream is used. All sizes are in
+// bytes. A series' size includes its footer, shadow footer, and boundary
+// marker.
+type StreamStats struct {
+	// TotalSize is the size of the whole stream.
+	TotalSize int64 `json:"total_size"`
+
+	// SeriesCount is the number of series.
+	SeriesCount int `json:"series_count"`
+
+	// PayloadBytes is the total size of the series data.
+	PayloadBytes int64 `json:"payload_bytes"`
+
+	// SeriesFooterBytes is the total size of the series footers.
+	SeriesFooterBytes int64 `json:"series_footer_bytes"`
+
+	// StreamFooterBytes is the size of the stream footer.
+	StreamFooterBytes int64 `json:"stream_footer_bytes"`
+
+	// AverageSeriesSize is the mean size of a series.
+	AverageSeriesSize float64 `json:"average_series_size"`
+
+	// MinSeriesSize is the size of the smallest series.
+	MinSeriesSize int64 `json:"min_series_size"`
+
+	// MaxSeriesSize is the size of the largest series.
+	MaxSeriesSize int64 `json:"max_series_size"`
+
+	// DeadBytes is the space that isn't used by any series or the stream
+	// footer. This is what compacting the stream would reclaim.
+	DeadBytes int64 `json:"dead_bytes"`
+
+	// FreeRegionBytes is the portion of the dead space that is recorded as
+	// free regions in the stream footer.
+	FreeRegionBytes int64 `json:"free_region_bytes"`
+
+	// OutOfOrderSeries is the number of series whose head time is earlier
+	// than that of the series physically in front of them.
+	OutOfOrderSeries int `json:"out_of_order_series"`
+
+	// Inversions is the number of pairs of series whose physical order is the
+	// opposite of their order by head time. Zero means that the stream is
+	// physically in chronological order.
+	Inversions int `json:"inversions"`
+}
+
+func (ss StreamStats) String() string {
+	return fmt.Sprintf("StreamStats<TOTAL=(%d) SERIES=(%d) PAYLOAD=(%d) SERIES-FOOTERS=(%d) STREAM-FOOTER=(%d) AVG=(%.1f) MIN=(%d) MAX=(%d) DEAD=(%d) FREE-REGIONS=(%d) OUT-OF-ORDER=(%d) INVERSIONS=(%d)>", ss.TotalSize, ss.SeriesCount, ss.PayloadBytes, ss.SeriesFooterBytes, ss.StreamFooterBytes, ss.AverageSeriesSize, ss.MinSeriesSize, ss.MaxSeriesSize, ss.DeadBytes, ss.FreeRegionBytes, ss.OutOfOrderSeries, ss.Inversions)
+}
+
+// physicalSeries is a series and where it is in the stream.
+type physicalSeries struct {
+	position       int64
+	headRecordTime int64
+}
+
+// Stats reads the footers of the given stream and reports how its space is
+// used. The series data is not read. An empty stream returns empty stats.
+func Stats(rs io.ReadSeeker) (ss StreamStats, err error) {
+	defer func() {
+		if state := recover(); state != nil {
+			err = log.Wrap(state.(error))
+		}
+	}()
+
+	totalSize, err := rs.Seek(0, os.SEEK_END)
+	log.PanicIf(err)
+
+	ss.TotalSize = totalSize
+
+	if totalSize == 0 {
+		return ss, nil
+	}
+
+	sr := NewStreamReader(rs)
+
+	it, err := NewIterator(sr)
+	log.PanicIf(err)
+
+	ss.SeriesCount = it.Count()
+
+	physical := make([]physicalSeries, it.Count())
+	for i := 0; i < it.Count(); i++ {
+		sisi := it.SeriesInfo(i)
+
+		seriesFooter, dataOffset, seriesSize, err := sr.ReadSeriesInfoWithIndexedInfo(sisi)
+		log.PanicIf(err)
+
+		size := int64(seriesSize)
+		bytesLength := int64(seriesFooter.BytesLength())
+
+		ss.PayloadBytes += bytesLength
+		ss.SeriesFooterBytes += size - bytesLength
+
+		if i == 0 || size < ss.MinSeriesSize {
+			ss.MinSeriesSize = size
+		}
+
+		if size > ss.MaxSeriesSize {
+			ss.MaxSeriesSize = size
+		}
+
+		physical[i] = physicalSeries{
+			position:       dataOffset,
+			headRecordTime: sisi.HeadRecordTime().Unix(),
+		}
+	}
+
+	if ss.SeriesCount > 0 {
+		ss.AverageSeriesSize = float64(ss.PayloadBytes+ss.SeriesFooterBytes) / float64(ss.SeriesCount)
+	}
+
+	err = sr.Reset()
+	log.PanicIf(err)
+
+	_, _, footerBytes, _, err := sr.readOneFooter()
+	log.PanicIf(err)
+
+	ss.StreamFooterBytes = int64(len(footerBytes) + ShadowFooterSize)
+	ss.DeadBytes = ss.TotalSize - ss.PayloadBytes - ss.SeriesFooterBytes - ss.StreamFooterBytes
+
+	for _, fr := range it.FreeRegions() {
+		ss.FreeRegionBytes += fr.Length
+	}
+
+	// Compare the physical order with the chronological order.
+
+	sort.Slice(physical, func(i, j int) bool {
+		return physical[i].position < physical[j].position
+	})
+
+	headRecordTimes := make([]int64, len(physical))
+	for i, ps := range physical {
+		headRecordTimes[i] = ps.headRecordTime
+
+		if i > 0 && ps.headRecordTime < physical[i-1].headRecordTime {
+			ss.OutOfOrderSeries++
+		}
+	}
+
+	ss.Inversions = countInversions(headRecordTimes)
+
+	return ss, nil
+}
+
+// countInversions returns the number of pairs of values that are out of order
+// (an earlier value is greater than a later one). It's a merge sort, so it's
+// O(n log n). The slice is sorted as a side effect.
+func countInversions(values []int64) int {
+	if len(values) < 2 {
+		return 0
+	}
+
+	middle := len(values) / 2
+
+	left := make([]int64, middle)
+	copy(left, values[:middle])
+
+	right := make([]int64, len(values)-middle)
+	copy(right, values[middle:])
+
+	inversions := countInversions(left) + countInversions(right)
+
+	i, j := 0, 0
+	for k := range values {
+		if j >= len(right) || (i < len(left) && left[i] <= right[j]) {
+			values[k] = left[i]
+			i++
+		} else {
+			// Every remaining value on the left is greater than this one.
+			inversions += len(left) - i
+
+			values[k] = right[j]
+			j++
+		}
+	}
+
+	return inversions
+}
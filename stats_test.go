@@ -0,0 +1,128 @@
+package timetogo
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"testing"
+
+	"github.com/dsoprea/go-logging"
+	"github.com/randomingenuity/go-utility/filesystem"
+)
+
+func TestStats(t *testing.T) {
+	raw, _, _ := WriteTestMultiseriesStream()
+
+	ss, err := Stats(bytes.NewReader(raw))
+	log.PanicIf(err)
+
+	expected := StreamStats{
+		TotalSize:         554,
+		SeriesCount:       2,
+		PayloadBytes:      int64(len(TestTimeSeriesData) + len(TestTimeSeriesData2)),
+		SeriesFooterBytes: 171 + 177 - int64(len(TestTimeSeriesData)+len(TestTimeSeriesData2)),
+		StreamFooterBytes: 206,
+		AverageSeriesSize: 174,
+		MinSeriesSize:     171,
+		MaxSeriesSize:     177,
+	}
+
+	if ss != expected {
+		t.Fatalf("Stats not correct:\nACTUAL: %s\nEXPECTED: %s", ss, expected)
+	}
+}
+
+func TestStats_DeadSpaceAndDisorder(t *testing.T) {
+	raw, series, _ := WriteTestMultiseriesStream()
+
+	// Replace the first series through `Appender`, which leaves the old copy
+	// and the old stream footer as free regions and puts the newest data
+	// physically last.
+
+	replacement := NewSeriesFooter1WithUuid(
+		series[0].Uuid(),
+		series[0].HeadRecordTime(),
+		series[0].TailRecordTime(),
+		series[0].RecordCount(),
+		[]byte{1, 2, 3, 4})
+
+	sdtg := &SeriesDataTestGenerator{
+		data: map[string]io.Reader{
+			replacement.Uuid(): bytes.NewBuffer(TestTimeSeriesData),
+		},
+	}
+
+	rws := rifs.NewSeekableBufferWithBytes(raw)
+
+	appender := NewAppender(rws, sdtg)
+	appender.AddSeries(replacement)
+
+	totalSize, _, err := appender.Write()
+	log.PanicIf(err)
+
+	ss, err := Stats(bytes.NewReader(rws.Bytes()[:totalSize]))
+	log.PanicIf(err)
+
+	if ss.DeadBytes != 171+206 {
+		t.Fatalf("Dead space not correct: (%d)", ss.DeadBytes)
+	} else if ss.FreeRegionBytes != 171+206 {
+		t.Fatalf("Free-region space not correct: (%d)", ss.FreeRegionBytes)
+	} else if ss.OutOfOrderSeries != 1 || ss.Inversions != 1 {
+		t.Fatalf("Disorder not correct: (%d) (%d)", ss.OutOfOrderSeries, ss.Inversions)
+	} else if ss.TotalSize != ss.PayloadBytes+ss.SeriesFooterBytes+ss.StreamFooterBytes+ss.DeadBytes {
+		t.Fatalf("Sizes do not add up: %s", ss)
+	}
+
+	// Make sure that tooling can consume it.
+
+	encoded, err := json.Marshal(ss)
+	log.PanicIf(err)
+
+	var decoded StreamStats
+
+	err = json.Unmarshal(encoded, &decoded)
+	log.PanicIf(err)
+
+	if decoded != ss {
+		t.Fatalf("JSON round-trip not correct: %s", string(encoded))
+	}
+}
+
+func TestStats_Empty(t *testing.T) {
+	ss, err := Stats(bytes.NewReader([]byte{}))
+	log.PanicIf(err)
+
+	if ss != (StreamStats{}) {
+		t.Fatalf("Stats for empty stream not correct: %s", ss)
+	}
+}
+
+func TestCountInversions(t *testing.T) {
+	cases := [][]int64{
+		{},
+		{1},
+		{1, 2, 3, 4},
+		{4, 3, 2, 1},
+		{3, 1, 2, 3, 1},
+		{5, 5, 5},
+		{2, 8, 1, 9, 4, 4, 7, 0},
+	}
+
+	for _, values := range cases {
+		expected := 0
+		for i := 0; i < len(values); i++ {
+			for j := 0; j < i; j++ {
+				if values[i] < values[j] {
+					expected++
+				}
+			}
+		}
+
+		copied := make([]int64, len(values))
+		copy(copied, values)
+
+		if inversions := countInversions(copied); inversions != expected {
+			t.Fatalf("Inversions not correct for %v: (%d) != (%d)", values, inversions, expected)
+		}
+	}
+}
@@ -0,0 +1,358 @@
+package timetogo
+
+import (
+	"io"
+	"os"
+	"time"
+
+	"github.com/dsoprea/go-logging"
+)
+
+var (
+	storeLogger = log.NewLogger("timetogo.store")
+)
+
+// storedSeries is a series that has been staged to be written.
+type storedSeries struct {
+	seriesFooter     SeriesFooter
+	seriesDataWriter interface{}
+}
+
+// storeSeriesDataWriter provides the data for staged series to `Updater`.
+type storeSeriesDataWriter struct {
+	staged map[string]storedSeries
+}
+
+// WriteData writes the data for the staged series with the same UUID.
+func (ssdw storeSeriesDataWriter) WriteData(w io.Writer, sf SeriesFooter) (n int, err error) {
+	defer func() {
+		if state := recover(); state != nil {
+			err = log.Wrap(state.(error))
+		}
+	}()
+
+	ss, found := ssdw.staged[sf.Uuid()]
+	if found == false {
+		log.Panicf("no data staged for series [%s]", sf.Uuid())
+	}
+
+	copiedCount, err := writeSeriesData(w, ss.seriesDataWriter, sf)
+	log.PanicIf(err)
+
+	applySeriesSummary(ss.seriesDataWriter, sf)
+
+	return int(copiedCount), nil
+}
+
+// Store is a high-level interface to a stream file. Changes are staged with
+// `Put` and `Delete` and written with `Commit`, after which the index is
+// reloaded (`Get` also reloads it). Reads only reflect committed changes.
+// Access to the file is coordinated with `StreamFile` locks.
+type Store struct {
+	streamFile *StreamFile
+
+	// index is nil if the stream is empty.
+	index *Index
+
+	staged      map[string]storedSeries
+	stagedOrder []string
+	deleted     map[string]struct{}
+}
+
+// OpenStore opens the stream at the given path, creating it if it doesn't
+// exist.
+func OpenStore(filepath string, lockTimeout time.Duration) (store *Store, err error) {
+	defer func() {
+		if state := recover(); state != nil {
+			err = log.Wrap(state.(error))
+		}
+	}()
+
+	streamFile, err := OpenStreamFile(filepath, lockTimeout)
+	log.PanicIf(err)
+
+	store = &Store{
+		streamFile: streamFile,
+	}
+
+	store.resetStaged()
+
+	err = streamFile.ReadLocked(store.loadIndex)
+	if err != nil {
+		streamFile.Close()
+		log.Panic(err)
+	}
+
+	return store, nil
+}
+
+// Close closes the underlying file. Uncommitted changes are discarded.
+func (store *Store) Close() error {
+	return store.streamFile.Close()
+}
+
+func (store *Store) resetStaged() {
+	store.staged = make(map[string]storedSeries)
+	store.stagedOrder = make([]string, 0)
+	store.deleted = make(map[string]struct{})
+}
+
+// loadIndex reloads the index. The caller must hold a lock.
+func (store *Store) loadIndex(rs io.ReadSeeker) (err error) {
+	defer func() {
+		if state := recover(); state != nil {
+			err = log.Wrap(state.(error))
+		}
+	}()
+
+	size, err := rs.Seek(0, os.SEEK_END)
+	log.PanicIf(err)
+
+	if size == 0 {
+		store.index = nil
+		return nil
+	}
+
+	index, err := NewIndex(rs)
+	log.PanicIf(err)
+
+	store.index = index
+
+	return nil
+}
+
+// Get reads the series with the given UUID. The data is written to
+// `seriesDataReader`, which may be an `io.Writer` or a
+// `SeriesDataDatasourceReader` (or nil to only return the footer). Returns
+// `ErrSeriesChecksumMismatch` if the data is corrupt. The index is reloaded
+// while the lock is held since another process may have committed (and moved
+// the series) since it was last loaded.
+func (store *Store) Get(uuid string, seriesDataReader interface{}) (seriesFooter SeriesFooter, err error) {
+	defer func() {
+		if state := recover(); state != nil {
+			err = log.Wrap(state.(error))
+		}
+	}()
+
+	err = store.streamFile.ReadLocked(func(rs io.ReadSeeker) (err error) {
+		defer func() {
+			if state := recover(); state != nil {
+				err = log.Wrap(state.(error))
+			}
+		}()
+
+		err = store.loadIndex(rs)
+		log.PanicIf(err)
+
+		if store.index == nil {
+			log.Panicf("series [%s] not found", uuid)
+		}
+
+		sisi, found := store.index.GetWithUuid(uuid)
+		if found == false {
+			log.Panicf("series [%s] not found", uuid)
+		}
+
+		sr := NewStreamReader(rs)
+
+		var checksumOk bool
+
+		seriesFooter, _, checksumOk, err = sr.ReadSeriesWithIndexedInfo(sisi, seriesDataReader)
+		log.PanicIf(err)
+
+		if seriesFooter.Uuid() != uuid {
+			log.Panicf("series at indexed position is [%s] rather than [%s]", seriesFooter.Uuid(), uuid)
+		} else if checksumOk == false {
+			log.Panic(ErrSeriesChecksumMismatch)
+		}
+
+		return nil
+	})
+
+	log.PanicIf(err)
+
+	return seriesFooter, nil
+}
+
+// Query returns the summary info for all committed series that intersect the
+// given range (inclusive). Like `Get`, the index is reloaded while the lock is
+// held. The positions returned may be stale once the lock is released, so the
+// series should be read with `Get`.
+func (store *Store) Query(start, end time.Time) (matched []StreamIndexedSequenceInfo, err error) {
+	defer func() {
+		if state := recover(); state != nil {
+			err = log.Wrap(state.(error))
+		}
+	}()
+
+	err = store.streamFile.ReadLocked(func(rs io.ReadSeeker) (err error) {
+		defer func() {
+			if state := recover(); state != nil {
+				err = log.Wrap(state.(error))
+			}
+		}()
+
+		err = store.loadIndex(rs)
+		log.PanicIf(err)
+
+		if store.index == nil {
+			matched = make([]StreamIndexedSequenceInfo, 0)
+		} else {
+			matched = store.index.GetWithRange(start, end)
+		}
+
+		return nil
+	})
+
+	log.PanicIf(err)
+
+	return matched, nil
+}
+
+// Put stages a series to be written on the next commit. `seriesDataWriter`
+// may be an `io.Reader` or a `SeriesDataDatasourceWriter`. If a series with
+// the same UUID is already stored, it will be replaced (if the source SHA1
+// differs) or left alone (if it's the same).
+func (store *Store) Put(seriesFooter SeriesFooter, seriesDataWriter interface{}) {
+	uuid := seriesFooter.Uuid()
+
+	if _, found := store.staged[uuid]; found == false {
+		store.stagedOrder = append(store.stagedOrder, uuid)
+	}
+
+	store.staged[uuid] = storedSeries{
+		seriesFooter:     seriesFooter,
+		seriesDataWriter: seriesDataWriter,
+	}
+
+	delete(store.deleted, uuid)
+}
+
+// Delete stages a series to be removed on the next commit.
+func (store *Store) Delete(uuid string) {
+	store.deleted[uuid] = struct{}{}
+
+	if _, found := store.staged[uuid]; found == true {
+		delete(store.staged, uuid)
+
+		for i, stagedUuid := range store.stagedOrder {
+			if stagedUuid == uuid {
+				store.stagedOrder = append(store.stagedOrder[:i], store.stagedOrder[i+1:]...)
+				break
+			}
+		}
+	}
+}
+
+// Commit writes the staged changes while holding an exclusive lock and then
+// reloads the index. The file is truncated to its new size.
+func (store *Store) Commit() (stats UpdateStats, err error) {
+	defer func() {
+		if state := recover(); state != nil {
+			err = log.Wrap(state.(error))
+		}
+	}()
+
+	err = store.streamFile.WriteLocked(func(rws io.ReadWriteSeeker) (err error) {
+		defer func() {
+			if state := recover(); state != nil {
+				err = log.Wrap(state.(error))
+			}
+		}()
+
+		// Read the current series from the stream rather than trusting our
+		// index, since another process may have changed it.
+
+		existing, err := readAllSeriesFooters(rws)
+		log.PanicIf(err)
+
+		if len(existing) == 0 && len(store.stagedOrder) == 0 {
+			// There's nothing to write (and an empty stream has no footer
+			// for the updater to read).
+
+			storeLogger.Debugf(nil, "Commit: Nothing to write to empty stream.")
+
+			err = store.loadIndex(rws)
+			log.PanicIf(err)
+
+			return nil
+		}
+
+		ssdw := storeSeriesDataWriter{
+			staged: store.staged,
+		}
+
+		updater := NewUpdater(rws, ssdw)
+
+		existingUuids := make(map[string]struct{})
+		for _, seriesFooter := range existing {
+			uuid := seriesFooter.Uuid()
+			existingUuids[uuid] = struct{}{}
+
+			if _, found := store.deleted[uuid]; found == true {
+				continue
+			}
+
+			if ss, found := store.staged[uuid]; found == true {
+				updater.AddSeries(ss.seriesFooter)
+			} else {
+				updater.AddSeries(seriesFooter)
+			}
+		}
+
+		for _, uuid := range store.stagedOrder {
+			if _, found := existingUuids[uuid]; found == true {
+				continue
+			}
+
+			updater.AddSeries(store.staged[uuid].seriesFooter)
+		}
+
+		_, stats, err = updater.Write()
+		log.PanicIf(err)
+
+		storeLogger.Debugf(nil, "Commit: %s", stats)
+
+		err = store.loadIndex(rws)
+		log.PanicIf(err)
+
+		return nil
+	})
+
+	log.PanicIf(err)
+
+	store.resetStaged()
+
+	return stats, nil
+}
+
+// readAllSeriesFooters returns the footers for every series in the stream, in
+// stream order. An empty stream returns an empty slice.
+func readAllSeriesFooters(rs io.ReadSeeker) (series []SeriesFooter, err error) {
+	defer func() {
+		if state := recover(); state != nil {
+			err = log.Wrap(state.(error))
+		}
+	}()
+
+	sr := NewStreamReader(rs)
+
+	it, err := NewIterator(sr)
+	if err != nil {
+		if err == io.EOF {
+			return make([]SeriesFooter, 0), nil
+		}
+
+		log.Panic(err)
+	}
+
+	series = make([]SeriesFooter, it.Count())
+	for i := 0; i < it.Count(); i++ {
+		seriesFooter, _, _, err := sr.ReadSeriesInfoWithIndexedInfo(it.SeriesInfo(i))
+		log.PanicIf(err)
+
+		series[i] = seriesFooter
+	}
+
+	return series, nil
+}
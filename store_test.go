@@ -0,0 +1,286 @@
+//go:build darwin || dragonfly || freebsd || linux || netbsd || openbsd
+// +build darwin dragonfly freebsd linux netbsd openbsd
+
+package timetogo
+
+import (
+	"bytes"
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"io/ioutil"
+
+	"github.com/dsoprea/go-logging"
+)
+
+func TestStore(t *testing.T) {
+	tempPath, err := ioutil.TempDir("", "timetogo.store.")
+	log.PanicIf(err)
+
+	defer os.RemoveAll(tempPath)
+
+	filepath := path.Join(tempPath, "stream")
+
+	store, err := OpenStore(filepath, time.Second)
+	log.PanicIf(err)
+
+	defer store.Close()
+
+	headRecordTime := time.Date(2016, 10, 1, 12, 34, 56, 0, time.UTC)
+
+	matched, err := store.Query(headRecordTime, headRecordTime)
+	log.PanicIf(err)
+
+	if len(matched) != 0 {
+		t.Fatalf("Expected empty store.")
+	}
+
+	sf1 := NewSeriesFooter1(headRecordTime, headRecordTime.Add(time.Second*20), 22, []byte{11, 22, 33})
+	sf2 := NewSeriesFooter1(headRecordTime.Add(time.Minute), headRecordTime.Add(time.Minute*2), 33, []byte{44, 55, 66})
+
+	store.Put(sf1, bytes.NewBuffer(TestTimeSeriesData))
+	store.Put(sf2, bytes.NewBuffer(TestTimeSeriesData2))
+
+	stats, err := store.Commit()
+	log.PanicIf(err)
+
+	if stats != (UpdateStats{Adds: 2}) {
+		t.Fatalf("Stats not correct: %s", stats)
+	}
+
+	// Query.
+
+	matched, err = store.Query(headRecordTime.Add(time.Second*30), headRecordTime.Add(time.Hour))
+	log.PanicIf(err)
+
+	if len(matched) != 1 || matched[0].Uuid() != sf2.Uuid() {
+		t.Fatalf("Query not correct: %v", matched)
+	}
+
+	// Get.
+
+	b := new(bytes.Buffer)
+
+	seriesFooter, err := store.Get(sf1.Uuid(), b)
+	log.PanicIf(err)
+
+	if seriesFooter.Uuid() != sf1.Uuid() {
+		t.Fatalf("Wrong series returned.")
+	} else if bytes.Compare(b.Bytes(), TestTimeSeriesData) != 0 {
+		t.Fatalf("Data not correct: %v", b.Bytes())
+	}
+
+	// Delete.
+
+	store.Delete(sf1.Uuid())
+
+	stats, err = store.Commit()
+	log.PanicIf(err)
+
+	if stats != (UpdateStats{Skips: 1, Drops: 1}) {
+		t.Fatalf("Stats not correct: %s", stats)
+	}
+
+	_, err = store.Get(sf1.Uuid(), nil)
+	if err == nil {
+		t.Fatalf("Expected deleted series to be missing.")
+	}
+
+	// The file should have been truncated.
+
+	raw, err := ioutil.ReadFile(filepath)
+	log.PanicIf(err)
+
+	footers, data := readTestStreamSeries(raw)
+
+	if len(footers) != 1 || footers[0].Uuid() != sf2.Uuid() {
+		t.Fatalf("Stream not correct after delete.")
+	} else if bytes.Compare(data[0], TestTimeSeriesData2) != 0 {
+		t.Fatalf("Stream data not correct after delete: %v", data[0])
+	}
+
+	// Reopen.
+
+	reopened, err := OpenStore(filepath, time.Second)
+	log.PanicIf(err)
+
+	defer reopened.Close()
+
+	b = new(bytes.Buffer)
+
+	_, err = reopened.Get(sf2.Uuid(), b)
+	log.PanicIf(err)
+
+	if bytes.Compare(b.Bytes(), TestTimeSeriesData2) != 0 {
+		t.Fatalf("Data not correct after reopen: %v", b.Bytes())
+	}
+}
+
+func TestStore_Put_Replace(t *testing.T) {
+	tempPath, err := ioutil.TempDir("", "timetogo.store.")
+	log.PanicIf(err)
+
+	defer os.RemoveAll(tempPath)
+
+	store, err := OpenStore(path.Join(tempPath, "stream"), time.Second)
+	log.PanicIf(err)
+
+	defer store.Close()
+
+	headRecordTime := time.Date(2016, 10, 1, 12, 34, 56, 0, time.UTC)
+
+	sf1 := NewSeriesFooter1(headRecordTime, headRecordTime.Add(time.Second*20), 22, []byte{11, 22, 33})
+
+	store.Put(sf1, bytes.NewBuffer(TestTimeSeriesData))
+
+	_, err = store.Commit()
+	log.PanicIf(err)
+
+	replacement := NewSeriesFooter1WithUuid(sf1.Uuid(), headRecordTime, headRecordTime.Add(time.Second*20), 33, []byte{44, 55, 66})
+
+	store.Put(replacement, bytes.NewBuffer(TestTimeSeriesData2))
+
+	stats, err := store.Commit()
+	log.PanicIf(err)
+
+	if stats != (UpdateStats{Replaces: 1}) {
+		t.Fatalf("Stats not correct: %s", stats)
+	}
+
+	b := new(bytes.Buffer)
+
+	seriesFooter, err := store.Get(sf1.Uuid(), b)
+	log.PanicIf(err)
+
+	if seriesFooter.RecordCount() != 33 {
+		t.Fatalf("Series not replaced.")
+	} else if bytes.Compare(b.Bytes(), TestTimeSeriesData2) != 0 {
+		t.Fatalf("Data not correct: %v", b.Bytes())
+	}
+}
+
+func TestStore_Get_CommitFromOtherHandle(t *testing.T) {
+	tempPath, err := ioutil.TempDir("", "timetogo.store.")
+	log.PanicIf(err)
+
+	defer os.RemoveAll(tempPath)
+
+	filepath := path.Join(tempPath, "stream")
+
+	writer, err := OpenStore(filepath, time.Second)
+	log.PanicIf(err)
+
+	defer writer.Close()
+
+	headRecordTime := time.Date(2016, 10, 1, 12, 34, 56, 0, time.UTC)
+
+	sf1 := NewSeriesFooter1(headRecordTime, headRecordTime.Add(time.Second*20), 22, []byte{11, 22, 33})
+	sf2 := NewSeriesFooter1(headRecordTime.Add(time.Minute), headRecordTime.Add(time.Minute*2), 33, []byte{44, 55, 66})
+
+	writer.Put(sf1, bytes.NewBuffer(TestTimeSeriesData))
+	writer.Put(sf2, bytes.NewBuffer(TestTimeSeriesData2))
+
+	_, err = writer.Commit()
+	log.PanicIf(err)
+
+	// Load the index in the reader.
+
+	reader, err := OpenStore(filepath, time.Second)
+	log.PanicIf(err)
+
+	defer reader.Close()
+
+	// Commit from the other handle. Dropping the first series moves the
+	// second one to the front of the stream.
+
+	writer.Delete(sf1.Uuid())
+
+	_, err = writer.Commit()
+	log.PanicIf(err)
+
+	b := new(bytes.Buffer)
+
+	seriesFooter, err := reader.Get(sf2.Uuid(), b)
+	log.PanicIf(err)
+
+	if seriesFooter.Uuid() != sf2.Uuid() {
+		t.Fatalf("Wrong series returned: [%s]", seriesFooter.Uuid())
+	} else if bytes.Compare(b.Bytes(), TestTimeSeriesData2) != 0 {
+		t.Fatalf("Data not correct: %v", b.Bytes())
+	}
+
+	_, err = reader.Get(sf1.Uuid(), nil)
+	if err == nil {
+		t.Fatalf("Expected series deleted by the other handle to be missing.")
+	}
+}
+
+func TestStore_Commit_EmptyNothingStaged(t *testing.T) {
+	tempPath, err := ioutil.TempDir("", "timetogo.store.")
+	log.PanicIf(err)
+
+	defer os.RemoveAll(tempPath)
+
+	filepath := path.Join(tempPath, "stream")
+
+	store, err := OpenStore(filepath, time.Second)
+	log.PanicIf(err)
+
+	defer store.Close()
+
+	store.Delete("not-there")
+
+	stats, err := store.Commit()
+	log.PanicIf(err)
+
+	if stats != (UpdateStats{}) {
+		t.Fatalf("Stats not correct: %s", stats)
+	}
+}
+
+func TestStore_Query_CommitFromOtherHandle(t *testing.T) {
+	tempPath, err := ioutil.TempDir("", "timetogo.store.")
+	log.PanicIf(err)
+
+	defer os.RemoveAll(tempPath)
+
+	filepath := path.Join(tempPath, "stream")
+
+	writer, err := OpenStore(filepath, time.Second)
+	log.PanicIf(err)
+
+	defer writer.Close()
+
+	headRecordTime := time.Date(2016, 10, 1, 12, 34, 56, 0, time.UTC)
+
+	sf1 := NewSeriesFooter1(headRecordTime, headRecordTime.Add(time.Second*20), 22, []byte{11, 22, 33})
+
+	writer.Put(sf1, bytes.NewBuffer(TestTimeSeriesData))
+
+	_, err = writer.Commit()
+	log.PanicIf(err)
+
+	reader, err := OpenStore(filepath, time.Second)
+	log.PanicIf(err)
+
+	defer reader.Close()
+
+	// Commit a second series from the other handle after the reader has
+	// loaded its index.
+
+	sf2 := NewSeriesFooter1(headRecordTime.Add(time.Minute), headRecordTime.Add(time.Minute*2), 33, []byte{44, 55, 66})
+
+	writer.Put(sf2, bytes.NewBuffer(TestTimeSeriesData2))
+
+	_, err = writer.Commit()
+	log.PanicIf(err)
+
+	matched, err := reader.Query(headRecordTime.Add(time.Second*30), headRecordTime.Add(time.Hour))
+	log.PanicIf(err)
+
+	if len(matched) != 1 || matched[0].Uuid() != sf2.Uuid() {
+		t.Fatalf("Query not correct: %v", matched)
+	}
+}
@@ -2,6 +2,8 @@ package timetogo
 
 import (
 	"time"
+
+	"github.com/dsoprea/go-logging"
 )
 
 const (
@@ -82,6 +84,74 @@ type SeriesFooter interface {
 	SetBytesLength(bytesLength uint64)
 }
 
+// createdTimeSetter is optionally implemented by a `SeriesFooter` whose
+// created-time can be set. It isn't part of `SeriesFooter` so that existing
+// implementations don't have to provide it.
+type createdTimeSetter interface {
+	// SetCreatedTime is used to carry the created-time of an existing series
+	// forward when that series is being replaced.
+	SetCreatedTime(createdTime time.Time)
+}
+
+// carryCreatedTime sets the created-time of the footer if the footer supports
+// it. Otherwise, the footer keeps its own created-time.
+func carryCreatedTime(sf SeriesFooter, createdTime time.Time) {
+	cts, ok := sf.(createdTimeSetter)
+	if ok == false {
+		return
+	}
+
+	cts.SetCreatedTime(createdTime)
+}
+
+// updatedTimeSetter is optionally implemented by a `SeriesFooter` whose
+// updated-time can be set. It isn't part of `SeriesFooter` so that existing
+// implementations don't have to provide it.
+type updatedTimeSetter interface {
+	// SetUpdatedTime is used to carry the updated-time of a series forward
+	// when it's copied under a new UUID.
+	SetUpdatedTime(updatedTime time.Time)
+}
+
+// carryUpdatedTime sets the updated-time of the footer if the footer supports
+// it. Otherwise, the footer keeps its own updated-time.
+func carryUpdatedTime(sf SeriesFooter, updatedTime time.Time) {
+	uts, ok := sf.(updatedTimeSetter)
+	if ok == false {
+		return
+	}
+
+	uts.SetUpdatedTime(updatedTime)
+}
+
+// recordSummarySetter is optionally implemented by a `SeriesFooter` whose
+// record fields can be set. It isn't part of `SeriesFooter` so that existing
+// implementations don't have to provide it.
+type recordSummarySetter interface {
+	// SetRecordSummary is used to set the fields that describe the records
+	// when they are only known once the data has been encoded.
+	SetRecordSummary(headRecordTime, tailRecordTime time.Time, recordCount uint64, sourceSha1 []byte)
+}
+
+// setRecordSummary sets the record fields of the footer. It fails if the
+// footer doesn't support it.
+func setRecordSummary(sf SeriesFooter, headRecordTime, tailRecordTime time.Time, recordCount uint64, sourceSha1 []byte) (err error) {
+	defer func() {
+		if state := recover(); state != nil {
+			err = log.Wrap(state.(error))
+		}
+	}()
+
+	rss, ok := sf.(recordSummarySetter)
+	if ok == false {
+		log.Panicf("series footer for [%s] does not support setting the record summary", sf.Uuid())
+	}
+
+	rss.SetRecordSummary(headRecordTime, tailRecordTime, recordCount, sourceSha1)
+
+	return nil
+}
+
 // StreamIndexedSequenceInfo describes summary information for a single series
 // encoded into the stream footer.
 type StreamIndexedSequenceInfo interface {
@@ -98,8 +168,38 @@ type StreamIndexedSequenceInfo interface {
 	AbsolutePosition() int64
 }
 
+// FreeRegion describes a range of bytes between series that isn't used by any
+// series.
+type FreeRegion struct {
+	// AbsolutePosition is the position of the first byte.
+	AbsolutePosition int64
+
+	// Length is the number of bytes.
+	Length int64
+}
+
 // StreamFooter describes a type that can return summary information about the
 // series in a stream. This represents a basic encoded stream type.
 type StreamFooter interface {
 	Series() []StreamIndexedSequenceInfo
 }
+
+// freeRegionsProvider is optionally implemented by a `StreamFooter` that can
+// record free regions. It isn't part of `StreamFooter` so that existing
+// implementations don't have to provide it.
+type freeRegionsProvider interface {
+	// FreeRegions returns the unused regions between series, ordered by
+	// position.
+	FreeRegions() []FreeRegion
+}
+
+// streamFooterFreeRegions returns the free regions of the stream footer. A
+// footer that doesn't support them has none.
+func streamFooterFreeRegions(sf StreamFooter) []FreeRegion {
+	frp, ok := sf.(freeRegionsProvider)
+	if ok == false {
+		return nil
+	}
+
+	return frp.FreeRegions()
+}
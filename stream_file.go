@@ -0,0 +1,302 @@
+package timetogo
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/dsoprea/go-logging"
+)
+
+var (
+	streamFileLogger = log.NewLogger("timetogo.stream_file")
+)
+
+var (
+	// ErrStreamFileNotLocked is returned by `Unlock` when no lock is held.
+	ErrStreamFileNotLocked = errors.New("stream file is not locked")
+)
+
+const (
+	// DefaultLockPollInterval is how often we retry acquiring a lock while
+	// waiting for it.
+	DefaultLockPollInterval = time.Millisecond * 10
+)
+
+// LockedError is returned when a lock on a stream file could not be acquired
+// before the timeout.
+type LockedError struct {
+	Filepath  string
+	Exclusive bool
+	Timeout   time.Duration
+}
+
+func (le *LockedError) Error() string {
+	lockType := "shared"
+	if le.Exclusive == true {
+		lockType = "exclusive"
+	}
+
+	return fmt.Sprintf("could not acquire %s lock on stream file [%s] within (%s)", lockType, le.Filepath, le.Timeout)
+}
+
+// IsLockedError returns true if the error (wrapped or not) is a `LockedError`.
+func IsLockedError(err error) bool {
+	if err == nil {
+		return false
+	}
+
+	_, ok := log.Wrap(err).Err.(*LockedError)
+	return ok
+}
+
+// StreamFile is a file-backed stream that coordinates access between
+// processes using advisory locks. Readers take a shared lock and updates take
+// an exclusive lock. A lock timeout of zero tries exactly once and a negative
+// timeout waits indefinitely.
+//
+// A `StreamFile` may be used from multiple goroutines, but they take turns:
+// advisory locks don't exclude other goroutines in the same process, and they
+// would all share the one file offset, so even readers are serialized within
+// the process. Open a separate `StreamFile` for reads that should run
+// concurrently.
+type StreamFile struct {
+	filepath     string
+	f            *os.File
+	lockTimeout  time.Duration
+	pollInterval time.Duration
+
+	// inProcess is a one-slot semaphore that serializes use of the file
+	// between goroutines. It's a channel rather than a mutex so that waiting
+	// for it honors the lock timeout.
+	inProcess chan struct{}
+
+	// held is true while a lock is held. heldMutex guards it since `Unlock`
+	// may be called by a goroutine that doesn't hold the lock.
+	held      bool
+	heldMutex sync.Mutex
+}
+
+// OpenStreamFile opens (creating if necessary) the stream file at the given
+// path.
+func OpenStreamFile(filepath string, lockTimeout time.Duration) (streamFile *StreamFile, err error) {
+	defer func() {
+		if state := recover(); state != nil {
+			err = log.Wrap(state.(error))
+		}
+	}()
+
+	f, err := os.OpenFile(filepath, os.O_RDWR|os.O_CREATE, 0644)
+	log.PanicIf(err)
+
+	streamFile = &StreamFile{
+		filepath:     filepath,
+		f:            f,
+		lockTimeout:  lockTimeout,
+		pollInterval: DefaultLockPollInterval,
+		inProcess:    make(chan struct{}, 1),
+	}
+
+	return streamFile, nil
+}
+
+// Close closes the file. This also releases any lock that is held.
+func (streamFile *StreamFile) Close() error {
+	return streamFile.f.Close()
+}
+
+// File returns the underlying file. Callers are responsible for holding the
+// appropriate lock while using it.
+func (streamFile *StreamFile) File() *os.File {
+	return streamFile.f
+}
+
+// SetLockPollInterval sets how often to retry a lock while waiting for it.
+func (streamFile *StreamFile) SetLockPollInterval(pollInterval time.Duration) {
+	streamFile.pollInterval = pollInterval
+}
+
+// lock acquires a lock, retrying until the timeout expires.
+func (streamFile *StreamFile) lock(exclusive bool) (err error) {
+	defer func() {
+		if state := recover(); state != nil {
+			err = log.Wrap(state.(error))
+		}
+	}()
+
+	deadline := time.Now().Add(streamFile.lockTimeout)
+
+	le := &LockedError{
+		Filepath:  streamFile.filepath,
+		Exclusive: exclusive,
+		Timeout:   streamFile.lockTimeout,
+	}
+
+	// Wait for any other goroutine that's using the file.
+
+	if streamFile.lockTimeout < 0 {
+		streamFile.inProcess <- struct{}{}
+	} else {
+		timer := time.NewTimer(streamFile.lockTimeout)
+		defer timer.Stop()
+
+		// Try first so that a zero timeout still succeeds if it's free.
+
+		select {
+		case streamFile.inProcess <- struct{}{}:
+		default:
+			select {
+			case streamFile.inProcess <- struct{}{}:
+			case <-timer.C:
+				return le
+			}
+		}
+	}
+
+	acquired := false
+
+	defer func() {
+		if acquired == false {
+			<-streamFile.inProcess
+		}
+	}()
+
+	for {
+		acquired, err = tryLockFile(streamFile.f, exclusive)
+		log.PanicIf(err)
+
+		if acquired == true {
+			streamFile.heldMutex.Lock()
+			streamFile.held = true
+			streamFile.heldMutex.Unlock()
+
+			return nil
+		}
+
+		if streamFile.lockTimeout >= 0 && time.Now().After(deadline) == true {
+			return le
+		}
+
+		time.Sleep(streamFile.pollInterval)
+	}
+}
+
+// RLock acquires a shared lock.
+func (streamFile *StreamFile) RLock() (err error) {
+	return streamFile.lock(false)
+}
+
+// Lock acquires an exclusive lock.
+func (streamFile *StreamFile) Lock() (err error) {
+	return streamFile.lock(true)
+}
+
+// Unlock releases whichever lock is held. It must be called by the goroutine
+// that acquired the lock. Returns `ErrStreamFileNotLocked` if no lock is held
+// (e.g. a second `Unlock`), in which case nothing is released.
+func (streamFile *StreamFile) Unlock() (err error) {
+	streamFile.heldMutex.Lock()
+	defer streamFile.heldMutex.Unlock()
+
+	if streamFile.held == false {
+		return ErrStreamFileNotLocked
+	}
+
+	err = unlockFile(streamFile.f)
+	if err != nil {
+		return err
+	}
+
+	streamFile.held = false
+
+	// Let the next goroutine in.
+	<-streamFile.inProcess
+
+	return nil
+}
+
+// ReadLocked calls the callback while holding a shared lock.
+func (streamFile *StreamFile) ReadLocked(cb func(rs io.ReadSeeker) error) (err error) {
+	err = streamFile.RLock()
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		unlockErr := streamFile.Unlock()
+		if err == nil {
+			err = unlockErr
+		}
+	}()
+
+	return cb(streamFile.f)
+}
+
+// WriteLocked calls the callback while holding an exclusive lock.
+func (streamFile *StreamFile) WriteLocked(cb func(rws io.ReadWriteSeeker) error) (err error) {
+	err = streamFile.Lock()
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		unlockErr := streamFile.Unlock()
+		if err == nil {
+			err = unlockErr
+		}
+	}()
+
+	return cb(streamFile.f)
+}
+
+// NewIndex builds an `Index` while holding a shared lock. Any reads done with
+// the series info that it returns should be done under `ReadLocked` since the
+// stream may change once the lock is released.
+func (streamFile *StreamFile) NewIndex() (index *Index, err error) {
+	err = streamFile.ReadLocked(func(rs io.ReadSeeker) error {
+		var err error
+
+		index, err = NewIndex(rs)
+		return err
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return index, nil
+}
+
+// Update writes the given series through an `Updater` while holding an
+// exclusive lock. The file will be truncated to the new size.
+func (streamFile *StreamFile) Update(seriesDataWriter interface{}, series []SeriesFooter) (totalSize int, stats UpdateStats, err error) {
+	err = streamFile.WriteLocked(func(rws io.ReadWriteSeeker) (err error) {
+		defer func() {
+			if state := recover(); state != nil {
+				err = log.Wrap(state.(error))
+			}
+		}()
+
+		updater := NewUpdater(rws, seriesDataWriter)
+
+		for _, seriesFooter := range series {
+			updater.AddSeries(seriesFooter)
+		}
+
+		totalSize, stats, err = updater.Write()
+		log.PanicIf(err)
+
+		streamFileLogger.Debugf(nil, "Updated stream file [%s]: %s", streamFile.filepath, stats)
+
+		return nil
+	})
+
+	if err != nil {
+		return 0, UpdateStats{}, err
+	}
+
+	return totalSize, stats, nil
+}
@@ -0,0 +1,31 @@
+//go:build darwin || dragonfly || freebsd || linux || netbsd || openbsd
+// +build darwin dragonfly freebsd linux netbsd openbsd
+
+package timetogo
+
+import (
+	"os"
+	"syscall"
+)
+
+// tryLockFile makes a single non-blocking attempt to acquire a lock.
+func tryLockFile(f *os.File, exclusive bool) (acquired bool, err error) {
+	how := syscall.LOCK_SH
+	if exclusive == true {
+		how = syscall.LOCK_EX
+	}
+
+	err = syscall.Flock(int(f.Fd()), how|syscall.LOCK_NB)
+	if err == nil {
+		return true, nil
+	} else if err == syscall.EWOULDBLOCK {
+		return false, nil
+	}
+
+	return false, err
+}
+
+// unlockFile releases any lock held on the file.
+func unlockFile(f *os.File) error {
+	return syscall.Flock(int(f.Fd()), syscall.LOCK_UN)
+}
@@ -0,0 +1,23 @@
+//go:build !darwin && !dragonfly && !freebsd && !linux && !netbsd && !openbsd
+// +build !darwin,!dragonfly,!freebsd,!linux,!netbsd,!openbsd
+
+package timetogo
+
+import (
+	"errors"
+	"os"
+)
+
+var (
+	// ErrFileLockingNotSupported indicates that advisory file locking is not
+	// available on this platform.
+	ErrFileLockingNotSupported = errors.New("file locking not supported on this platform")
+)
+
+func tryLockFile(f *os.File, exclusive bool) (acquired bool, err error) {
+	return false, ErrFileLockingNotSupported
+}
+
+func unlockFile(f *os.File) error {
+	return ErrFileLockingNotSupported
+}
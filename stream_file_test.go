@@ -0,0 +1,317 @@
+//go:build darwin || dragonfly || freebsd || linux || netbsd || openbsd
+// +build darwin dragonfly freebsd linux netbsd openbsd
+
+package timetogo
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path"
+	"sync"
+	"testing"
+	"time"
+
+	"io/ioutil"
+
+	"github.com/dsoprea/go-logging"
+)
+
+func getTestStreamFilepath() (tempPath, filepath string) {
+	tempPath, err := ioutil.TempDir("", "timetogo.stream_file.")
+	log.PanicIf(err)
+
+	filepath = path.Join(tempPath, "stream")
+
+	raw, _, _ := WriteTestMultiseriesStream()
+
+	err = ioutil.WriteFile(filepath, raw, 0644)
+	log.PanicIf(err)
+
+	return tempPath, filepath
+}
+
+func TestStreamFile_Locking(t *testing.T) {
+	tempPath, filepath := getTestStreamFilepath()
+	defer os.RemoveAll(tempPath)
+
+	writer, err := OpenStreamFile(filepath, time.Millisecond*50)
+	log.PanicIf(err)
+
+	defer writer.Close()
+
+	reader, err := OpenStreamFile(filepath, time.Millisecond*50)
+	log.PanicIf(err)
+
+	defer reader.Close()
+
+	err = writer.Lock()
+	log.PanicIf(err)
+
+	err = reader.RLock()
+	if err == nil {
+		t.Fatalf("Expected shared lock to fail while exclusive lock held.")
+	} else if IsLockedError(err) != true {
+		log.Panic(err)
+	}
+
+	le := err.(*LockedError)
+	if le.Exclusive != false || le.Filepath != filepath {
+		t.Fatalf("Locked error not correct: %v", le)
+	}
+
+	err = writer.Unlock()
+	log.PanicIf(err)
+
+	// Two shared locks can coexist, but not with an exclusive lock.
+
+	err = reader.RLock()
+	log.PanicIf(err)
+
+	other, err := OpenStreamFile(filepath, 0)
+	log.PanicIf(err)
+
+	defer other.Close()
+
+	err = other.RLock()
+	log.PanicIf(err)
+
+	err = other.Unlock()
+	log.PanicIf(err)
+
+	err = writer.Lock()
+	if IsLockedError(err) != true {
+		t.Fatalf("Expected exclusive lock to fail while shared lock held: %v", err)
+	}
+
+	err = reader.Unlock()
+	log.PanicIf(err)
+
+	err = writer.Lock()
+	log.PanicIf(err)
+
+	err = writer.Unlock()
+	log.PanicIf(err)
+}
+
+func TestStreamFile_Update(t *testing.T) {
+	tempPath, filepath := getTestStreamFilepath()
+	defer os.RemoveAll(tempPath)
+
+	streamFile, err := OpenStreamFile(filepath, time.Second)
+	log.PanicIf(err)
+
+	defer streamFile.Close()
+
+	index, err := streamFile.NewIndex()
+	log.PanicIf(err)
+
+	report := index.TimeRangeReport(time.Second)
+	if len(report.Overlaps) != 1 {
+		t.Fatalf("Index not loaded correctly: %s", report)
+	}
+
+	var series []SeriesFooter
+	err = streamFile.ReadLocked(func(rs io.ReadSeeker) error {
+		sr := NewStreamReader(rs)
+
+		it, err := NewIterator(sr)
+		log.PanicIf(err)
+
+		seriesFooter, _, err := it.Iterate(nil)
+		log.PanicIf(err)
+
+		series = append(series, seriesFooter)
+
+		return nil
+	})
+
+	log.PanicIf(err)
+
+	// Drop the first series.
+
+	totalSize, stats, err := streamFile.Update(nil, series)
+	log.PanicIf(err)
+
+	expectedStats := UpdateStats{
+		Skips: 1,
+		Drops: 1,
+	}
+
+	if stats != expectedStats {
+		t.Fatalf("Stats not correct: %s", stats)
+	}
+
+	raw, err := ioutil.ReadFile(filepath)
+	log.PanicIf(err)
+
+	if len(raw) != totalSize {
+		t.Fatalf("File not truncated: (%d) != (%d)", len(raw), totalSize)
+	}
+
+	footers, data := readTestStreamSeries(raw)
+
+	if len(footers) != 1 || footers[0].Uuid() != series[0].Uuid() {
+		t.Fatalf("Updated stream not correct.")
+	} else if bytes.Compare(data[0], TestTimeSeriesData2) != 0 {
+		t.Fatalf("Updated stream data not correct: %v", data[0])
+	}
+}
+
+func TestStreamFile_Update_Locked(t *testing.T) {
+	tempPath, filepath := getTestStreamFilepath()
+	defer os.RemoveAll(tempPath)
+
+	reader, err := OpenStreamFile(filepath, 0)
+	log.PanicIf(err)
+
+	defer reader.Close()
+
+	writer, err := OpenStreamFile(filepath, 0)
+	log.PanicIf(err)
+
+	defer writer.Close()
+
+	err = reader.RLock()
+	log.PanicIf(err)
+
+	_, _, err = writer.Update(nil, nil)
+	if IsLockedError(err) != true {
+		t.Fatalf("Expected update to fail while shared lock held: %v", err)
+	}
+}
+
+func TestStreamFile_InProcessExclusion(t *testing.T) {
+	tempPath, filepath := getTestStreamFilepath()
+	defer os.RemoveAll(tempPath)
+
+	streamFile, err := OpenStreamFile(filepath, 0)
+	log.PanicIf(err)
+
+	defer streamFile.Close()
+
+	// Advisory locks wouldn't stop a second goroutine from using the same
+	// `StreamFile`.
+
+	err = streamFile.Lock()
+	log.PanicIf(err)
+
+	errc := make(chan error)
+	go func() {
+		errc <- streamFile.ReadLocked(func(rs io.ReadSeeker) error {
+			return nil
+		})
+	}()
+
+	err = <-errc
+	if IsLockedError(err) != true {
+		t.Fatalf("Expected read to fail while another goroutine holds the lock: %v", err)
+	}
+
+	err = streamFile.Unlock()
+	log.PanicIf(err)
+
+	err = streamFile.ReadLocked(func(rs io.ReadSeeker) error {
+		return nil
+	})
+
+	log.PanicIf(err)
+}
+
+func TestStreamFile_Unlock_NotLocked(t *testing.T) {
+	tempPath, filepath := getTestStreamFilepath()
+	defer os.RemoveAll(tempPath)
+
+	streamFile, err := OpenStreamFile(filepath, 0)
+	log.PanicIf(err)
+
+	defer streamFile.Close()
+
+	err = streamFile.Unlock()
+	if err != ErrStreamFileNotLocked {
+		t.Fatalf("Expected failure for unlock without a lock: %v", err)
+	}
+
+	err = streamFile.Lock()
+	log.PanicIf(err)
+
+	err = streamFile.Unlock()
+	log.PanicIf(err)
+
+	err = streamFile.Unlock()
+	if err != ErrStreamFileNotLocked {
+		t.Fatalf("Expected failure for double unlock: %v", err)
+	}
+
+	// The extra unlocks must not have freed up a second slot.
+
+	err = streamFile.Lock()
+	log.PanicIf(err)
+
+	errc := make(chan error)
+	go func() {
+		errc <- streamFile.ReadLocked(func(rs io.ReadSeeker) error {
+			return nil
+		})
+	}()
+
+	err = <-errc
+	if IsLockedError(err) != true {
+		t.Fatalf("Expected read to fail while another goroutine holds the lock: %v", err)
+	}
+
+	err = streamFile.Unlock()
+	log.PanicIf(err)
+}
+
+func TestStreamFile_ReadLocked_Concurrent(t *testing.T) {
+	tempPath, filepath := getTestStreamFilepath()
+	defer os.RemoveAll(tempPath)
+
+	raw, err := ioutil.ReadFile(filepath)
+	log.PanicIf(err)
+
+	streamFile, err := OpenStreamFile(filepath, -1)
+	log.PanicIf(err)
+
+	defer streamFile.Close()
+
+	// Each goroutine reads a different part of the file. If they shared the
+	// file offset at the same time, they'd read each other's bytes.
+
+	var wg sync.WaitGroup
+
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+
+		go func(offset int64) {
+			defer wg.Done()
+
+			for j := 0; j < 50; j++ {
+				err := streamFile.ReadLocked(func(rs io.ReadSeeker) error {
+					_, err := rs.Seek(offset, os.SEEK_SET)
+					if err != nil {
+						return err
+					}
+
+					b := make([]byte, 100)
+
+					_, err = io.ReadFull(rs, b)
+					if err != nil {
+						return err
+					}
+
+					if bytes.Compare(b, raw[offset:offset+100]) != 0 {
+						t.Errorf("Data read at offset (%d) not correct.", offset)
+					}
+
+					return nil
+				})
+
+				log.PanicIf(err)
+			}
+		}(int64(i * 40))
+	}
+
+	wg.Wait()
+}
@@ -115,12 +115,41 @@ func (sw *StreamWriter) writeStreamFooter(streamFooter StreamFooter) (size int,
 
 	seriesVectorOffset := sw.b.EndVector(seriesCount)
 
+	// Allocate free regions. This field is omitted entirely if there aren't
+	// any, so footers for streams without free regions are unchanged.
+
+	freeRegions := streamFooterFreeRegions(streamFooter)
+
+	var freeRegionsVectorOffset flatbuffers.UOffsetT
+	if len(freeRegions) > 0 {
+		regionOffsets := make([]flatbuffers.UOffsetT, len(freeRegions))
+		for i, fr := range freeRegions {
+			ttgstream.StreamFreeRegionStart(sw.b)
+			ttgstream.StreamFreeRegionAddAbsolutePosition(sw.b, fr.AbsolutePosition)
+			ttgstream.StreamFreeRegionAddLength(sw.b, fr.Length)
+
+			regionOffsets[i] = ttgstream.StreamFreeRegionEnd(sw.b)
+		}
+
+		ttgstream.StreamFooter1StartFreeRegionsVector(sw.b, len(freeRegions))
+
+		for i := len(regionOffsets) - 1; i >= 0; i-- {
+			sw.b.PrependUOffsetT(regionOffsets[i])
+		}
+
+		freeRegionsVectorOffset = sw.b.EndVector(len(freeRegions))
+	}
+
 	// Build footer.
 
 	ttgstream.StreamFooter1Start(sw.b)
 
 	ttgstream.StreamFooter1AddSeries(sw.b, seriesVectorOffset)
 
+	if len(freeRegions) > 0 {
+		ttgstream.StreamFooter1AddFreeRegions(sw.b, freeRegionsVectorOffset)
+	}
+
 	sfPosition := ttgstream.StreamFooter1End(sw.b)
 
 	sw.b.Finish(sfPosition)
@@ -144,7 +173,7 @@ func (sw *StreamWriter) writeStreamFooter(streamFooter StreamFooter) (size int,
 	return size, nil
 }
 
-func (sw *StreamWriter) writeStreamFooterWithSeriesFooters(series []SeriesFooter, offsets []int64) (footerSize int, err error) {
+func (sw *StreamWriter) writeStreamFooterWithSeriesFooters(series []SeriesFooter, offsets []int64, freeRegions []FreeRegion) (footerSize int, err error) {
 	defer func() {
 		if state := recover(); state != nil {
 			err = log.Wrap(state.(error))
@@ -161,7 +190,7 @@ func (sw *StreamWriter) writeStreamFooterWithSeriesFooters(series []SeriesFooter
 		indexedSeries[i] = sisi
 	}
 
-	streamFooter := NewStreamFooter1FromStreamIndexedSequenceInfoSlice(indexedSeries)
+	streamFooter := NewStreamFooter1WithFreeRegions(indexedSeries, freeRegions)
 
 	footerSize, err = sw.writeStreamFooter(streamFooter)
 	log.PanicIf(err)
@@ -172,11 +201,16 @@ func (sw *StreamWriter) writeStreamFooterWithSeriesFooters(series []SeriesFooter
 // StreamFooter1 represents the stream footer (version 1) that's encoded in the
 // stream.
 type StreamFooter1 struct {
-	series []StreamIndexedSequenceInfo
+	series      []StreamIndexedSequenceInfo
+	freeRegions []FreeRegion
 }
 
 func (sf *StreamFooter1) String() string {
-	return fmt.Sprintf("StreamFooter1<COUNT=(%d)>", len(sf.Series()))
+	if len(sf.freeRegions) == 0 {
+		return fmt.Sprintf("StreamFooter1<COUNT=(%d)>", len(sf.Series()))
+	}
+
+	return fmt.Sprintf("StreamFooter1<COUNT=(%d) FREE-REGIONS=(%d)>", len(sf.Series()), len(sf.freeRegions))
 }
 
 // Series returns a list of all of the summary series information.
@@ -184,6 +218,11 @@ func (sf *StreamFooter1) Series() []StreamIndexedSequenceInfo {
 	return sf.series
 }
 
+// FreeRegions returns the unused regions between series.
+func (sf *StreamFooter1) FreeRegions() []FreeRegion {
+	return sf.freeRegions
+}
+
 // NewStreamFooter1FromStreamIndexedSequenceInfoSlice returns a new
 // `StreamFooter`-compatible struct.
 func NewStreamFooter1FromStreamIndexedSequenceInfoSlice(series []StreamIndexedSequenceInfo) StreamFooter {
@@ -194,6 +233,17 @@ func NewStreamFooter1FromStreamIndexedSequenceInfoSlice(series []StreamIndexedSe
 	return sf
 }
 
+// NewStreamFooter1WithFreeRegions returns a new `StreamFooter`-compatible
+// struct that also records unused regions of the stream.
+func NewStreamFooter1WithFreeRegions(series []StreamIndexedSequenceInfo, freeRegions []FreeRegion) StreamFooter {
+	sf := &StreamFooter1{
+		series:      series,
+		freeRegions: freeRegions,
+	}
+
+	return sf
+}
+
 // NewStreamFooter1FromEncoded decodes the given bytes and returns a
 // `StreamFooter`-compatible struct.
 func NewStreamFooter1FromEncoded(footerBytes []byte) (sf StreamFooter, err error) {
@@ -227,6 +277,26 @@ func NewStreamFooter1FromEncoded(footerBytes []byte) (sf StreamFooter, err error
 		series[i] = sisi
 	}
 
-	sf = NewStreamFooter1FromStreamIndexedSequenceInfoSlice(series)
+	var freeRegions []FreeRegion
+
+	freeRegionCount := sfEncoded.FreeRegionsLength()
+	if freeRegionCount > 0 {
+		freeRegions = make([]FreeRegion, freeRegionCount)
+	}
+
+	for i := 0; i < freeRegionCount; i++ {
+		frEncoded := ttgstream.StreamFreeRegion{}
+		found := sfEncoded.FreeRegions(&frEncoded, i)
+		if found == false {
+			log.Panicf("could not find free region (%d) in stream info", i)
+		}
+
+		freeRegions[i] = FreeRegion{
+			AbsolutePosition: frEncoded.AbsolutePosition(),
+			Length:           frEncoded.Length(),
+		}
+	}
+
+	sf = NewStreamFooter1WithFreeRegions(series, freeRegions)
 	return sf, nil
 }
@@ -79,3 +79,41 @@ func TestStreamWriter__StreamWriteAndRead(t *testing.T) {
 		t.Fatalf("Second series is not correct.")
 	}
 }
+
+func TestStreamWriter__StreamWriteAndRead_FreeRegions(t *testing.T) {
+	now := time.Now().UTC()
+
+	series := []StreamIndexedSequenceInfo{
+		NewStreamIndexedSequenceInfo1("uuid1", now, now.Add(time.Hour), 200),
+	}
+
+	freeRegions := []FreeRegion{
+		{AbsolutePosition: 0, Length: 50},
+		{AbsolutePosition: 201, Length: 10},
+	}
+
+	b := new(bytes.Buffer)
+	sw := NewStreamWriter(b)
+
+	_, err := sw.writeStreamFooter(NewStreamFooter1WithFreeRegions(series, freeRegions))
+	log.PanicIf(err)
+
+	sr := NewStreamReader(bytes.NewReader(b.Bytes()))
+
+	err = sr.Reset()
+	log.PanicIf(err)
+
+	sf, _, _, err := sr.readStreamFooter()
+	log.PanicIf(err)
+
+	if len(sf.Series()) != 1 || sf.Series()[0].AbsolutePosition() != 200 {
+		t.Fatalf("Series not correct: %v", sf.Series())
+	}
+
+	recovered := streamFooterFreeRegions(sf)
+	if len(recovered) != 2 {
+		t.Fatalf("Free-region count not correct: (%d)", len(recovered))
+	} else if recovered[0] != freeRegions[0] || recovered[1] != freeRegions[1] {
+		t.Fatalf("Free regions not correct: %v", recovered)
+	}
+}
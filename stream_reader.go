@@ -423,3 +423,57 @@ func (sr *StreamReader) Reset() (err error) {
 
 	return nil
 }
+
+// seriesDataPipe reads the data for one series in the background so that it
+// can be consumed as an `io.Reader`.
+type seriesDataPipe struct {
+	pr   *io.PipeReader
+	done chan struct{}
+}
+
+// newSeriesDataPipe starts reading the given series. The `StreamReader` must
+// not be used for anything else until the pipe has returned `io.EOF` or has
+// been closed. If the series fails its checksum, the reader returns
+// `ErrSeriesChecksumMismatch` after the last byte.
+func newSeriesDataPipe(sr *StreamReader, sisi StreamIndexedSequenceInfo) *seriesDataPipe {
+	pr, pw := io.Pipe()
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+
+		_, _, checksumOk, err := sr.ReadSeriesWithIndexedInfo(sisi, pw)
+		if err == nil && checksumOk == false {
+			err = ErrSeriesChecksumMismatch
+		}
+
+		// A nil error produces an EOF for the reader.
+		pw.CloseWithError(err)
+	}()
+
+	sdp := &seriesDataPipe{
+		pr:   pr,
+		done: done,
+	}
+
+	return sdp
+}
+
+// Read returns the next bytes of series data.
+func (sdp *seriesDataPipe) Read(p []byte) (n int, err error) {
+	n, err = sdp.pr.Read(p)
+	if err == io.EOF {
+		<-sdp.done
+	}
+
+	return n, err
+}
+
+// Close stops reading the series and waits for the background read to finish.
+func (sdp *seriesDataPipe) Close() (err error) {
+	err = sdp.pr.Close()
+
+	<-sdp.done
+
+	return err
+}
@@ -6,6 +6,7 @@ import (
 	"os"
 	"reflect"
 	"testing"
+	"time"
 
 	"github.com/dsoprea/go-logging"
 	"github.com/randomingenuity/go-utility/filesystem"
@@ -110,3 +111,100 @@ func TestStream__Protocol1(t *testing.T) {
 		t.Fatalf("Next-boundary offset after the series-data is not correct: (%d)", nextBoundaryOffset)
 	}
 }
+
+// testBareSeriesFooter only has the methods of `SeriesFooter`.
+type testBareSeriesFooter struct {
+	SeriesFooter
+}
+
+func TestSetRecordSummary(t *testing.T) {
+	headRecordTime := time.Date(2016, 10, 1, 12, 34, 56, 0, time.UTC)
+
+	sf := NewSeriesFooter1(time.Time{}, time.Time{}, 0, nil)
+
+	err := setRecordSummary(sf, headRecordTime, headRecordTime.Add(time.Second), 11, []byte{22})
+	log.PanicIf(err)
+
+	if sf.HeadRecordTime() != headRecordTime || sf.TailRecordTime() != headRecordTime.Add(time.Second) {
+		t.Fatalf("Times not correct: %s", sf)
+	} else if sf.RecordCount() != 11 {
+		t.Fatalf("Record count not correct: (%d)", sf.RecordCount())
+	}
+
+	err = setRecordSummary(testBareSeriesFooter{SeriesFooter: sf}, headRecordTime, headRecordTime, 1, nil)
+	if err == nil {
+		t.Fatalf("Expected failure for footer that doesn't support a summary.")
+	}
+}
+
+func TestCarryCreatedTime(t *testing.T) {
+	createdTime := time.Date(2016, 10, 1, 0, 0, 0, 0, time.UTC)
+
+	sf := NewSeriesFooter1(time.Time{}, time.Time{}, 0, nil)
+	carryCreatedTime(sf, createdTime)
+
+	if sf.CreatedTime() != createdTime {
+		t.Fatalf("Created-time not set: [%s]", sf.CreatedTime())
+	}
+
+	// A footer that doesn't support it keeps its own.
+
+	other := NewSeriesFooter1(time.Time{}, time.Time{}, 0, nil)
+	originalCreatedTime := other.CreatedTime()
+
+	carryCreatedTime(testBareSeriesFooter{SeriesFooter: other}, createdTime)
+
+	if other.CreatedTime() != originalCreatedTime {
+		t.Fatalf("Created-time should not have changed: [%s]", other.CreatedTime())
+	}
+}
+
+// testBareStreamFooter only has the methods of `StreamFooter`.
+type testBareStreamFooter struct {
+	StreamFooter
+}
+
+func TestStreamFooterFreeRegions(t *testing.T) {
+	_, series, _ := WriteTestMultiseriesStream()
+
+	indexedSeries := make([]StreamIndexedSequenceInfo, len(series))
+	for i, sf := range series {
+		indexedSeries[i] = NewStreamIndexedSequenceInfo1WithSeriesFooter(sf, int64(i))
+	}
+
+	freeRegions := []FreeRegion{
+		{AbsolutePosition: 10, Length: 20},
+	}
+
+	streamFooter := NewStreamFooter1WithFreeRegions(indexedSeries, freeRegions)
+
+	if reflect.DeepEqual(streamFooterFreeRegions(streamFooter), freeRegions) != true {
+		t.Fatalf("Free regions not correct: %v", streamFooterFreeRegions(streamFooter))
+	}
+
+	// A footer that doesn't support free regions has none, and can still be
+	// written.
+
+	bare := testBareStreamFooter{StreamFooter: streamFooter}
+
+	if streamFooterFreeRegions(bare) != nil {
+		t.Fatalf("Expected no free regions.")
+	}
+
+	b := new(bytes.Buffer)
+	sw := NewStreamWriter(b)
+
+	_, err := sw.writeStreamFooter(bare)
+	log.PanicIf(err)
+
+	sr := NewStreamReader(bytes.NewReader(b.Bytes()))
+
+	it, err := NewIterator(sr)
+	log.PanicIf(err)
+
+	if it.Count() != len(series) {
+		t.Fatalf("Series count not correct: (%d)", it.Count())
+	} else if len(it.FreeRegions()) != 0 {
+		t.Fatalf("Expected no free regions: %v", it.FreeRegions())
+	}
+}
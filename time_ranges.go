@@ -0,0 +1,271 @@
+package timetogo
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/dsoprea/go-logging"
+)
+
+var (
+	timeRangesLogger = log.NewLogger("timetogo.time_ranges")
+)
+
+var (
+	// ErrSeriesTimeRangeInverted indicates that a series has a head time that
+	// is after its tail time.
+	ErrSeriesTimeRangeInverted = errors.New("series head time is after tail time")
+
+	// ErrSeriesOverlap indicates that the time ranges of two series overlap.
+	ErrSeriesOverlap = errors.New("series time ranges overlap")
+
+	// ErrSeriesGap indicates that there is a gap between two series that is
+	// larger than allowed.
+	ErrSeriesGap = errors.New("gap between series time ranges")
+)
+
+// OverlapPolicy determines how series with problematic time ranges are
+// handled when building or updating a stream.
+type OverlapPolicy int
+
+const (
+	// OpAllow performs no checks. This is the default.
+	OpAllow OverlapPolicy = iota
+
+	// OpReject rejects series whose head time is after their tail time or
+	// whose time range overlaps with another series.
+	OpReject OverlapPolicy = iota
+
+	// OpContiguous applies `OpReject` and additionally requires that the gap
+	// between the tail of one series and the head of the next (in time order)
+	// is no larger than the max-gap.
+	OpContiguous OverlapPolicy = iota
+)
+
+const (
+	// DefaultContiguousMaxGap is the max-gap used for `OpContiguous` when
+	// zero is given. Times are stored with a resolution of one second, so
+	// this is the smallest gap that can exist between two adjacent series.
+	DefaultContiguousMaxGap = time.Second
+)
+
+// SeriesOverlap describes two series whose time ranges overlap.
+type SeriesOverlap struct {
+	First  StreamIndexedSequenceInfo
+	Second StreamIndexedSequenceInfo
+
+	// From and To describe the overlapping range.
+	From time.Time
+	To   time.Time
+}
+
+func (so SeriesOverlap) String() string {
+	return fmt.Sprintf("SeriesOverlap<FIRST=[%s] SECOND=[%s] FROM=[%s] TO=[%s]>", so.First.Uuid(), so.Second.Uuid(), so.From, so.To)
+}
+
+// SeriesGap describes an uncovered span of time between two series.
+type SeriesGap struct {
+	Before StreamIndexedSequenceInfo
+	After  StreamIndexedSequenceInfo
+
+	// From is the latest tail time before the gap and To is the head time
+	// after the gap.
+	From time.Time
+	To   time.Time
+}
+
+func (sg SeriesGap) String() string {
+	return fmt.Sprintf("SeriesGap<BEFORE=[%s] AFTER=[%s] FROM=[%s] TO=[%s]>", sg.Before.Uuid(), sg.After.Uuid(), sg.From, sg.To)
+}
+
+// TimeRangeReport describes the problems with the time ranges of a set of
+// series.
+type TimeRangeReport struct {
+	Inverted []StreamIndexedSequenceInfo
+	Overlaps []SeriesOverlap
+	Gaps     []SeriesGap
+}
+
+func (trr TimeRangeReport) String() string {
+	return fmt.Sprintf("TimeRangeReport<INVERTED=(%d) OVERLAPS=(%d) GAPS=(%d)>", len(trr.Inverted), len(trr.Overlaps), len(trr.Gaps))
+}
+
+// analyzeTimeRanges finds inverted ranges, overlaps, and any gaps larger than
+// `maxGap`. Times are inclusive so two series that share a boundary second
+// overlap.
+func analyzeTimeRanges(series []StreamIndexedSequenceInfo, maxGap time.Duration) (report TimeRangeReport) {
+	report.Inverted = make([]StreamIndexedSequenceInfo, 0)
+	report.Overlaps = make([]SeriesOverlap, 0)
+	report.Gaps = make([]SeriesGap, 0)
+
+	sorted := make([]StreamIndexedSequenceInfo, 0, len(series))
+	for _, sisi := range series {
+		if sisi.HeadRecordTime().After(sisi.TailRecordTime()) == true {
+			report.Inverted = append(report.Inverted, sisi)
+			continue
+		}
+
+		sorted = append(sorted, sisi)
+	}
+
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].HeadRecordTime().Before(sorted[j].HeadRecordTime())
+	})
+
+	for i, sisi := range sorted {
+		for _, other := range sorted[i+1:] {
+			if other.HeadRecordTime().After(sisi.TailRecordTime()) == true {
+				break
+			}
+
+			to := sisi.TailRecordTime()
+			if other.TailRecordTime().Before(to) == true {
+				to = other.TailRecordTime()
+			}
+
+			so := SeriesOverlap{
+				First:  sisi,
+				Second: other,
+				From:   other.HeadRecordTime(),
+				To:     to,
+			}
+
+			report.Overlaps = append(report.Overlaps, so)
+		}
+	}
+
+	if len(sorted) > 0 {
+		latest := sorted[0]
+		for _, sisi := range sorted[1:] {
+			if sisi.HeadRecordTime().Sub(latest.TailRecordTime()) > maxGap {
+				sg := SeriesGap{
+					Before: latest,
+					After:  sisi,
+					From:   latest.TailRecordTime(),
+					To:     sisi.HeadRecordTime(),
+				}
+
+				report.Gaps = append(report.Gaps, sg)
+			}
+
+			if sisi.TailRecordTime().After(latest.TailRecordTime()) == true {
+				latest = sisi
+			}
+		}
+	}
+
+	return report
+}
+
+// checkTimeRanges applies the given policy to the given series.
+func checkTimeRanges(series []StreamIndexedSequenceInfo, policy OverlapPolicy, maxGap time.Duration, checkGaps bool) (err error) {
+	defer func() {
+		if state := recover(); state != nil {
+			err = log.Wrap(state.(error))
+		}
+	}()
+
+	if policy == OpAllow {
+		return nil
+	}
+
+	if maxGap == 0 {
+		maxGap = DefaultContiguousMaxGap
+	}
+
+	report := analyzeTimeRanges(series, maxGap)
+
+	if len(report.Inverted) > 0 {
+		timeRangesLogger.Debugf(nil, "Series has inverted time range: %s", report.Inverted[0])
+		log.Panic(ErrSeriesTimeRangeInverted)
+	} else if len(report.Overlaps) > 0 {
+		timeRangesLogger.Debugf(nil, "Series overlap: %s", report.Overlaps[0])
+		log.Panic(ErrSeriesOverlap)
+	} else if policy == OpContiguous && checkGaps == true && len(report.Gaps) > 0 {
+		timeRangesLogger.Debugf(nil, "Series gap: %s", report.Gaps[0])
+		log.Panic(ErrSeriesGap)
+	}
+
+	return nil
+}
+
+// timeRange is an inclusive range of time.
+type timeRange struct {
+	head time.Time
+	tail time.Time
+}
+
+// timeRangeSet is the union of a set of time ranges. It's kept as disjoint
+// ranges sorted by time so that whether a new range overlaps any of them can
+// be found with a binary search rather than by comparing against every range.
+type timeRangeSet struct {
+	ranges []timeRange
+}
+
+// search returns the index of the first range that ends at or after `head`.
+func (trs *timeRangeSet) search(head time.Time) int {
+	return sort.Search(len(trs.ranges), func(i int) bool {
+		return trs.ranges[i].tail.Before(head) == false
+	})
+}
+
+// overlaps returns true if the given range intersects any range in the set.
+func (trs *timeRangeSet) overlaps(head, tail time.Time) bool {
+	i := trs.search(head)
+	return i < len(trs.ranges) && trs.ranges[i].head.After(tail) == false
+}
+
+// add adds the given range to the set, merging it with any ranges that it
+// overlaps. Inverted ranges are ignored, as they are for overlap checks.
+func (trs *timeRangeSet) add(head, tail time.Time) {
+	if head.After(tail) == true {
+		return
+	}
+
+	i := trs.search(head)
+
+	j := i
+	for j < len(trs.ranges) && trs.ranges[j].head.After(tail) == false {
+		j++
+	}
+
+	merged := timeRange{
+		head: head,
+		tail: tail,
+	}
+
+	if j == i {
+		// No overlap. Series are usually added in time order, so this is
+		// usually an append.
+
+		trs.ranges = append(trs.ranges, timeRange{})
+		copy(trs.ranges[i+1:], trs.ranges[i:])
+		trs.ranges[i] = merged
+
+		return
+	}
+
+	if trs.ranges[i].head.Before(merged.head) == true {
+		merged.head = trs.ranges[i].head
+	}
+
+	if trs.ranges[j-1].tail.After(merged.tail) == true {
+		merged.tail = trs.ranges[j-1].tail
+	}
+
+	trs.ranges[i] = merged
+	trs.ranges = append(trs.ranges[:i+1], trs.ranges[j:]...)
+}
+
+// seriesFootersToIndexedInfo converts footers to summary info for the purpose
+// of validation. The positions are not meaningful.
+func seriesFootersToIndexedInfo(series []SeriesFooter) []StreamIndexedSequenceInfo {
+	indexedSeries := make([]StreamIndexedSequenceInfo, len(series))
+	for i, seriesFooter := range series {
+		indexedSeries[i] = NewStreamIndexedSequenceInfo1WithSeriesFooter(seriesFooter, -1)
+	}
+
+	return indexedSeries
+}
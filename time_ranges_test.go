@@ -0,0 +1,286 @@
+package timetogo
+
+import (
+	"bytes"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/dsoprea/go-logging"
+	"github.com/randomingenuity/go-utility/filesystem"
+)
+
+func getTestTimeRange(uuid string, headOffset, tailOffset int) StreamIndexedSequenceInfo {
+	epoch := time.Date(2016, 10, 1, 0, 0, 0, 0, time.UTC)
+
+	return NewStreamIndexedSequenceInfo1(
+		uuid,
+		epoch.Add(time.Second*time.Duration(headOffset)),
+		epoch.Add(time.Second*time.Duration(tailOffset)),
+		0)
+}
+
+func TestAnalyzeTimeRanges_Contiguous(t *testing.T) {
+	series := []StreamIndexedSequenceInfo{
+		getTestTimeRange("b", 10, 19),
+		getTestTimeRange("a", 0, 9),
+		getTestTimeRange("c", 20, 29),
+	}
+
+	report := analyzeTimeRanges(series, time.Second)
+
+	if len(report.Inverted) != 0 || len(report.Overlaps) != 0 || len(report.Gaps) != 0 {
+		t.Fatalf("Expected no issues: %s", report)
+	}
+}
+
+func TestAnalyzeTimeRanges_Issues(t *testing.T) {
+	series := []StreamIndexedSequenceInfo{
+		getTestTimeRange("a", 0, 10),
+		getTestTimeRange("b", 10, 19),
+		getTestTimeRange("c", 30, 39),
+		getTestTimeRange("d", 50, 45),
+	}
+
+	report := analyzeTimeRanges(series, time.Second)
+
+	if len(report.Inverted) != 1 || report.Inverted[0].Uuid() != "d" {
+		t.Fatalf("Inverted series not correct: %v", report.Inverted)
+	}
+
+	if len(report.Overlaps) != 1 {
+		t.Fatalf("Overlaps not correct: %v", report.Overlaps)
+	} else if report.Overlaps[0].First.Uuid() != "a" || report.Overlaps[0].Second.Uuid() != "b" {
+		t.Fatalf("Overlap not correct: %s", report.Overlaps[0])
+	}
+
+	if len(report.Gaps) != 1 {
+		t.Fatalf("Gaps not correct: %v", report.Gaps)
+	} else if report.Gaps[0].Before.Uuid() != "b" || report.Gaps[0].After.Uuid() != "c" {
+		t.Fatalf("Gap not correct: %s", report.Gaps[0])
+	} else if report.Gaps[0].To.Sub(report.Gaps[0].From) != time.Second*11 {
+		t.Fatalf("Gap size not correct: %s", report.Gaps[0])
+	}
+}
+
+func TestStreamBuilder_SetOverlapPolicy_Reject(t *testing.T) {
+	b := rifs.NewSeekableBuffer()
+
+	sb := NewStreamBuilder(b)
+	sb.SetOverlapPolicy(OpReject, 0)
+
+	headRecordTime := time.Date(2016, 10, 1, 12, 34, 56, 0, time.UTC)
+
+	sf1 := NewSeriesFooter1(headRecordTime, headRecordTime.Add(time.Second*20), 22, []byte{11, 22, 33})
+
+	err := sb.AddSeries(bytes.NewBuffer(TestTimeSeriesData), sf1)
+	log.PanicIf(err)
+
+	sf2 := NewSeriesFooter1(headRecordTime.Add(time.Second*10), headRecordTime.Add(time.Second*30), 33, []byte{44, 55, 66})
+
+	err = sb.AddSeries(bytes.NewBuffer(TestTimeSeriesData2), sf2)
+	if err == nil {
+		t.Fatalf("Expected overlap failure.")
+	} else if log.Is(err, ErrSeriesOverlap) != true {
+		log.Panic(err)
+	}
+
+	sf3 := NewSeriesFooter1(headRecordTime.Add(time.Second*50), headRecordTime.Add(time.Second*40), 33, []byte{44, 55, 66})
+
+	err = sb.AddSeries(bytes.NewBuffer(TestTimeSeriesData2), sf3)
+	if err == nil {
+		t.Fatalf("Expected inversion failure.")
+	} else if log.Is(err, ErrSeriesTimeRangeInverted) != true {
+		log.Panic(err)
+	}
+}
+
+func TestStreamBuilder_SetOverlapPolicy_Contiguous(t *testing.T) {
+	b := rifs.NewSeekableBuffer()
+
+	sb := NewStreamBuilder(b)
+	sb.SetOverlapPolicy(OpContiguous, 0)
+
+	headRecordTime := time.Date(2016, 10, 1, 12, 34, 56, 0, time.UTC)
+
+	sf1 := NewSeriesFooter1(headRecordTime, headRecordTime.Add(time.Second*20), 22, []byte{11, 22, 33})
+
+	err := sb.AddSeries(bytes.NewBuffer(TestTimeSeriesData), sf1)
+	log.PanicIf(err)
+
+	sf2 := NewSeriesFooter1(headRecordTime.Add(time.Second*30), headRecordTime.Add(time.Second*40), 33, []byte{44, 55, 66})
+
+	err = sb.AddSeries(bytes.NewBuffer(TestTimeSeriesData2), sf2)
+	log.PanicIf(err)
+
+	_, err = sb.Finish()
+	if err == nil {
+		t.Fatalf("Expected gap failure.")
+	} else if log.Is(err, ErrSeriesGap) != true {
+		log.Panic(err)
+	}
+}
+
+func TestUpdater_SetOverlapPolicy_Reject(t *testing.T) {
+	raw, series, _ := WriteTestMultiseriesStream()
+
+	original := make([]byte, len(raw))
+	copy(original, raw)
+
+	rws := rifs.NewSeekableBufferWithBytes(raw)
+
+	updater := NewUpdater(rws, &SeriesDataTestGenerator{data: map[string]io.Reader{}})
+	updater.SetOverlapPolicy(OpReject, 0)
+
+	updater.AddSeries(series[1])
+	updater.AddSeries(series[0])
+
+	_, _, err := updater.Write()
+	if err == nil {
+		t.Fatalf("Expected overlap failure.")
+	} else if log.Is(err, ErrSeriesOverlap) != true {
+		log.Panic(err)
+	}
+
+	if bytes.Compare(rws.Bytes(), original) != 0 {
+		t.Fatalf("Stream was modified despite failure.")
+	}
+}
+
+func TestUpdater_SetOverlapPolicy_Reject_Summarized(t *testing.T) {
+	headRecordTime := time.Date(2016, 10, 1, 12, 34, 56, 0, time.UTC)
+
+	// The placeholder footers all overlap, but only the summaries of the first
+	// and third series do.
+
+	summaries := [][2]time.Time{
+		{headRecordTime, headRecordTime.Add(time.Second * 10)},
+		{headRecordTime.Add(time.Second * 20), headRecordTime.Add(time.Second * 30)},
+		{headRecordTime.Add(time.Second * 5), headRecordTime.Add(time.Second * 15)},
+	}
+
+	write := func(count int) (err error) {
+		uss := NewUpdaterSeriesSink(rifs.NewSeekableBuffer())
+		uss.Updater().SetOverlapPolicy(OpReject, 0)
+
+		for _, summary := range summaries[:count] {
+			tsd := &testSummarizerDatasource{
+				data:           TestTimeSeriesData,
+				headRecordTime: summary[0],
+				tailRecordTime: summary[1],
+			}
+
+			err := uss.AddSeries(tsd, NewSeriesFooter1(time.Time{}, time.Time{}, 0, nil))
+			log.PanicIf(err)
+		}
+
+		_, _, err = uss.Updater().Write()
+		return err
+	}
+
+	err := write(2)
+	log.PanicIf(err)
+
+	err = write(3)
+	if err == nil {
+		t.Fatalf("Expected overlap failure.")
+	} else if log.Is(err, ErrSeriesOverlap) != true {
+		log.Panic(err)
+	}
+}
+
+func TestTimeRangeSet(t *testing.T) {
+	base := time.Date(2016, 10, 1, 12, 34, 56, 0, time.UTC)
+
+	at := func(seconds int) time.Time {
+		return base.Add(time.Second * time.Duration(seconds))
+	}
+
+	trs := timeRangeSet{}
+
+	trs.add(at(10), at(20))
+	trs.add(at(40), at(50))
+	trs.add(at(0), at(5))
+
+	// Inverted ranges are ignored.
+	trs.add(at(70), at(60))
+
+	if len(trs.ranges) != 3 {
+		t.Fatalf("Range count not correct: (%d)", len(trs.ranges))
+	} else if trs.ranges[0].head != at(0) || trs.ranges[2].tail != at(50) {
+		t.Fatalf("Ranges not sorted: %v", trs.ranges)
+	}
+
+	checks := []struct {
+		head     int
+		tail     int
+		expected bool
+	}{
+		{6, 9, false},
+		{21, 39, false},
+		{51, 100, false},
+		{-10, -1, false},
+		{20, 20, true},
+		{15, 45, true},
+		{-10, 0, true},
+		{1, 2, true},
+		{50, 60, true},
+	}
+
+	for _, check := range checks {
+		if trs.overlaps(at(check.head), at(check.tail)) != check.expected {
+			t.Fatalf("Overlap of (%d)-(%d) not correct.", check.head, check.tail)
+		}
+	}
+
+	// An overlapping range merges everything that it touches.
+
+	trs.add(at(18), at(42))
+
+	if len(trs.ranges) != 2 {
+		t.Fatalf("Ranges not merged: %v", trs.ranges)
+	} else if trs.ranges[1].head != at(10) || trs.ranges[1].tail != at(50) {
+		t.Fatalf("Merged range not correct: %v", trs.ranges[1])
+	} else if trs.overlaps(at(30), at(30)) != true {
+		t.Fatalf("Merged range should overlap.")
+	}
+}
+
+func TestStreamBuilder_SetOverlapPolicy_Reject_NonAdjacent(t *testing.T) {
+	b := rifs.NewSeekableBuffer()
+	sb := NewStreamBuilder(b)
+
+	headRecordTime := time.Date(2016, 10, 1, 12, 34, 56, 0, time.UTC)
+
+	// Overlapping series are allowed until the policy is set. The first
+	// series covers the others.
+
+	sf1 := NewSeriesFooter1(headRecordTime, headRecordTime.Add(time.Hour), 1, []byte{1})
+
+	err := sb.AddSeries(bytes.NewBuffer(TestTimeSeriesData), sf1)
+	log.PanicIf(err)
+
+	sf2 := NewSeriesFooter1(headRecordTime.Add(time.Second*10), headRecordTime.Add(time.Second*20), 1, []byte{2})
+
+	err = sb.AddSeries(bytes.NewBuffer(TestTimeSeriesData), sf2)
+	log.PanicIf(err)
+
+	sb.SetOverlapPolicy(OpReject, 0)
+
+	// This is after its nearest neighbor (the second series) but inside the
+	// first.
+
+	sf3 := NewSeriesFooter1(headRecordTime.Add(time.Second*30), headRecordTime.Add(time.Second*40), 1, []byte{3})
+
+	err = sb.AddSeries(bytes.NewBuffer(TestTimeSeriesData), sf3)
+	if err == nil {
+		t.Fatalf("Expected overlap failure.")
+	} else if log.Is(err, ErrSeriesOverlap) != true {
+		log.Panic(err)
+	}
+
+	sf4 := NewSeriesFooter1(headRecordTime.Add(time.Hour*2), headRecordTime.Add(time.Hour*3), 1, []byte{4})
+
+	err = sb.AddSeries(bytes.NewBuffer(TestTimeSeriesData), sf4)
+	log.PanicIf(err)
+}
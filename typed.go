@@ -0,0 +1,342 @@
+//go:build go1.18
+// +build go1.18
+
+package timetogo
+
+import (
+	"io"
+	"time"
+
+	"encoding/gob"
+	"encoding/json"
+	"io/ioutil"
+
+	"github.com/dsoprea/go-logging"
+	"github.com/randomingenuity/go-utility/filesystem"
+)
+
+// Codec encodes and decodes the data for one series as a single value.
+type Codec[T any] interface {
+	// Encode writes the value.
+	Encode(w io.Writer, value T) (err error)
+
+	// Decode reads the value. The reader only returns the data for the one
+	// series.
+	Decode(r io.Reader) (value T, err error)
+}
+
+// GobCodec encodes a value with `encoding/gob`.
+type GobCodec[T any] struct{}
+
+// Encode writes the value.
+func (GobCodec[T]) Encode(w io.Writer, value T) (err error) {
+	return gob.NewEncoder(w).Encode(value)
+}
+
+// Decode reads the value.
+func (GobCodec[T]) Decode(r io.Reader) (value T, err error) {
+	err = gob.NewDecoder(r).Decode(&value)
+	return value, err
+}
+
+// JsonCodec encodes a value with `encoding/json`.
+type JsonCodec[T any] struct{}
+
+// Encode writes the value.
+func (JsonCodec[T]) Encode(w io.Writer, value T) (err error) {
+	return json.NewEncoder(w).Encode(value)
+}
+
+// Decode reads the value.
+func (JsonCodec[T]) Decode(r io.Reader) (value T, err error) {
+	defer func() {
+		if state := recover(); state != nil {
+			err = log.Wrap(state.(error))
+		}
+	}()
+
+	d := json.NewDecoder(r)
+
+	err = d.Decode(&value)
+	log.PanicIf(err)
+
+	err = drainJsonDecoder(d, r)
+	log.PanicIf(err)
+
+	return value, nil
+}
+
+// typedDatasourceWriter adapts a `Codec` to `SeriesDataDatasourceWriter`.
+type typedDatasourceWriter[T any] struct {
+	codec Codec[T]
+	value T
+}
+
+// WriteData encodes the value.
+func (tdw typedDatasourceWriter[T]) WriteData(w io.Writer, sf SeriesFooter) (n int, err error) {
+	defer func() {
+		if state := recover(); state != nil {
+			err = log.Wrap(state.(error))
+		}
+	}()
+
+	wc := rifs.NewWriteCounter(w)
+
+	err = tdw.codec.Encode(wc, tdw.value)
+	log.PanicIf(err)
+
+	return wc.Count(), nil
+}
+
+// typedDatasourceReader adapts a `Codec` to `SeriesDataDatasourceReader`.
+type typedDatasourceReader[T any] struct {
+	codec Codec[T]
+	value T
+}
+
+// ReadData decodes the value. Anything that the codec didn't read is skipped
+// so that the whole series is accounted for.
+func (tdr *typedDatasourceReader[T]) ReadData(r io.Reader, sf SeriesFooter) (n int, err error) {
+	defer func() {
+		if state := recover(); state != nil {
+			err = log.Wrap(state.(error))
+		}
+	}()
+
+	rc := rifs.NewReadCounter(r)
+
+	tdr.value, err = tdr.codec.Decode(rc)
+	log.PanicIf(err)
+
+	_, err = io.Copy(ioutil.Discard, rc)
+	log.PanicIf(err)
+
+	return rc.Count(), nil
+}
+
+// readTypedSeries reads and decodes the given series. A series that fails its
+// checksum returns `ErrSeriesChecksumMismatch`.
+func readTypedSeries[T any](sr *StreamReader, codec Codec[T], sisi StreamIndexedSequenceInfo) (value T, seriesFooter SeriesFooter, err error) {
+	defer func() {
+		if state := recover(); state != nil {
+			err = log.Wrap(state.(error))
+		}
+	}()
+
+	tdr := &typedDatasourceReader[T]{
+		codec: codec,
+	}
+
+	seriesFooter, _, checksumOk, err := sr.ReadSeriesWithIndexedInfo(sisi, tdr)
+	log.PanicIf(err)
+
+	if checksumOk == false {
+		log.Panic(ErrSeriesChecksumMismatch)
+	}
+
+	return tdr.value, seriesFooter, nil
+}
+
+// TypedSeries is a decoded series and its footer.
+type TypedSeries[T any] struct {
+	Value        T
+	SeriesFooter SeriesFooter
+}
+
+// TypedBuilder writes series whose data are values of one type.
+type TypedBuilder[T any] struct {
+	sb    *StreamBuilder
+	codec Codec[T]
+}
+
+// NewTypedBuilder returns a new `TypedBuilder` struct.
+func NewTypedBuilder[T any](sb *StreamBuilder, codec Codec[T]) *TypedBuilder[T] {
+	return &TypedBuilder[T]{
+		sb:    sb,
+		codec: codec,
+	}
+}
+
+// AddSeries encodes the value and adds it as a series.
+func (tb *TypedBuilder[T]) AddSeries(value T, sf SeriesFooter) (err error) {
+	defer func() {
+		if state := recover(); state != nil {
+			err = log.Wrap(state.(error))
+		}
+	}()
+
+	tdw := typedDatasourceWriter[T]{
+		codec: tb.codec,
+		value: value,
+	}
+
+	err = tb.sb.AddSeries(tdw, sf)
+	log.PanicIf(err)
+
+	return nil
+}
+
+// Finish writes the stream footer.
+func (tb *TypedBuilder[T]) Finish() (totalSize int, err error) {
+	return tb.sb.Finish()
+}
+
+// TypedIterator steps through the series in a stream and decodes each one, in
+// the same order as `Iterator`.
+type TypedIterator[T any] struct {
+	it    *Iterator
+	codec Codec[T]
+}
+
+// NewTypedIterator returns a new `TypedIterator` struct.
+func NewTypedIterator[T any](sr *StreamReader, codec Codec[T]) (ti *TypedIterator[T], err error) {
+	defer func() {
+		if state := recover(); state != nil {
+			err = log.Wrap(state.(error))
+		}
+	}()
+
+	it, err := NewIterator(sr)
+	if err != nil {
+		if err == io.EOF {
+			return nil, err
+		}
+
+		log.Panic(err)
+	}
+
+	ti = &TypedIterator[T]{
+		it:    it,
+		codec: codec,
+	}
+
+	return ti, nil
+}
+
+// Count returns the number of series in the stream.
+func (ti *TypedIterator[T]) Count() int {
+	return ti.it.Count()
+}
+
+// Iterate decodes the next series. It returns `io.EOF` after the last series.
+func (ti *TypedIterator[T]) Iterate() (value T, seriesFooter SeriesFooter, err error) {
+	defer func() {
+		if state := recover(); state != nil {
+			err = log.Wrap(state.(error))
+		}
+	}()
+
+	if ti.it.currentSeries < 0 {
+		return value, nil, io.EOF
+	}
+
+	sisi := ti.it.seriesInfo[ti.it.currentSeries]
+	ti.it.currentSeries--
+
+	value, seriesFooter, err = readTypedSeries(ti.it.sr, ti.codec, sisi)
+	log.PanicIf(err)
+
+	return value, seriesFooter, nil
+}
+
+// TypedIndex looks series up with an `Index` and decodes them.
+type TypedIndex[T any] struct {
+	index *Index
+	codec Codec[T]
+}
+
+// NewTypedIndex returns a new `TypedIndex` struct.
+func NewTypedIndex[T any](rs io.ReadSeeker, codec Codec[T]) (ti *TypedIndex[T], err error) {
+	defer func() {
+		if state := recover(); state != nil {
+			err = log.Wrap(state.(error))
+		}
+	}()
+
+	index, err := NewIndex(rs)
+	log.PanicIf(err)
+
+	ti = &TypedIndex[T]{
+		index: index,
+		codec: codec,
+	}
+
+	return ti, nil
+}
+
+// Index returns the underlying `Index`.
+func (ti *TypedIndex[T]) Index() *Index {
+	return ti.index
+}
+
+func (ti *TypedIndex[T]) read(matched []StreamIndexedSequenceInfo) (series []TypedSeries[T], err error) {
+	defer func() {
+		if state := recover(); state != nil {
+			err = log.Wrap(state.(error))
+		}
+	}()
+
+	series = make([]TypedSeries[T], len(matched))
+	for i, sisi := range matched {
+		value, seriesFooter, err := readTypedSeries(ti.index.sr, ti.codec, sisi)
+		log.PanicIf(err)
+
+		series[i] = TypedSeries[T]{
+			Value:        value,
+			SeriesFooter: seriesFooter,
+		}
+	}
+
+	return series, nil
+}
+
+// GetWithUuid decodes the series with the given UUID.
+func (ti *TypedIndex[T]) GetWithUuid(uuid string) (value T, seriesFooter SeriesFooter, found bool, err error) {
+	defer func() {
+		if state := recover(); state != nil {
+			err = log.Wrap(state.(error))
+		}
+	}()
+
+	sisi, found := ti.index.GetWithUuid(uuid)
+	if found == false {
+		return value, nil, false, nil
+	}
+
+	value, seriesFooter, err = readTypedSeries(ti.index.sr, ti.codec, sisi)
+	log.PanicIf(err)
+
+	return value, seriesFooter, true, nil
+}
+
+// GetWithTimestamp decodes all series that contain the given timestamp.
+func (ti *TypedIndex[T]) GetWithTimestamp(timestamp time.Time) (series []TypedSeries[T], err error) {
+	defer func() {
+		if state := recover(); state != nil {
+			err = log.Wrap(state.(error))
+		}
+	}()
+
+	matched, err := ti.index.GetWithTimestamp(timestamp)
+	log.PanicIf(err)
+
+	series, err = ti.read(matched)
+	log.PanicIf(err)
+
+	return series, nil
+}
+
+// GetWithRange decodes all series whose time range intersects the given range
+// (inclusive), in stream order.
+func (ti *TypedIndex[T]) GetWithRange(start, end time.Time) (series []TypedSeries[T], err error) {
+	defer func() {
+		if state := recover(); state != nil {
+			err = log.Wrap(state.(error))
+		}
+	}()
+
+	series, err = ti.read(ti.index.GetWithRange(start, end))
+	log.PanicIf(err)
+
+	return series, nil
+}
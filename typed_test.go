@@ -0,0 +1,154 @@
+//go:build go1.18
+// +build go1.18
+
+package timetogo
+
+import (
+	"io"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/dsoprea/go-logging"
+	"github.com/randomingenuity/go-utility/filesystem"
+)
+
+type testTypedRecord struct {
+	Timestamp int64
+	Value     float64
+}
+
+func writeTestTypedStream(codec Codec[[]testTypedRecord]) (sb *rifs.SeekableBuffer, seriesFooters []SeriesFooter, values [][]testTypedRecord) {
+	sb = rifs.NewSeekableBuffer()
+	tb := NewTypedBuilder[[]testTypedRecord](NewStreamBuilder(sb), codec)
+
+	headRecordTime := time.Date(2016, 10, 1, 12, 34, 56, 0, time.UTC)
+
+	values = [][]testTypedRecord{
+		{{Timestamp: 1, Value: 1.5}, {Timestamp: 2, Value: 2.5}},
+		{{Timestamp: 3, Value: 3.5}},
+	}
+
+	seriesFooters = []SeriesFooter{
+		NewSeriesFooter1(headRecordTime, headRecordTime.Add(time.Minute), 2, []byte{11, 22, 33}),
+		NewSeriesFooter1(headRecordTime.Add(time.Hour), headRecordTime.Add(time.Hour*2), 1, []byte{44, 55, 66}),
+	}
+
+	for i, value := range values {
+		err := tb.AddSeries(value, seriesFooters[i])
+		log.PanicIf(err)
+	}
+
+	_, err := tb.Finish()
+	log.PanicIf(err)
+
+	return sb, seriesFooters, values
+}
+
+func TestTypedIterator(t *testing.T) {
+	codecs := []Codec[[]testTypedRecord]{
+		GobCodec[[]testTypedRecord]{},
+		JsonCodec[[]testTypedRecord]{},
+	}
+
+	for _, codec := range codecs {
+		sb, seriesFooters, values := writeTestTypedStream(codec)
+
+		ti, err := NewTypedIterator[[]testTypedRecord](NewStreamReader(sb), codec)
+		log.PanicIf(err)
+
+		if ti.Count() != 2 {
+			t.Fatalf("Count not correct: (%d)", ti.Count())
+		}
+
+		// The iterator goes from the back of the stream to the front.
+
+		for i := 1; i >= 0; i-- {
+			value, seriesFooter, err := ti.Iterate()
+			log.PanicIf(err)
+
+			if seriesFooter.Uuid() != seriesFooters[i].Uuid() {
+				t.Fatalf("Series (%d) footer not correct with %T: %v", i, codec, seriesFooter)
+			} else if reflect.DeepEqual(value, values[i]) != true {
+				t.Fatalf("Series (%d) value not correct with %T: %v", i, codec, value)
+			}
+		}
+
+		_, _, err = ti.Iterate()
+		if err != io.EOF {
+			t.Fatalf("Expected EOF with %T: %v", codec, err)
+		}
+	}
+}
+
+func TestTypedIndex(t *testing.T) {
+	codec := JsonCodec[[]testTypedRecord]{}
+
+	sb, seriesFooters, values := writeTestTypedStream(codec)
+
+	ti, err := NewTypedIndex[[]testTypedRecord](sb, codec)
+	log.PanicIf(err)
+
+	value, seriesFooter, found, err := ti.GetWithUuid(seriesFooters[1].Uuid())
+	log.PanicIf(err)
+
+	if found != true {
+		t.Fatalf("Series not found.")
+	} else if seriesFooter.Uuid() != seriesFooters[1].Uuid() {
+		t.Fatalf("Footer not correct: %v", seriesFooter)
+	} else if reflect.DeepEqual(value, values[1]) != true {
+		t.Fatalf("Value not correct: %v", value)
+	}
+
+	_, _, found, err = ti.GetWithUuid("not-a-uuid")
+	log.PanicIf(err)
+
+	if found != false {
+		t.Fatalf("Expected series to not be found.")
+	}
+
+	series, err := ti.GetWithTimestamp(seriesFooters[0].HeadRecordTime().Add(time.Second))
+	log.PanicIf(err)
+
+	if len(series) != 1 {
+		t.Fatalf("Timestamp match count not correct: (%d)", len(series))
+	} else if reflect.DeepEqual(series[0].Value, values[0]) != true {
+		t.Fatalf("Timestamp match not correct: %v", series[0].Value)
+	}
+
+	series, err = ti.GetWithRange(seriesFooters[0].HeadRecordTime(), seriesFooters[1].TailRecordTime())
+	log.PanicIf(err)
+
+	if len(series) != 2 {
+		t.Fatalf("Range match count not correct: (%d)", len(series))
+	}
+
+	for i, ts := range series {
+		if ts.SeriesFooter.Uuid() != seriesFooters[i].Uuid() || reflect.DeepEqual(ts.Value, values[i]) != true {
+			t.Fatalf("Range match (%d) not correct: %v", i, ts)
+		}
+	}
+}
+
+func TestTypedIndex_ChecksumMismatch(t *testing.T) {
+	codec := JsonCodec[[]testTypedRecord]{}
+
+	sb, seriesFooters, _ := writeTestTypedStream(codec)
+
+	raw := sb.Bytes()
+
+	// Replace the trailing newline of the first series so that it still
+	// decodes.
+
+	raw[seriesFooters[0].BytesLength()-1] = ' '
+
+	ti, err := NewTypedIndex[[]testTypedRecord](rifs.NewSeekableBufferWithBytes(raw), codec)
+	log.PanicIf(err)
+
+	_, _, _, err = ti.GetWithUuid(seriesFooters[0].Uuid())
+	if err == nil {
+		t.Fatalf("Expected checksum failure.")
+	} else if log.Is(err, ErrSeriesChecksumMismatch) != true {
+		log.Panic(err)
+	}
+}
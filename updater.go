@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"time"
 
 	"io/ioutil"
 
@@ -36,17 +37,33 @@ type Truncater interface {
 // 	  stored before (those that are being updated) or in the order they were
 //    added (the new ones).
 type Updater struct {
+	// rws is nil for a copy-on-write update.
 	rws io.ReadWriteSeeker
 	it  *Iterator
 	sr  *StreamReader
 	sb  *StreamBuilder
 
-	br *rifs.BouncebackReader
+	// br is what existing series data is read from.
+	br io.ReadSeeker
+
+	// copyOnWrite indicates that the updated stream is written to a separate
+	// destination and the source is never modified.
+	copyOnWrite bool
 
 	seriesDataWriter interface{}
 	newSeries        []SeriesFooter
 
 	knownSeriesIndex map[seriesIndexKey]currentPersistedSeries
+
+	// knownSeriesByUuid indexes the existing series only by UUID so that we
+	// can recognize when the caller is replacing the data for a series.
+	knownSeriesByUuid map[string]currentPersistedSeries
+
+	overlapPolicy OverlapPolicy
+	maxGap        time.Duration
+
+	reuseFreeSpace   bool
+	maxFragmentation float64
 }
 
 type currentPersistedSeries struct {
@@ -61,8 +78,6 @@ type currentPersistedSeries struct {
 
 // NewUpdater returns a new `Updater` struct.
 func NewUpdater(rws io.ReadWriteSeeker, seriesDataWriter interface{}) *Updater {
-	sr := NewStreamReader(rws)
-
 	br, err := rifs.NewBouncebackReader(rws)
 	log.PanicIf(err)
 
@@ -71,6 +86,38 @@ func NewUpdater(rws io.ReadWriteSeeker, seriesDataWriter interface{}) *Updater {
 
 	sb := NewStreamBuilder(bw)
 
+	updater := newUpdater(rws, br, sb, seriesDataWriter)
+	updater.rws = rws
+
+	if updater.it != nil {
+		// Now that we've enumerated the series, go back to the front of the
+		// stream so that we're in a position to begin stepping forward.
+		_, err = bw.Seek(0, os.SEEK_SET)
+		log.PanicIf(err)
+	}
+
+	return updater
+}
+
+// NewCopyOnWriteUpdater returns an `Updater` that reads the existing stream
+// from `rs` and writes the updated stream to `w` (e.g. a temporary file that
+// will be renamed over the original). The source is never modified. Retained
+// series are copied to the destination rather than skipped over, and the whole
+// stream is always written even if there were no changes.
+func NewCopyOnWriteUpdater(rs io.ReadSeeker, w io.Writer, seriesDataWriter interface{}) *Updater {
+	sb := NewStreamBuilderWithWriter(w)
+
+	updater := newUpdater(rs, rs, sb, seriesDataWriter)
+	updater.copyOnWrite = true
+
+	return updater
+}
+
+// newUpdater reads the existing series from `rs` and returns an `Updater` that
+// will read existing series data from `br` and write through `sb`.
+func newUpdater(rs io.ReadSeeker, br io.ReadSeeker, sb *StreamBuilder, seriesDataWriter interface{}) *Updater {
+	sr := NewStreamReader(rs)
+
 	dataPresent := true
 	it, err := NewIterator(sr)
 	if err != nil {
@@ -85,6 +132,7 @@ func NewUpdater(rws io.ReadWriteSeeker, seriesDataWriter interface{}) *Updater {
 	// otherwise an efficient operation.
 
 	knownSeriesIndex := make(map[seriesIndexKey]currentPersistedSeries)
+	knownSeriesByUuid := make(map[string]currentPersistedSeries)
 
 	if dataPresent == true {
 		for i := 0; i < it.Count(); i++ {
@@ -102,26 +150,29 @@ func NewUpdater(rws io.ReadWriteSeeker, seriesDataWriter interface{}) *Updater {
 				TotalSeriesSize: totalSeriesSize,
 			}
 
+			// A replacement is identified by UUID alone, so it would be
+			// ambiguous which copy it replaces.
+			if _, found := knownSeriesByUuid[seriesFooter.Uuid()]; found == true {
+				updaterLogger.Debugf(nil, "Series [%s] is in the stream more than once.", seriesFooter.Uuid())
+				log.Panic(ErrDuplicateSeries)
+			}
+
 			knownSeriesIndex[sik] = cps
+			knownSeriesByUuid[seriesFooter.Uuid()] = cps
 		}
-
-		// Now that we've enumerated the series, go back to the front of the stream
-		// so that we're in a position to begin stepping forward.
-		_, err = bw.Seek(0, os.SEEK_SET)
-		log.PanicIf(err)
 	}
 
 	newSeries := make([]SeriesFooter, 0)
 
 	return &Updater{
-		rws:              rws,
-		it:               it,
-		sr:               sr,
-		sb:               sb,
-		br:               br,
-		seriesDataWriter: seriesDataWriter,
-		knownSeriesIndex: knownSeriesIndex,
-		newSeries:        newSeries,
+		it:                it,
+		sr:                sr,
+		sb:                sb,
+		br:                br,
+		seriesDataWriter:  seriesDataWriter,
+		knownSeriesIndex:  knownSeriesIndex,
+		knownSeriesByUuid: knownSeriesByUuid,
+		newSeries:         newSeries,
 	}
 }
 
@@ -135,8 +186,37 @@ func (updater *Updater) Structure() *StreamStructure {
 	return updater.sb.StreamWriter().Structure()
 }
 
+// SetOverlapPolicy determines how series with inverted, overlapping, or (for
+// `OpContiguous`) non-contiguous time ranges are handled. The series that are
+// retained as they are are checked before anything is written. New and
+// changed series are checked as they are written, once any summary from their
+// datasource has been applied, and a series that is rejected is not written.
+// However, an in-place update may already have moved earlier series by then,
+// so use copy-on-write if the original stream must be left intact.
+func (updater *Updater) SetOverlapPolicy(policy OverlapPolicy, maxGap time.Duration) {
+	updater.overlapPolicy = policy
+	updater.maxGap = maxGap
+
+	updater.sb.SetOverlapPolicy(policy, maxGap)
+}
+
+// SetFreeSpaceReuse enables writing new and changed series into the regions
+// left free by dropped or replaced series rather than copying every later
+// series forward. The series that are retained are not moved, the remaining
+// free regions are recorded in the stream footer, and the stream footer lists
+// the series in the order that they are in the stream. If the free space
+// between the retained series would be more than `maxFragmentation` (as a
+// fraction of the stream), the stream is compacted as usual instead. This is
+// not supported with a copy-on-write update.
+func (updater *Updater) SetFreeSpaceReuse(maxFragmentation float64) {
+	updater.reuseFreeSpace = true
+	updater.maxFragmentation = maxFragmentation
+}
+
 // AddSeries queues a series to be added. It's not actually written until
-// Write() is called.
+// Write() is called. If the UUID matches a series already in the stream but the
+// source SHA1 differs, the existing series will be replaced (the created-time
+// of the existing series will be retained if the footer supports setting it).
 func (updater *Updater) AddSeries(seriesFooter SeriesFooter) {
 	defer func() {
 		if state := recover(); state != nil {
@@ -227,8 +307,18 @@ func (updater *Updater) addExistingSeries(seriesFooter SeriesFooter, cps current
 	existingTotalSeriesSize := cps.TotalSeriesSize
 
 	// If this series and any that existed before it (if any) have, so far,
-	// been identical then no copy is necessary.
-	if currentSequencePosition == existingSeriesPosition && *anyChanges == false {
+	// been identical then no copy is necessary (unless we're writing to a
+	// separate destination or there are superseded bytes in front of it from
+	// an `Appender` update).
+	if updater.copyOnWrite == true {
+		// The destination is separate from the source, so every series that
+		// we retain has to be copied.
+
+		updaterLogger.Debugf(nil, "addExistingSeries: Copying existing series [%s] to destination.", seriesFooter.Uuid())
+
+		err := updater.copyForwardSeries(existingFilePosition, existingSeriesFooter)
+		log.PanicIf(err)
+	} else if currentSequencePosition == existingSeriesPosition && *anyChanges == false && existingFilePosition == updater.sb.NextOffset() {
 		// The series is already in the stream in the same place (and unchanged,
 		// or this function would've never been called).
 
@@ -236,7 +326,7 @@ func (updater *Updater) addExistingSeries(seriesFooter SeriesFooter, cps current
 
 		err := updater.sb.AddSeriesNoWrite(existingFilePosition, existingTotalSeriesSize, seriesFooter)
 		log.PanicIf(err)
-	} else if int64(existingSeriesPosition) > updater.sb.NextOffset() {
+	} else if existingFilePosition >= updater.sb.NextOffset() {
 		// The series is already in the stream, but past the current position.
 
 		*anyChanges = true
@@ -268,10 +358,15 @@ type UpdateStats struct {
 	Skips int
 	Adds  int
 	Drops int
+
+	// Replaces is the number of existing series whose data was replaced
+	// (same UUID, different source SHA1). These are not counted as adds or
+	// drops.
+	Replaces int
 }
 
 func (us UpdateStats) String() string {
-	return fmt.Sprintf("UpdateStats<SKIPS=(%d) ADDS=(%d) DROPS=(%d)>", us.Skips, us.Adds, us.Drops)
+	return fmt.Sprintf("UpdateStats<SKIPS=(%d) ADDS=(%d) DROPS=(%d) REPLACES=(%d)>", us.Skips, us.Adds, us.Drops, us.Replaces)
 }
 
 // Write executes the queued changes.
@@ -285,14 +380,52 @@ func (updater *Updater) Write() (totalSize int, stats UpdateStats, err error) {
 	// Index the series that we're to be writing.
 
 	newSeriesIndex := make(map[seriesIndexKey]SeriesFooter)
+	newSeriesUuids := make(map[string]struct{})
 
 	for i := 0; i < len(updater.newSeries); i++ {
 		seriesFooter := updater.newSeries[i]
 
+		if _, found := newSeriesUuids[seriesFooter.Uuid()]; found == true {
+			log.Panicf("series [%s] was added more than once", seriesFooter.Uuid())
+		}
+
+		newSeriesUuids[seriesFooter.Uuid()] = struct{}{}
+
 		sik := updateSeriesIndexingKey(seriesFooter)
 		newSeriesIndex[sik] = seriesFooter
 	}
 
+	// Validate the time ranges of the series that are being retained before we
+	// modify anything. The footers of new and changed series may not be final
+	// until their data has been written, so those are checked by the builder
+	// as they are added (as are gaps, for `OpContiguous`, when it's finished).
+
+	retainedFooters := make([]SeriesFooter, 0)
+	for _, cps := range updater.retainedSeries() {
+		retainedFooters = append(retainedFooters, cps.SeriesFooter)
+	}
+
+	err = checkTimeRanges(seriesFootersToIndexedInfo(retainedFooters), updater.overlapPolicy, updater.maxGap, false)
+	log.PanicIf(err)
+
+	if updater.reuseFreeSpace == true {
+		if updater.copyOnWrite == true {
+			log.Panicf("free-space reuse is not supported for copy-on-write updates")
+		}
+
+		freeRegions, dataEnd := updater.retainedFreeRegions()
+		fragmentation := freeSpaceFragmentation(freeRegions, dataEnd)
+
+		if fragmentation <= updater.maxFragmentation {
+			totalSize, stats, err = updater.writeReusingFreeSpace()
+			log.PanicIf(err)
+
+			return totalSize, stats, nil
+		}
+
+		updaterLogger.Debugf(nil, "Fragmentation (%.2f) exceeds the threshold (%.2f). Compacting.", fragmentation, updater.maxFragmentation)
+	}
+
 	// Copy the data that hasn't changed. It hasn't changed if the UUID and SHA1
 	// both match.
 
@@ -300,12 +433,17 @@ func (updater *Updater) Write() (totalSize int, stats UpdateStats, err error) {
 	anyChanges := false
 
 	hitsExisting := 0
-	for i, seriesFooter := range updater.newSeries {
+	hitsReplaced := 0
+	for _, seriesFooter := range updater.newSeries {
 		sik := updateSeriesIndexingKey(seriesFooter)
 		if cps, isExisting := updater.knownSeriesIndex[sik]; isExisting == false {
+			if _, isReplacement := updater.knownSeriesByUuid[seriesFooter.Uuid()]; isReplacement == true {
+				hitsReplaced++
+			}
+
 			continue
 		} else {
-			err := updater.addExistingSeries(seriesFooter, cps, i, &anyChanges)
+			err := updater.addExistingSeries(seriesFooter, cps, sequencePosition, &anyChanges)
 			log.PanicIf(err)
 
 			sequencePosition++
@@ -314,9 +452,10 @@ func (updater *Updater) Write() (totalSize int, stats UpdateStats, err error) {
 		}
 	}
 
-	stats.Drops = len(updater.knownSeriesIndex) - hitsExisting
+	stats.Drops = len(updater.knownSeriesIndex) - hitsExisting - hitsReplaced
 
-	// Now, add all of the new/changed series to the back.
+	// Now, add all of the new/changed series to the back. A changed series
+	// keeps its UUID and created-time but gets new data.
 
 	for _, seriesFooter := range updater.newSeries {
 		sik := updateSeriesIndexingKey(seriesFooter)
@@ -324,16 +463,28 @@ func (updater *Updater) Write() (totalSize int, stats UpdateStats, err error) {
 			continue
 		}
 
+		cps, isReplacement := updater.knownSeriesByUuid[seriesFooter.Uuid()]
+		if isReplacement == true {
+			updaterLogger.Debugf(nil, "Write: Replacing data for existing series [%s].", seriesFooter.Uuid())
+
+			carryCreatedTime(seriesFooter, cps.SeriesFooter.CreatedTime())
+		}
+
 		err = updater.appendNewSeries(seriesFooter)
 		log.PanicIf(err)
 
 		sequencePosition++
-		stats.Adds++
 		anyChanges = true
+
+		if isReplacement == true {
+			stats.Replaces++
+		} else {
+			stats.Adds++
+		}
 	}
 
-	noopStats := UpdateStats{0, 0, 0}
-	if stats == noopStats {
+	noopStats := UpdateStats{}
+	if stats == noopStats && updater.copyOnWrite == false {
 		updaterLogger.Debugf(nil, "No changes were made in the update. Not updating the stream footer.")
 
 		// Seek to the end so that we can still discover and get the length.
@@ -360,7 +511,9 @@ func (updater *Updater) Write() (totalSize int, stats UpdateStats, err error) {
 		totalSize, err = updater.sb.Finish()
 		log.PanicIf(err)
 
-		if truncater, ok := updater.rws.(Truncater); ok == true {
+		if updater.copyOnWrite == true {
+			// Nothing to truncate. The source was not modified.
+		} else if truncater, ok := updater.rws.(Truncater); ok == true {
 			updaterLogger.Debugf(nil, "Underlying RWS is also a truncater. Truncating stream to right size after update.")
 
 			err = truncater.Truncate(int64(totalSize))
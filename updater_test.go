@@ -361,6 +361,135 @@ func TestUpdater_AddSeries__CopyForward(t *testing.T) {
 	}
 }
 
+// TestUpdater_AddSeries_Replace replaces the data for the first series. The
+// second series has to be copied forward and the replacement is appended.
+func TestUpdater_AddSeries_Replace(t *testing.T) {
+	_, series, _ := WriteTestMultiseriesStream()
+
+	// Rewrite the stream with back-dated series so that we can tell that the
+	// created-time was carried forward and that the updated-time was bumped.
+
+	originalTime := time.Date(2016, 10, 1, 0, 0, 0, 0, time.UTC)
+
+	originalBuffer := rifs.NewSeekableBuffer()
+	sb := NewStreamBuilder(originalBuffer)
+
+	for i, data := range [][]byte{TestTimeSeriesData, TestTimeSeriesData2} {
+		series[i].createdTime = originalTime
+		series[i].updatedTime = originalTime
+
+		err := sb.AddSeries(bytes.NewBuffer(data), series[i])
+		log.PanicIf(err)
+	}
+
+	_, err := sb.Finish()
+	log.PanicIf(err)
+
+	raw := originalBuffer.Bytes()
+
+	// Update.
+
+	sourceSha1 := []byte{
+		77,
+		88,
+		99,
+	}
+
+	replacement := NewSeriesFooter1WithUuid(
+		series[0].Uuid(),
+		series[0].HeadRecordTime(),
+		series[0].TailRecordTime(),
+		33,
+		sourceSha1)
+
+	sdtg := &SeriesDataTestGenerator{
+		data: map[string]io.Reader{
+			replacement.Uuid(): bytes.NewBuffer(TestTimeSeriesData2),
+		},
+	}
+
+	rws := rifs.NewSeekableBufferWithBytes(raw)
+	updater := NewUpdater(rws, sdtg)
+
+	updater.AddSeries(replacement)
+	updater.AddSeries(series[1])
+
+	totalSize, stats, err := updater.Write()
+	log.PanicIf(err)
+
+	expectedStats := UpdateStats{
+		Skips:    1,
+		Replaces: 1,
+	}
+
+	if stats != expectedStats {
+		t.Fatalf("Stats not correct: %s", stats)
+	} else if totalSize != 560 {
+		t.Fatalf("Total stream size not correct: (%d)", totalSize)
+	}
+
+	// Read back.
+
+	r := bytes.NewReader(rws.Bytes())
+	sr := NewStreamReader(r)
+
+	it, err := NewIterator(sr)
+	log.PanicIf(err)
+
+	if it.Count() != 2 {
+		t.Fatalf("The stream doesn't have exactly two series: (%d)", it.Count())
+	}
+
+	b := new(bytes.Buffer)
+
+	replacedFooter, checksumOk, err := it.Iterate(b)
+	log.PanicIf(err)
+
+	if replacedFooter.Uuid() != series[0].Uuid() {
+		t.Fatalf("First encountered series is not the replacement.")
+	} else if checksumOk != true {
+		t.Fatalf("Replacement checksum not correct.")
+	} else if bytes.Compare(b.Bytes(), TestTimeSeriesData2) != 0 {
+		t.Fatalf("Replacement data not correct:\nACTUAL: %v\nEXPECTED: %v", b.Bytes(), TestTimeSeriesData2)
+	} else if replacedFooter.CreatedTime() != series[0].CreatedTime() {
+		t.Fatalf("Created-time was not retained: [%v] != [%v]", replacedFooter.CreatedTime(), series[0].CreatedTime())
+	} else if replacedFooter.UpdatedTime().After(series[0].UpdatedTime()) != true {
+		t.Fatalf("Updated-time was not bumped: [%v]", replacedFooter.UpdatedTime())
+	} else if replacedFooter.RecordCount() != 33 {
+		t.Fatalf("Record-count not correct: (%d)", replacedFooter.RecordCount())
+	}
+
+	b = new(bytes.Buffer)
+
+	retainedFooter, checksumOk, err := it.Iterate(b)
+	log.PanicIf(err)
+
+	if retainedFooter.Uuid() != series[1].Uuid() {
+		t.Fatalf("Second encountered series is not correct.")
+	} else if checksumOk != true {
+		t.Fatalf("Retained checksum not correct.")
+	} else if bytes.Compare(b.Bytes(), TestTimeSeriesData2) != 0 {
+		t.Fatalf("Retained data not correct:\nACTUAL: %v\nEXPECTED: %v", b.Bytes(), TestTimeSeriesData2)
+	}
+}
+
+func TestUpdater_AddSeries_DuplicateUuid(t *testing.T) {
+	raw, series, _ := WriteTestMultiseriesStream()
+
+	rws := rifs.NewSeekableBufferWithBytes(raw)
+	updater := NewUpdater(rws, nil)
+
+	updater.AddSeries(series[0])
+	updater.AddSeries(series[0])
+
+	_, _, err := updater.Write()
+	if err == nil {
+		t.Fatalf("Expected failure for duplicate UUID.")
+	} else if err.Error() != fmt.Sprintf("series [%s] was added more than once", series[0].Uuid()) {
+		log.Panic(err)
+	}
+}
+
 func ExampleUpdater_AddSeries() {
 	b := rifs.NewSeekableBuffer()
 
@@ -562,3 +691,159 @@ func TestUpdater_AddSeries_FromEmpty(t *testing.T) {
 		t.Fatalf("First encountered series is not correct.")
 	}
 }
+
+func TestUpdater_CopyOnWrite_NoChange(t *testing.T) {
+	raw, series, _ := WriteTestMultiseriesStream()
+
+	original := make([]byte, len(raw))
+	copy(original, raw)
+
+	b := new(bytes.Buffer)
+
+	updater := NewCopyOnWriteUpdater(bytes.NewReader(raw), b, nil)
+
+	updater.AddSeries(series[0])
+	updater.AddSeries(series[1])
+
+	totalSize, stats, err := updater.Write()
+	log.PanicIf(err)
+
+	if stats != (UpdateStats{Skips: 2}) {
+		t.Fatalf("Stats not correct: %s", stats)
+	} else if totalSize != len(raw) || b.Len() != len(raw) {
+		t.Fatalf("Total stream size not correct: (%d) (%d)", totalSize, b.Len())
+	} else if bytes.Compare(b.Bytes(), raw) != 0 {
+		t.Fatalf("Destination stream does not match the source.")
+	} else if bytes.Compare(raw, original) != 0 {
+		t.Fatalf("Source stream was modified.")
+	}
+}
+
+func TestUpdater_CopyOnWrite_DropAndAdd(t *testing.T) {
+	raw, series, _ := WriteTestMultiseriesStream()
+
+	original := make([]byte, len(raw))
+	copy(original, raw)
+
+	now := time.Now()
+
+	sf3 := NewSeriesFooter1(
+		now.Add(time.Second*10),
+		now.Add(time.Second*20),
+		33,
+		[]byte{77, 88, 99})
+
+	sdtg := &SeriesDataTestGenerator{
+		data: map[string]io.Reader{
+			sf3.Uuid(): bytes.NewBuffer(TestTimeSeriesData),
+		},
+	}
+
+	b := new(bytes.Buffer)
+
+	updater := NewCopyOnWriteUpdater(bytes.NewReader(raw), b, sdtg)
+
+	updater.AddSeries(series[1])
+	updater.AddSeries(sf3)
+
+	totalSize, stats, err := updater.Write()
+	log.PanicIf(err)
+
+	if stats != (UpdateStats{Skips: 1, Adds: 1, Drops: 1}) {
+		t.Fatalf("Stats not correct: %s", stats)
+	} else if totalSize != b.Len() {
+		t.Fatalf("Total stream size not correct: (%d) != (%d)", totalSize, b.Len())
+	} else if bytes.Compare(raw, original) != 0 {
+		t.Fatalf("Source stream was modified.")
+	}
+
+	footers, data := readTestStreamSeries(b.Bytes())
+
+	if len(footers) != 2 {
+		t.Fatalf("Series count not correct: (%d)", len(footers))
+	} else if footers[0].Uuid() != series[1].Uuid() || footers[1].Uuid() != sf3.Uuid() {
+		t.Fatalf("Series not correct.")
+	} else if bytes.Compare(data[0], TestTimeSeriesData2) != 0 {
+		t.Fatalf("Retained series data not correct.")
+	} else if bytes.Compare(data[1], TestTimeSeriesData) != 0 {
+		t.Fatalf("New series data not correct.")
+	}
+}
+
+func TestNewUpdater_DuplicateUuid(t *testing.T) {
+	_, series, _ := WriteTestMultiseriesStream()
+
+	duplicate := NewSeriesFooter1WithUuid(
+		series[0].Uuid(),
+		series[1].HeadRecordTime(),
+		series[1].TailRecordTime(),
+		series[1].RecordCount(),
+		series[1].SourceSha1())
+
+	b := rifs.NewSeekableBuffer()
+	sb := NewStreamBuilder(b)
+
+	err := sb.AddSeries(bytes.NewBuffer(TestTimeSeriesData), series[0])
+	log.PanicIf(err)
+
+	err = sb.AddSeries(bytes.NewBuffer(TestTimeSeriesData2), duplicate)
+	log.PanicIf(err)
+
+	_, err = sb.Finish()
+	log.PanicIf(err)
+
+	defer func() {
+		state := recover()
+		if state == nil {
+			t.Fatalf("Expected failure for duplicate UUID.")
+		}
+
+		err := state.(error)
+		if log.Is(err, ErrDuplicateSeries) != true {
+			log.Panic(err)
+		}
+	}()
+
+	NewUpdater(b, nil)
+}
+
+func TestUpdater_Write_Summarizer_SkipsUnchanged(t *testing.T) {
+	headRecordTime := time.Date(2016, 10, 1, 12, 34, 56, 0, time.UTC)
+
+	rws := rifs.NewSeekableBuffer()
+	seriesUuid := "5a8d4a0e-6f8e-4a0d-9d49-2c1a4b1f6a11"
+
+	// The caller's source SHA1 identifies the series, so a second write with
+	// the same one must skip it even though the datasource has a different
+	// SHA1 in its summary.
+
+	write := func() (stats UpdateStats) {
+		uss := NewUpdaterSeriesSink(rws)
+
+		tsd := &testSummarizerDatasource{
+			data:           TestTimeSeriesData,
+			headRecordTime: headRecordTime,
+			tailRecordTime: headRecordTime.Add(time.Second * 10),
+		}
+
+		sf := NewSeriesFooter1WithUuid(seriesUuid, time.Time{}, time.Time{}, 0, []byte{11, 22, 33})
+
+		err := uss.AddSeries(tsd, sf)
+		log.PanicIf(err)
+
+		_, stats, err = uss.Updater().Write()
+		log.PanicIf(err)
+
+		return stats
+	}
+
+	stats := write()
+	if stats != (UpdateStats{Adds: 1}) {
+		t.Fatalf("First stats not correct: %s", stats)
+	}
+
+	stats = write()
+	if stats != (UpdateStats{Skips: 1}) {
+		t.Fatalf("Second stats not correct: %s", stats)
+	}
+}